@@ -0,0 +1,61 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"fmt"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// EntryCorruptionError is returned by Step once the node found a log entry in
+// Storage whose checksum does not match its contents, see
+// Config.EntryChecksums.
+type EntryCorruptionError struct {
+	// Index is the index of the corrupted entry.
+	Index uint64
+}
+
+func (e *EntryCorruptionError) Error() string {
+	return fmt.Sprintf("raft: log entry %d is corrupted", e.Index)
+}
+
+// verify returns the longest prefix of the given entries whose checksums
+// match, if checksums are enabled.
+func (l *raftLog) verify(ents []pb.Entry) []pb.Entry {
+	if !l.checksums {
+		return ents
+	}
+	for i := range ents {
+		if !ents[i].VerifyChecksum() {
+			return ents[:i]
+		}
+	}
+	return ents
+}
+
+// verifyStored is like verify, for entries read from Storage. A corrupted
+// entry in Storage marks the log as such, which makes the node inoperable.
+func (l *raftLog) verifyStored(ents []pb.Entry) []pb.Entry {
+	verified := l.verify(ents)
+	if len(verified) < len(ents) {
+		index := ents[len(verified)].Index
+		if l.corruption == nil {
+			l.corruption = &EntryCorruptionError{Index: index}
+		}
+		l.logger.Errorf("entry %d from storage is corrupted, the node is inoperable", index)
+	}
+	return verified
+}
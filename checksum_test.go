@@ -0,0 +1,110 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func newChecksumTestRawNode(t *testing.T, storage *MemoryStorage) *RawNode {
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.EntryChecksums = true
+	rn, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	return rn
+}
+
+// TestEntryChecksumsReplication tests that the leader sets checksums on the
+// entries it appends, and that a follower rejects a MsgApp carrying corrupted
+// entries without becoming inoperable, so that the leader can send them again.
+func TestEntryChecksumsReplication(t *testing.T) {
+	leader := newChecksumTestRawNode(t, newTestMemoryStorage(withPeers(1, 2)))
+	leader.raft.becomeCandidate()
+	leader.raft.becomeLeader()
+	require.NoError(t, leader.Propose([]byte("foo")))
+	ents := leader.raft.raftLog.nextUnstableEnts()
+	require.Len(t, ents, 2)
+	for _, e := range ents {
+		require.NotZero(t, e.Checksum)
+		require.True(t, e.VerifyChecksum())
+	}
+
+	storage := newTestMemoryStorage(withPeers(1, 2))
+	cfg := newTestConfig(2, 10, 1, storage)
+	cfg.EntryChecksums = true
+	follower, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	app := pb.Message{From: 1, To: 2, Term: 1, Type: pb.MsgApp, Entries: append([]pb.Entry(nil), ents...)}
+	app.Entries[1].Data = []byte("bar")
+	require.NoError(t, follower.Step(app))
+	require.Zero(t, follower.raft.raftLog.lastIndex())
+	require.Equal(t, []pb.Message{{
+		From: 2, To: 1, Term: 1, Type: pb.MsgAppResp, Reject: true,
+	}}, follower.raft.readMessages())
+	require.Zero(t, follower.BasicStatus().CorruptedIndex)
+
+	// The leader sends the entries again.
+	app.Entries = ents
+	require.NoError(t, follower.Step(app))
+	require.Equal(t, uint64(2), follower.raft.raftLog.lastIndex())
+}
+
+// TestEntryChecksumsStorage tests that corrupted entries read from Storage are
+// neither sent to followers nor applied, and make the node inoperable.
+func TestEntryChecksumsStorage(t *testing.T) {
+	ents := cacheTestEntries(1, 6, 1)
+	for i := range ents {
+		ents[i].SetChecksum()
+	}
+	ents[3].Data = []byte("corrupted")
+	storage := newTestMemoryStorage(withPeers(1, 2))
+	require.NoError(t, storage.Append(ents))
+	require.NoError(t, storage.SetHardState(pb.HardState{Term: 1, Commit: 5}))
+	rn := newChecksumTestRawNode(t, storage)
+
+	// Only the entries before the corrupted one are applied.
+	rd := rn.Ready()
+	require.Len(t, rd.CommittedEntries, 3)
+	require.Equal(t, uint64(4), rn.BasicStatus().CorruptedIndex)
+	var cerr *EntryCorruptionError
+	require.ErrorAs(t, rn.Campaign(), &cerr)
+	require.Equal(t, uint64(4), cerr.Index)
+	// Ticks have no effect either.
+	for i := 0; i < 100; i++ {
+		rn.Tick()
+	}
+	require.Equal(t, StateFollower, rn.raft.state)
+
+	// A leader does not send the corrupted entry either.
+	storage = newTestMemoryStorage(withPeers(1, 2))
+	require.NoError(t, storage.Append(ents))
+	require.NoError(t, storage.SetHardState(pb.HardState{Term: 1}))
+	rn = newChecksumTestRawNode(t, storage)
+	r := rn.raft
+	r.becomeCandidate()
+	r.becomeLeader()
+	r.readMessages()
+	require.NoError(t, rn.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgAppResp,
+		Index: 5, Reject: true, RejectHint: 1, LogTerm: 1}))
+	msgs := r.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgApp, msgs[0].Type)
+	require.Len(t, msgs[0].Entries, 2)
+	require.Equal(t, uint64(4), rn.BasicStatus().CorruptedIndex)
+}
@@ -0,0 +1,275 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command raftdump prints serialized raft log entries, snapshots and hard
+// states in a human-readable form or as JSON.
+//
+// Usage:
+//
+//	raftdump [flags] [file]
+//
+// The input is read from the given file, or from stdin. The -input flag
+// selects its format:
+//
+//   - entries: a stream of pb.Entry, each preceded by its size as a uvarint
+//     (the default);
+//   - segment: the segment file of a raft.SpillStorage, which has the same
+//     format as entries;
+//   - snapshot: a single pb.Snapshot;
+//   - hardstate: a single pb.HardState.
+//
+// Entries can be filtered by index, term and type. ConfChange and ConfChangeV2
+// entries are decoded; the data of normal entries is printed by the formatter
+// selected with -formatter.
+//
+// With -output json, the input is printed in the JSON encoding of package
+// raftpb, one object per line:
+//
+//   - entries: {"entry": pb.Entry, "conf_change": pb.ConfChange or
+//     pb.ConfChangeV2 (omitempty), "description": the text output};
+//   - snapshot: {"metadata": pb.SnapshotMetadata, "data_size": int};
+//   - hardstate: pb.HardState.
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"go.etcd.io/raft/v3"
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// formatters are the EntryFormatters that can be selected with -formatter.
+var formatters = map[string]raft.EntryFormatter{
+	"quoted": func(data []byte) string { return fmt.Sprintf("%q", data) },
+	"hex":    hex.EncodeToString,
+	"size":   func(data []byte) string { return fmt.Sprintf("<%d bytes>", len(data)) },
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "raftdump: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// options are the parsed command-line flags.
+type options struct {
+	input              string
+	minIndex, maxIndex uint64
+	minTerm, maxTerm   uint64
+	types              map[pb.EntryType]bool
+	formatter          raft.EntryFormatter
+	json               bool
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("raftdump", flag.ContinueOnError)
+	var opts options
+	var types, formatter, output string
+	fs.StringVar(&opts.input, "input", "entries", "input format: entries, segment, snapshot or hardstate")
+	fs.Uint64Var(&opts.minIndex, "min-index", 0, "skip entries below this index")
+	fs.Uint64Var(&opts.maxIndex, "max-index", math.MaxUint64, "skip entries above this index")
+	fs.Uint64Var(&opts.minTerm, "min-term", 0, "skip entries below this term")
+	fs.Uint64Var(&opts.maxTerm, "max-term", math.MaxUint64, "skip entries above this term")
+	fs.StringVar(&types, "type", "", "comma-separated entry types to print, e.g. EntryConfChange,EntryConfChangeV2 (default all)")
+	fs.StringVar(&formatter, "formatter", "quoted", "formatter of entry data: "+strings.Join(formatterNames(), ", "))
+	fs.StringVar(&output, "output", "text", "output format: text or json")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if types != "" {
+		opts.types = map[pb.EntryType]bool{}
+		for _, name := range strings.Split(types, ",") {
+			typ, ok := pb.EntryType_value[strings.TrimSpace(name)]
+			if !ok {
+				return fmt.Errorf("unknown entry type %q", name)
+			}
+			opts.types[pb.EntryType(typ)] = true
+		}
+	}
+	var ok bool
+	if opts.formatter, ok = formatters[formatter]; !ok {
+		return fmt.Errorf("unknown formatter %q", formatter)
+	}
+	switch output {
+	case "text":
+	case "json":
+		opts.json = true
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	in := stdin
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	default:
+		return errors.New("at most one input file can be given")
+	}
+	return dump(bufio.NewReader(in), stdout, opts)
+}
+
+func formatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func dump(r *bufio.Reader, w io.Writer, opts options) error {
+	switch opts.input {
+	case "entries", "segment":
+		cr := &countingReader{r: r}
+		for {
+			off := cr.n
+			size, err := binary.ReadUvarint(cr)
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("reading entry size at offset %d: %w", off, err)
+			}
+			if size > math.MaxInt64 {
+				return fmt.Errorf("invalid entry size %d at offset %d", size, off)
+			}
+			// The size may be corrupt, so don't trust it for the allocation:
+			// read at most that much of what is left of the input.
+			buf, err := io.ReadAll(io.LimitReader(cr, int64(size)))
+			if err != nil {
+				return fmt.Errorf("reading entry at offset %d: %w", off, err)
+			}
+			if uint64(len(buf)) != size {
+				return fmt.Errorf("truncated entry at offset %d: size %d, but only %d bytes left", off, size, len(buf))
+			}
+			var e pb.Entry
+			if err := e.Unmarshal(buf); err != nil {
+				return fmt.Errorf("decoding entry at offset %d: %w", off, err)
+			}
+			if err := printEntry(w, e, opts); err != nil {
+				return err
+			}
+		}
+	case "snapshot":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var snap pb.Snapshot
+		if err := snap.Unmarshal(data); err != nil {
+			return err
+		}
+		if opts.json {
+			return json.NewEncoder(w).Encode(snapshotJSON{Metadata: snap.Metadata, DataSize: len(snap.Data)})
+		}
+		_, err = fmt.Fprintln(w, raft.DescribeSnapshot(snap))
+		return err
+	case "hardstate":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var hs pb.HardState
+		if err := hs.Unmarshal(data); err != nil {
+			return err
+		}
+		if opts.json {
+			return json.NewEncoder(w).Encode(hs)
+		}
+		_, err = fmt.Fprintln(w, raft.DescribeHardState(hs))
+		return err
+	}
+	return fmt.Errorf("unknown input format %q", opts.input)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
+
+func printEntry(w io.Writer, e pb.Entry, opts options) error {
+	if e.Index < opts.minIndex || e.Index > opts.maxIndex ||
+		e.Term < opts.minTerm || e.Term > opts.maxTerm ||
+		(opts.types != nil && !opts.types[e.Type]) {
+		return nil
+	}
+	if !opts.json {
+		_, err := io.WriteString(w, raft.DescribeEntries([]pb.Entry{e}, opts.formatter))
+		return err
+	}
+	ej := entryJSON{Entry: e, Description: raft.DescribeEntry(e, opts.formatter)}
+	switch e.Type {
+	case pb.EntryConfChange:
+		var cc pb.ConfChange
+		if err := cc.Unmarshal(e.Data); err != nil {
+			return fmt.Errorf("entry %d: %w", e.Index, err)
+		}
+		ej.ConfChange = cc
+	case pb.EntryConfChangeV2:
+		var cc pb.ConfChangeV2
+		if err := cc.Unmarshal(e.Data); err != nil {
+			return fmt.Errorf("entry %d: %w", e.Index, err)
+		}
+		ej.ConfChange = cc
+	}
+	return json.NewEncoder(w).Encode(ej)
+}
+
+type entryJSON struct {
+	Entry pb.Entry `json:"entry"`
+	// ConfChange is the decoded pb.ConfChange or pb.ConfChangeV2 of a conf
+	// change entry.
+	ConfChange  pb.ConfChangeI `json:"conf_change,omitempty"`
+	Description string         `json:"description"`
+}
+
+type snapshotJSON struct {
+	Metadata pb.SnapshotMetadata `json:"metadata"`
+	DataSize int                 `json:"data_size"`
+}
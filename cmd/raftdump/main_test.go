@@ -0,0 +1,140 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.etcd.io/raft/v3"
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func testEntries(t *testing.T) []pb.Entry {
+	cc, err := (&pb.ConfChange{Type: pb.ConfChangeAddNode, NodeID: 2}).Marshal()
+	require.NoError(t, err)
+	ccv2, err := (&pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{
+		{Type: pb.ConfChangeRemoveNode, NodeID: 3},
+		{Type: pb.ConfChangeUpdateNode, NodeID: 1, Metadata: &pb.NodeMetadata{NodeID: 1, Address: "a1"}},
+	}}).Marshal()
+	require.NoError(t, err)
+	return []pb.Entry{
+		{Index: 1, Term: 1, Type: pb.EntryNormal, Data: []byte("foo")},
+		{Index: 2, Term: 1, Type: pb.EntryConfChange, Data: cc},
+		{Index: 3, Term: 2, Type: pb.EntryNormal},
+		{Index: 4, Term: 2, Type: pb.EntryConfChangeV2, Data: ccv2},
+	}
+}
+
+func runDump(t *testing.T, in []byte, args ...string) string {
+	var out bytes.Buffer
+	require.NoError(t, run(args, bytes.NewReader(in), &out))
+	return out.String()
+}
+
+func TestDumpEntries(t *testing.T) {
+	var in []byte
+	var off, size int // of the last entry
+	for _, e := range testEntries(t) {
+		b, err := e.Marshal()
+		require.NoError(t, err)
+		off, size = len(in), len(b)
+		in = binary.AppendUvarint(in, uint64(len(b)))
+		in = append(in, b...)
+	}
+
+	require.Equal(t, `1/1 EntryNormal "foo"
+1/2 EntryConfChange v2
+2/3 EntryNormal ""
+2/4 EntryConfChangeV2 r3 u1
+`, runDump(t, in))
+
+	require.Equal(t, `1/2 EntryConfChange v2
+2/4 EntryConfChangeV2 r3 u1
+`, runDump(t, in, "-type", "EntryConfChange,EntryConfChangeV2"))
+
+	require.Equal(t, "2/3 EntryNormal <0 bytes>\n",
+		runDump(t, in, "-min-index", "2", "-max-index", "3", "-min-term", "2", "-formatter", "size"))
+
+	require.Equal(t, `{"entry":{"Term":1,"Index":1,"Type":"EntryNormal","Data":"Zm9v"},"description":"1/1 EntryNormal 666f6f"}
+{"entry":{"Term":1,"Index":2,"Type":"EntryConfChange","Data":"CAAQABgC"},"conf_change":{"type":"ConfChangeAddNode","node_id":2,"id":0},"description":"1/2 EntryConfChange v2"}
+`, runDump(t, in, "-max-term", "1", "-output", "json", "-formatter", "hex"))
+
+	require.Equal(t, `{"entry":{"Term":2,"Index":4,"Type":"EntryConfChangeV2","Data":"CAASBAgBEAMSEAgCEAEaCggBEgJhMRoAKAA="},"conf_change":{"transition":"ConfChangeTransitionAuto","changes":[{"type":"ConfChangeRemoveNode","node_id":3},{"type":"ConfChangeUpdateNode","node_id":1,"metadata":{"node_id":1,"address":"a1","locality":"","flags":0}}]},"description":"2/4 EntryConfChangeV2 r3 u1"}
+`, runDump(t, in, "-min-index", "4", "-output", "json"))
+
+	var out bytes.Buffer
+	require.Error(t, run([]string{"-type", "EntryBogus"}, bytes.NewReader(in), &out))
+	require.EqualError(t, run(nil, bytes.NewReader(in[:len(in)-1]), &out),
+		fmt.Sprintf("truncated entry at offset %d: size %d, but only %d bytes left", off, size, size-1))
+	// A corrupt size does not make it allocate more than what is left.
+	corrupt := binary.AppendUvarint(in[:off:off], 1<<62)
+	require.EqualError(t, run(nil, bytes.NewReader(corrupt), &out),
+		fmt.Sprintf("truncated entry at offset %d: size %d, but only 0 bytes left", off, uint64(1<<62)))
+}
+
+func TestDumpSegment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment")
+	s, err := raft.NewSpillStorage(path, 1)
+	require.NoError(t, err)
+	ents := testEntries(t)
+	ents[2].SetChecksum()
+	require.NoError(t, s.Append(ents))
+	require.Equal(t, 3, s.SpilledEntries())
+
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"-input", "segment", path}, nil, &out))
+	require.Equal(t, `1/1 EntryNormal "foo"
+1/2 EntryConfChange v2
+2/3 EntryNormal ""
+`, out.String())
+
+	// Overwrite the spilled tail of the log.
+	require.NoError(t, s.Append([]pb.Entry{
+		{Index: 3, Term: 3, Data: []byte("bar")},
+		{Index: 4, Term: 3},
+	}))
+	require.NoError(t, s.Close())
+	out.Reset()
+	require.NoError(t, run([]string{"-input", "segment", path}, nil, &out))
+	require.Equal(t, `1/1 EntryNormal "foo"
+1/2 EntryConfChange v2
+3/3 EntryNormal "bar"
+`, out.String())
+}
+
+func TestDumpSnapshotAndHardState(t *testing.T) {
+	snap := pb.Snapshot{Data: []byte("data"), Metadata: pb.SnapshotMetadata{
+		Index: 10, Term: 2, ConfState: pb.ConfState{Voters: []uint64{1, 2}},
+	}}
+	in, err := snap.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, "Index:10 Term:2 ConfState:Voters:[1 2] VotersOutgoing:[] Learners:[] LearnersNext:[] AutoLeave:false\n",
+		runDump(t, in, "-input", "snapshot"))
+	require.Equal(t, `{"metadata":{"conf_state":{"voters":[1,2],"auto_leave":false,"metadata":null},"index":10,"term":2},"data_size":4}
+`, runDump(t, in, "-input", "snapshot", "-output", "json"))
+
+	hs := pb.HardState{Term: 3, Vote: 1, Commit: 10}
+	in, err = hs.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, "Term:3 Vote:1 Commit:10\n", runDump(t, in, "-input", "hardstate"))
+	require.Equal(t, `{"term":3,"vote":1,"commit":10}
+`, runDump(t, in, "-input", "hardstate", "-output", "json"))
+}
@@ -116,6 +116,7 @@ func (c Changer) LeaveJoint() (tracker.Config, tracker.ProgressMap, error) {
 
 		if !isVoter && !isLearner {
 			delete(prs, id)
+			deleteMetadata(&cfg, id)
 		}
 	}
 	*outgoingPtr(&cfg.Voters) = nil
@@ -165,11 +166,26 @@ func (c Changer) apply(cfg *tracker.Config, prs tracker.ProgressMap, ccs ...pb.C
 		case pb.ConfChangeAddLearnerNode:
 			c.makeLearner(cfg, prs, cc.NodeID)
 		case pb.ConfChangeRemoveNode:
+			if cc.Metadata != nil {
+				return fmt.Errorf("can't set metadata of removed node %d", cc.NodeID)
+			}
 			c.remove(cfg, prs, cc.NodeID)
+			// Keep the metadata as long as the Progress.
+			if _, ok := prs[cc.NodeID]; !ok {
+				deleteMetadata(cfg, cc.NodeID)
+			}
 		case pb.ConfChangeUpdateNode:
+			if _, ok := prs[cc.NodeID]; !ok && cc.Metadata != nil {
+				return fmt.Errorf("can't update metadata of unknown node %d", cc.NodeID)
+			}
 		default:
 			return fmt.Errorf("unexpected conf type %d", cc.Type)
 		}
+		if cc.Metadata != nil {
+			if err := setMetadata(cfg, cc.NodeID, *cc.Metadata); err != nil {
+				return err
+			}
+		}
 	}
 	if len(incoming(cfg.Voters)) == 0 {
 		return errors.New("removed all voters")
@@ -247,6 +263,30 @@ func (c Changer) remove(cfg *tracker.Config, prs tracker.ProgressMap, id uint64)
 	}
 }
 
+// setMetadata sets the metadata of the given peer. The NodeID of the metadata
+// may be left zero.
+func setMetadata(cfg *tracker.Config, id uint64, md pb.NodeMetadata) error {
+	if md.NodeID != 0 && md.NodeID != id {
+		return fmt.Errorf("metadata for %d has node ID %d", id, md.NodeID)
+	}
+	md = tracker.CloneNodeMetadata(md)
+	md.NodeID = id
+	if cfg.Metadata == nil {
+		cfg.Metadata = map[uint64]pb.NodeMetadata{}
+	}
+	cfg.Metadata[id] = md
+	return nil
+}
+
+// deleteMetadata deletes the metadata of the given peer, nil'ing the map if it
+// is empty after.
+func deleteMetadata(cfg *tracker.Config, id uint64) {
+	delete(cfg.Metadata, id)
+	if len(cfg.Metadata) == 0 {
+		cfg.Metadata = nil
+	}
+}
+
 // initProgress initializes a new progress for the given node or learner.
 func (c Changer) initProgress(cfg *tracker.Config, prs tracker.ProgressMap, id uint64, isLearner bool) {
 	if !isLearner {
@@ -265,7 +305,7 @@ func (c Changer) initProgress(cfg *tracker.Config, prs tracker.ProgressMap, id u
 		// making the first index the better choice).
 		Next:      c.LastIndex,
 		Match:     0,
-		Inflights: tracker.NewInflights(c.Tracker.MaxInflight, c.Tracker.MaxInflightBytes),
+		Inflights: c.Tracker.NewInflights(),
 		IsLearner: isLearner,
 		// When a node is first added, we should mark it as recently active.
 		// Otherwise, CheckQuorum may cause us to step down if it is invoked
@@ -296,6 +336,15 @@ func checkInvariants(cfg tracker.Config, prs tracker.ProgressMap) error {
 		}
 	}
 
+	for id, md := range cfg.Metadata {
+		if _, ok := prs[id]; !ok {
+			return fmt.Errorf("metadata for %d, which has no progress", id)
+		}
+		if md.NodeID != id {
+			return fmt.Errorf("metadata for %d has node ID %d", id, md.NodeID)
+		}
+	}
+
 	// Any staged learner was staged because it could not be directly added due
 	// to a conflicting voter in the outgoing config.
 	for id := range cfg.LearnersNext {
@@ -0,0 +1,100 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+func TestMetadata(t *testing.T) {
+	trk := tracker.MakeProgressTracker(10, 0)
+	cfg, prs, err := Restore(Changer{Tracker: trk}, pb.ConfState{
+		Voters:   []uint64{1, 2, 3},
+		Metadata: []pb.NodeMetadata{{NodeID: 1, Address: "a1"}, {NodeID: 3, Address: "a3"}},
+	})
+	require.NoError(t, err)
+	trk.Config, trk.Progress = cfg, prs
+
+	md := func(addr string) *pb.NodeMetadata {
+		return &pb.NodeMetadata{Address: addr, Locality: "z-" + addr}
+	}
+	apply := func(joint bool, ccs ...pb.ConfChangeSingle) error {
+		chg := Changer{Tracker: trk}
+		var err error
+		if joint {
+			cfg, prs, err = chg.EnterJoint(false, ccs...)
+		} else {
+			cfg, prs, err = chg.Simple(ccs...)
+		}
+		if err == nil {
+			trk.Config, trk.Progress = cfg, prs
+		}
+		return err
+	}
+	addresses := func() map[uint64]string {
+		m := map[uint64]string{}
+		for id, md := range trk.Metadata {
+			require.Equal(t, id, md.NodeID)
+			m[id] = md.Address
+		}
+		return m
+	}
+
+	// Metadata is set when adding and updating nodes, and kept if absent.
+	require.NoError(t, apply(false,
+		pb.ConfChangeSingle{Type: pb.ConfChangeAddLearnerNode, NodeID: 4, Metadata: md("a4")},
+		pb.ConfChangeSingle{Type: pb.ConfChangeUpdateNode, NodeID: 1, Metadata: md("b1")},
+		pb.ConfChangeSingle{Type: pb.ConfChangeUpdateNode, NodeID: 3},
+	))
+	require.Equal(t, map[uint64]string{1: "b1", 3: "a3", 4: "a4"}, addresses())
+	require.Equal(t, "z-b1", trk.Metadata[1].Locality)
+
+	// Invalid changes.
+	require.ErrorContains(t, apply(false, pb.ConfChangeSingle{Type: pb.ConfChangeUpdateNode, NodeID: 5, Metadata: md("a5")}), "unknown node 5")
+	require.ErrorContains(t, apply(false, pb.ConfChangeSingle{Type: pb.ConfChangeRemoveNode, NodeID: 4, Metadata: md("a4")}), "removed node 4")
+	require.ErrorContains(t, apply(false, pb.ConfChangeSingle{Type: pb.ConfChangeUpdateNode, NodeID: 4, Metadata: &pb.NodeMetadata{NodeID: 5}}), "has node ID 5")
+	require.Equal(t, map[uint64]string{1: "b1", 3: "a3", 4: "a4"}, addresses())
+
+	// Demoting a voter keeps its metadata. Removing a voter in a joint config
+	// keeps it until the joint config is left.
+	require.NoError(t, apply(true,
+		pb.ConfChangeSingle{Type: pb.ConfChangeAddLearnerNode, NodeID: 1},
+		pb.ConfChangeSingle{Type: pb.ConfChangeRemoveNode, NodeID: 3},
+		pb.ConfChangeSingle{Type: pb.ConfChangeAddNode, NodeID: 4},
+	))
+	require.Equal(t, map[uint64]string{1: "b1", 3: "a3", 4: "a4"}, addresses())
+	cfg, prs, err = Changer{Tracker: trk}.LeaveJoint()
+	require.NoError(t, err)
+	trk.Config, trk.Progress = cfg, prs
+	require.Equal(t, map[uint64]string{1: "b1", 4: "a4"}, addresses())
+
+	// Removing a node drops its metadata.
+	require.NoError(t, apply(false, pb.ConfChangeSingle{Type: pb.ConfChangeRemoveNode, NodeID: 1}))
+	require.Equal(t, map[uint64]string{4: "a4"}, addresses())
+
+	// The metadata is part of the ConfState.
+	cs := trk.ConfState()
+	require.Equal(t, []pb.NodeMetadata{{NodeID: 4, Address: "a4", Locality: "z-a4"}}, cs.Metadata)
+	_, _, err = Restore(Changer{Tracker: tracker.MakeProgressTracker(10, 0)}, pb.ConfState{
+		Voters:   []uint64{1},
+		Metadata: []pb.NodeMetadata{{NodeID: 2}},
+	})
+	require.ErrorContains(t, err, "not in the config")
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confchange
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// PlanStep is a single configuration change of a plan computed by Plan.
+type PlanStep struct {
+	// ConfChange is the configuration change to propose. The previous step
+	// must have been applied before it is proposed.
+	ConfChange pb.ConfChangeV2
+	// CatchUp lists the learners that will become voters in this step. They
+	// should be caught up with the leader's log before the step is proposed,
+	// so that adding them does not hurt availability.
+	CatchUp []uint64
+	// ConfState is the configuration that results from applying the step. If
+	// the step enters a joint configuration that raft leaves automatically,
+	// this is the configuration after leaving it, and the next step should only
+	// be proposed once that has happened.
+	ConfState pb.ConfState
+}
+
+// Plan computes a sequence of configuration changes that takes the current
+// configuration to the target one, which must not be joint. The steps are:
+//
+//  1. leave the joint configuration, if the current one is joint;
+//  2. add all future voters that are not yet part of the configuration as
+//     learners, along with the future learners;
+//  3. change the voters, using joint consensus with an explicit transition
+//     if more than one voter changes. Voters that are to become learners are
+//     demoted, and all other nodes not part of the target configuration are
+//     removed;
+//  4. leave the joint configuration, if one was entered in step 3.
+//
+// Steps that would be empty are omitted. Steps 2 and 3 use
+// ConfChangeTransitionAuto unless noted otherwise, so raft may carry them out
+// in an automatically left joint configuration (see ConfChangeV2.EnterJoint).
+// Every step is validated against the configuration resulting from its
+// predecessors using a Changer, and the last step is verified to result in the
+// target configuration.
+func Plan(cur, target pb.ConfState) ([]PlanStep, error) {
+	if len(cur.Voters) == 0 {
+		return nil, errors.New("can't plan from a zero-voter config")
+	}
+	if len(target.Voters) == 0 {
+		return nil, errors.New("target config has no voters")
+	}
+	if len(target.VotersOutgoing) > 0 || len(target.LearnersNext) > 0 || target.AutoLeave {
+		return nil, errors.New("target config is joint")
+	}
+	tgtVoters, tgtLearners := idSet(target.Voters), idSet(target.Learners)
+	for id := range tgtLearners {
+		if _, ok := tgtVoters[id]; ok {
+			return nil, fmt.Errorf("%d is both voter and learner in target config", id)
+		}
+	}
+
+	trk := tracker.MakeProgressTracker(1, 0)
+	cfg, prs, err := Restore(Changer{Tracker: trk}, cur)
+	if err != nil {
+		return nil, err
+	}
+	trk.Config, trk.Progress = cfg, prs
+
+	var steps []PlanStep
+	add := func(cc pb.ConfChangeV2, catchUp []uint64) error {
+		chg := Changer{Tracker: trk}
+		var cfg tracker.Config
+		var prs tracker.ProgressMap
+		var err error
+		if cc.LeaveJoint() {
+			cfg, prs, err = chg.LeaveJoint()
+		} else if autoLeave, ok := cc.EnterJoint(); ok {
+			cfg, prs, err = chg.EnterJoint(autoLeave, cc.Changes...)
+			if err == nil && autoLeave {
+				trk.Config, trk.Progress = cfg, prs
+				cfg, prs, err = Changer{Tracker: trk}.LeaveJoint()
+			}
+		} else {
+			cfg, prs, err = chg.Simple(cc.Changes...)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", len(steps)+1, Describe(cc.Changes...), err)
+		}
+		trk.Config, trk.Progress = cfg, prs
+		steps = append(steps, PlanStep{ConfChange: cc, CatchUp: catchUp, ConfState: trk.ConfState()})
+		return nil
+	}
+
+	// Leave the current joint config.
+	if joint(trk.Config) {
+		if err := add(pb.ConfChangeV2{}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add the new nodes as learners.
+	var learners []pb.ConfChangeSingle
+	for _, id := range sortedIDs(tgtVoters, tgtLearners) {
+		if _, ok := trk.Progress[id]; !ok {
+			learners = append(learners, pb.ConfChangeSingle{Type: pb.ConfChangeAddLearnerNode, NodeID: id})
+		}
+	}
+	if len(learners) > 0 {
+		if err := add(pb.ConfChangeV2{Changes: learners}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Change the voters, demote and remove the rest.
+	var changes []pb.ConfChangeSingle
+	var catchUp []uint64
+	curVoters := incoming(trk.Voters)
+	for _, id := range sortedIDs(tgtVoters) {
+		if _, ok := curVoters[id]; !ok {
+			changes = append(changes, pb.ConfChangeSingle{Type: pb.ConfChangeAddNode, NodeID: id})
+			catchUp = append(catchUp, id)
+		}
+	}
+	nVoterChanges := len(changes)
+	for _, id := range trk.VoterNodes() {
+		if _, ok := tgtVoters[id]; ok {
+			continue
+		}
+		nVoterChanges++
+		if _, ok := tgtLearners[id]; ok {
+			changes = append(changes, pb.ConfChangeSingle{Type: pb.ConfChangeAddLearnerNode, NodeID: id})
+		} else {
+			changes = append(changes, pb.ConfChangeSingle{Type: pb.ConfChangeRemoveNode, NodeID: id})
+		}
+	}
+	for _, id := range trk.LearnerNodes() {
+		_, isVoter := tgtVoters[id]
+		_, isLearner := tgtLearners[id]
+		if !isVoter && !isLearner {
+			changes = append(changes, pb.ConfChangeSingle{Type: pb.ConfChangeRemoveNode, NodeID: id})
+		}
+	}
+	if len(changes) > 0 {
+		cc := pb.ConfChangeV2{Changes: changes}
+		if nVoterChanges > 1 {
+			cc.Transition = pb.ConfChangeTransitionJointExplicit
+		}
+		if err := add(cc, catchUp); err != nil {
+			return nil, err
+		}
+		if nVoterChanges > 1 {
+			if err := add(pb.ConfChangeV2{}, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := trk.ConfState().Equivalent(target); err != nil {
+		return nil, fmt.Errorf("plan does not result in target config: %w", err)
+	}
+	return steps, nil
+}
+
+func idSet(ids []uint64) map[uint64]struct{} {
+	m := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		m[id] = struct{}{}
+	}
+	return m
+}
+
+// sortedIDs returns the union of the given sets in ascending order.
+func sortedIDs(sets ...map[uint64]struct{}) []uint64 {
+	var ids []uint64
+	for _, m := range sets {
+		for id := range m {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confchange
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+func describePlan(steps []PlanStep) string {
+	var buf strings.Builder
+	for _, st := range steps {
+		cc := st.ConfChange
+		switch {
+		case cc.LeaveJoint():
+			buf.WriteString("leave-joint")
+		case cc.Transition == pb.ConfChangeTransitionJointExplicit:
+			fmt.Fprintf(&buf, "enter-joint %s", pb.ConfChangesToString(cc.Changes))
+		default:
+			buf.WriteString(pb.ConfChangesToString(cc.Changes))
+		}
+		if len(st.CatchUp) > 0 {
+			fmt.Fprintf(&buf, " catch-up=%v", st.CatchUp)
+		}
+		fmt.Fprintf(&buf, " -> %s\n", describeConfState(st.ConfState))
+	}
+	return buf.String()
+}
+
+func describeConfState(cs pb.ConfState) string {
+	cfg, _, err := Restore(Changer{Tracker: tracker.MakeProgressTracker(1, 0)}, cs)
+	if err != nil {
+		return err.Error()
+	}
+	return cfg.String()
+}
+
+func TestPlan(t *testing.T) {
+	ids := func(sl ...uint64) []uint64 {
+		return sl
+	}
+	for _, tt := range []struct {
+		cur, target pb.ConfState
+		exp         string
+	}{
+		{
+			cur:    pb.ConfState{Voters: ids(1, 2, 3)},
+			target: pb.ConfState{Voters: ids(1, 2, 3)},
+			exp:    "",
+		},
+		{
+			cur:    pb.ConfState{Voters: ids(1, 2, 3)},
+			target: pb.ConfState{Voters: ids(1, 2, 3, 4)},
+			exp: `l4 -> voters=(1 2 3) learners=(4)
+v4 catch-up=[4] -> voters=(1 2 3 4)
+`,
+		},
+		{
+			cur:    pb.ConfState{Voters: ids(1, 2, 3), Learners: ids(4)},
+			target: pb.ConfState{Voters: ids(1, 2), Learners: ids(3)},
+			exp: `l3 r4 -> voters=(1 2) learners=(3)
+`,
+		},
+		{
+			cur:    pb.ConfState{Voters: ids(1, 2, 3)},
+			target: pb.ConfState{Voters: ids(4, 5, 6), Learners: ids(1)},
+			exp: `l4 l5 l6 -> voters=(1 2 3) learners=(4 5 6)
+enter-joint v4 v5 v6 l1 r2 r3 catch-up=[4 5 6] -> voters=(4 5 6)&&(1 2 3) learners_next=(1)
+leave-joint -> voters=(4 5 6) learners=(1)
+`,
+		},
+		{
+			cur:    pb.ConfState{Voters: ids(1, 2), VotersOutgoing: ids(1, 3), LearnersNext: ids(3)},
+			target: pb.ConfState{Voters: ids(1, 2, 3)},
+			exp: `leave-joint -> voters=(1 2) learners=(3)
+v3 catch-up=[3] -> voters=(1 2 3)
+`,
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			steps, err := Plan(tt.cur, tt.target)
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, describePlan(steps))
+		})
+	}
+
+	for _, tt := range []struct {
+		cur, target pb.ConfState
+		err         string
+	}{
+		{pb.ConfState{}, pb.ConfState{Voters: ids(1)}, "zero-voter"},
+		{pb.ConfState{Voters: ids(1)}, pb.ConfState{}, "no voters"},
+		{pb.ConfState{Voters: ids(1)}, pb.ConfState{Voters: ids(1), VotersOutgoing: ids(2)}, "joint"},
+		{pb.ConfState{Voters: ids(1)}, pb.ConfState{Voters: ids(1), Learners: ids(1)}, "both voter and learner"},
+	} {
+		_, err := Plan(tt.cur, tt.target)
+		require.ErrorContains(t, err, tt.err)
+	}
+}
+
+// TestPlanQuick verifies that plans between random configurations are valid.
+// Plan validates each step and the final configuration itself.
+func TestPlanQuick(t *testing.T) {
+	cfg := quick.Config{MaxCount: 1000}
+	if err := quick.Check(func(cur, target rndConfChange) bool {
+		tgt := pb.ConfState{Voters: target.Voters, Learners: target.Learners}
+		steps, err := Plan(pb.ConfState(cur), tgt)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+		// Nodes only become voters after having been learners.
+		prev := pb.ConfState(cur)
+		for _, st := range steps {
+			for _, id := range st.CatchUp {
+				if !idIn(id, prev.Learners) && !idIn(id, prev.LearnersNext) {
+					t.Errorf("%d promoted without being a learner in %s:\n%s", id, describeConfState(prev), describePlan(steps))
+					return false
+				}
+			}
+			prev = st.ConfState
+		}
+		return true
+	}, &cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+func idIn(id uint64, ids []uint64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -15,6 +15,8 @@
 package confchange
 
 import (
+	"fmt"
+
 	pb "go.etcd.io/raft/v3/raftpb"
 	"go.etcd.io/raft/v3/tracker"
 )
@@ -23,6 +25,9 @@ import (
 // first the config that will become the outgoing one, and then the incoming one, and
 // b) another slice that, when applied to the config resulted from 1), represents the
 // ConfState.
+//
+// The metadata in the ConfState is attached to the operations adding the
+// respective nodes.
 func toConfChangeSingle(cs pb.ConfState) (out []pb.ConfChangeSingle, in []pb.ConfChangeSingle) {
 	// Example to follow along this code:
 	// voters=(1 2 3) learners=(5) outgoing=(1 2 4 6) learners_next=(4)
@@ -52,12 +57,18 @@ func toConfChangeSingle(cs pb.ConfState) (out []pb.ConfChangeSingle, in []pb.Con
 	//
 	// as desired.
 
+	md := map[uint64]*pb.NodeMetadata{}
+	for i := range cs.Metadata {
+		md[cs.Metadata[i].NodeID] = &cs.Metadata[i]
+	}
+
 	for _, id := range cs.VotersOutgoing {
 		// If there are outgoing voters, first add them one by one so that the
 		// (non-joint) config has them all.
 		out = append(out, pb.ConfChangeSingle{
-			Type:   pb.ConfChangeAddNode,
-			NodeID: id,
+			Type:     pb.ConfChangeAddNode,
+			NodeID:   id,
+			Metadata: md[id],
 		})
 
 	}
@@ -75,22 +86,25 @@ func toConfChangeSingle(cs pb.ConfState) (out []pb.ConfChangeSingle, in []pb.Con
 	// Then we'll add the incoming voters and learners.
 	for _, id := range cs.Voters {
 		in = append(in, pb.ConfChangeSingle{
-			Type:   pb.ConfChangeAddNode,
-			NodeID: id,
+			Type:     pb.ConfChangeAddNode,
+			NodeID:   id,
+			Metadata: md[id],
 		})
 	}
 	for _, id := range cs.Learners {
 		in = append(in, pb.ConfChangeSingle{
-			Type:   pb.ConfChangeAddLearnerNode,
-			NodeID: id,
+			Type:     pb.ConfChangeAddLearnerNode,
+			NodeID:   id,
+			Metadata: md[id],
 		})
 	}
 	// Same for LearnersNext; these are nodes we want to be learners but which
 	// are currently voters in the outgoing config.
 	for _, id := range cs.LearnersNext {
 		in = append(in, pb.ConfChangeSingle{
-			Type:   pb.ConfChangeAddLearnerNode,
-			NodeID: id,
+			Type:     pb.ConfChangeAddLearnerNode,
+			NodeID:   id,
+			Metadata: md[id],
 		})
 	}
 	return out, in
@@ -151,5 +165,14 @@ func Restore(chg Changer, cs pb.ConfState) (tracker.Config, tracker.ProgressMap,
 		})
 	}
 
-	return chain(chg, ops...)
+	cfg, prs, err := chain(chg, ops...)
+	if err != nil {
+		return tracker.Config{}, nil, err
+	}
+	for _, md := range cs.Metadata {
+		if _, ok := prs[md.NodeID]; !ok {
+			return tracker.Config{}, nil, fmt.Errorf("metadata for %d, which is not in the config", md.NodeID)
+		}
+	}
+	return cfg, prs, nil
 }
@@ -128,6 +128,11 @@ after:  %+#v`, cs, cs2)
 		{Voters: ids(1, 2, 3)},
 		{Voters: ids(1, 2, 3), Learners: ids(4, 5, 6)},
 		{Voters: ids(1, 2, 3), Learners: ids(5), VotersOutgoing: ids(1, 2, 4, 6), LearnersNext: ids(4)},
+		{Voters: ids(1, 2, 3), Learners: ids(5), VotersOutgoing: ids(1, 2, 4, 6), LearnersNext: ids(4), Metadata: []pb.NodeMetadata{
+			{NodeID: 1, Address: "a1", Locality: "z1"},
+			{NodeID: 5, Labels: map[string]string{"k": "v"}},
+			{NodeID: 6, Address: "a6", Flags: 1},
+		}},
 	} {
 		if !f(cs) {
 			t.FailNow() // f() already logged a nice t.Error()
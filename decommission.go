@@ -0,0 +1,288 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.etcd.io/raft/v3/quorum"
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+var (
+	// ErrNotInConfig is returned by RawNode.DecommissionNode if the given peer
+	// is not part of the configuration.
+	ErrNotInConfig = errors.New("raft: not part of the configuration")
+	// ErrFaultToleranceTooLow is returned by RawNode.DecommissionNode, and
+	// reported by a failed NodeDecommission, if removing the node would reduce
+	// the fault tolerance of the configuration below
+	// DecommissionOptions.MinFaultTolerance.
+	ErrFaultToleranceTooLow = errors.New("raft: removal would reduce fault tolerance below the minimum")
+	// ErrRemovalRejected is reported by a failed NodeDecommission if the
+	// removal was committed, but the node is still part of the configuration
+	// after its application, i.e. the application did not apply it.
+	ErrRemovalRejected = errors.New("raft: removal was not applied")
+)
+
+// DecommissionOptions configures the decommission of a node, see
+// RawNode.DecommissionNode.
+type DecommissionOptions struct {
+	// MinFaultTolerance is the number of voter failures that the configuration
+	// must tolerate after the removal, see quorum.JointConfig.FaultTolerance.
+	// The removal is refused if it would reduce the fault tolerance below this
+	// value; removals that don't reduce it, like those of learners, are always
+	// allowed.
+	MinFaultTolerance int
+	// StepDown configures the choice of the new leader if the node to
+	// decommission is the local node and the leader.
+	StepDown StepDownOptions
+	// Context is attached to the proposed ConfChangeV2.
+	Context []byte
+}
+
+// DecommissionState is the state of a NodeDecommission.
+type DecommissionState uint8
+
+const (
+	// DecommissionWaiting means that the removal has not been proposed yet,
+	// for example because the configuration is joint, another configuration
+	// change is pending, or no leader is known.
+	DecommissionWaiting DecommissionState = iota
+	// DecommissionTransferring means that the node to decommission is the
+	// local node and the leader, and is transferring its leadership away
+	// before its removal is proposed.
+	DecommissionTransferring
+	// DecommissionProposed means that the removal has been proposed and is
+	// waiting to be applied.
+	DecommissionProposed
+	// DecommissionSucceeded means that the node was removed from the
+	// configuration. If it is the local node, it can be stopped now.
+	DecommissionSucceeded
+	// DecommissionFailed means that the decommission was abandoned; see
+	// NodeDecommission.Err.
+	DecommissionFailed
+)
+
+var decommissionStateStrings = [...]string{
+	DecommissionWaiting:      "Waiting",
+	DecommissionTransferring: "Transferring",
+	DecommissionProposed:     "Proposed",
+	DecommissionSucceeded:    "Succeeded",
+	DecommissionFailed:       "Failed",
+}
+
+func (s DecommissionState) String() string {
+	if int(s) < len(decommissionStateStrings) {
+		return decommissionStateStrings[s]
+	}
+	return fmt.Sprintf("DecommissionState(%d)", s)
+}
+
+// NodeDecommission describes the decommission of a node.
+type NodeDecommission struct {
+	// ID is the node being decommissioned.
+	ID      uint64
+	Options DecommissionOptions
+	State   DecommissionState
+	// Index and Term identify the proposed ConfChangeV2 in
+	// DecommissionProposed. They are zero if the removal was forwarded to the
+	// leader.
+	Index, Term uint64
+	// ProposedTicks is the number of ticks since a forwarded removal was
+	// proposed. It is proposed again if the node is still part of the
+	// configuration after an election timeout.
+	ProposedTicks int
+	// Err is the reason for DecommissionFailed. In other states, it is the
+	// error of the last unsuccessful attempt to make progress, if any.
+	Err error
+}
+
+// DecommissionNode registers the given node for removal from the
+// configuration. This runs the steps of a graceful removal:
+//
+//  1. if the node is the local node and the leader, the leadership is
+//     transferred to another voter (see StepDown);
+//  2. a ConfChangeV2 removing the node is proposed, by the leader or, on a
+//     follower, via proposal forwarding;
+//  3. the removal is waited for to be applied.
+//
+// The removal is refused if it would reduce the fault tolerance of the
+// configuration below opts.MinFaultTolerance, which is checked both now and
+// before proposing. The progress is reported by NodeDecommission; once it is
+// DecommissionSucceeded, a decommissioned local node can be stopped.
+// Registering a node again replaces its decommission.
+func (rn *RawNode) DecommissionNode(id uint64, opts DecommissionOptions) error {
+	r := rn.raft
+	if r.prs.Progress[id] == nil {
+		return ErrNotInConfig
+	}
+	if !removalKeepsFaultTolerance(r.prs.Config, id, opts.MinFaultTolerance) {
+		return ErrFaultToleranceTooLow
+	}
+	if rn.decommissions == nil {
+		rn.decommissions = map[uint64]*NodeDecommission{}
+	}
+	rn.decommissions[id] = &NodeDecommission{ID: id, Options: opts}
+	rn.updateDecommission(rn.decommissions[id], false /* tick */)
+	return nil
+}
+
+// NodeDecommission returns the state of the decommission of the given node, if
+// it is registered.
+func (rn *RawNode) NodeDecommission(id uint64) (NodeDecommission, bool) {
+	d, ok := rn.decommissions[id]
+	if !ok {
+		return NodeDecommission{}, false
+	}
+	return *d, true
+}
+
+// CancelNodeDecommission unregisters the decommission of the given node. A
+// removal that was already proposed is not withdrawn.
+func (rn *RawNode) CancelNodeDecommission(id uint64) {
+	delete(rn.decommissions, id)
+}
+
+// removalKeepsFaultTolerance returns whether removing the given node from the
+// (non-joint) configuration keeps its fault tolerance at or above minFT, or at
+// least does not reduce it.
+func removalKeepsFaultTolerance(cfg tracker.Config, id uint64, minFT int) bool {
+	after := quorum.MajorityConfig{}
+	for vid := range cfg.Voters[0] {
+		if vid != id {
+			after[vid] = struct{}{}
+		}
+	}
+	ft := quorum.JointConfig{after, cfg.Voters[1]}.FaultTolerance()
+	return ft >= minFT || ft >= cfg.Voters.FaultTolerance()
+}
+
+// updateDecommissions advances the registered decommissions. If tick is true,
+// the ticks of forwarded removals are advanced.
+func (rn *RawNode) updateDecommissions(tick bool) {
+	if len(rn.decommissions) == 0 {
+		return
+	}
+	ids := make([]uint64, 0, len(rn.decommissions))
+	for id := range rn.decommissions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		rn.updateDecommission(rn.decommissions[id], tick)
+	}
+}
+
+func (rn *RawNode) updateDecommission(d *NodeDecommission, tick bool) {
+	r := rn.raft
+	if d.State == DecommissionSucceeded || d.State == DecommissionFailed {
+		return
+	}
+	if r.prs.Progress[d.ID] == nil {
+		d.State, d.Err = DecommissionSucceeded, nil
+		return
+	}
+
+	if d.State == DecommissionProposed {
+		if d.Index == 0 {
+			// The removal was forwarded. Propose it again if it doesn't take
+			// effect in time, for example because it was dropped.
+			if tick {
+				d.ProposedTicks++
+			}
+			if d.ProposedTicks < r.electionTimeout {
+				return
+			}
+		} else {
+			if r.raftLog.applied < d.Index {
+				return
+			}
+			if t, err := r.raftLog.term(d.Index); err == nil && t == d.Term {
+				d.State, d.Err = DecommissionFailed, ErrRemovalRejected
+				return
+			}
+		}
+		// The proposal was lost, for example in a leadership change. Start
+		// over.
+		d.State, d.Index, d.Term, d.ProposedTicks = DecommissionWaiting, 0, 0, 0
+	}
+
+	if d.State == DecommissionTransferring {
+		if r.state == StateLeader && r.leadTransferee != None {
+			return
+		}
+		// Either the transfer finished, or the local node is not the leader
+		// anymore. Carry on either way.
+		d.State = DecommissionWaiting
+	}
+
+	if len(r.prs.Voters[1]) > 0 {
+		// Wait for the joint configuration to be left.
+		return
+	}
+	if !removalKeepsFaultTolerance(r.prs.Config, d.ID, d.Options.MinFaultTolerance) {
+		d.State, d.Err = DecommissionFailed, ErrFaultToleranceTooLow
+		return
+	}
+
+	if r.state == StateLeader && d.ID == r.id {
+		if len(r.prs.Voters[0]) == 1 {
+			// There is no one to transfer the leadership to, so the removal
+			// would fail anyway.
+			d.State, d.Err = DecommissionFailed, ErrFaultToleranceTooLow
+			return
+		}
+		to := r.stepDownCandidate(d.Options.StepDown)
+		if to == None {
+			d.Err = ErrNoTransferCandidate
+			return
+		}
+		r.logger.Infof("%x transferring leadership to %x before decommissioning itself", r.id, to)
+		_ = r.Step(pb.Message{Type: pb.MsgTransferLeader, From: to})
+		d.State, d.Err = DecommissionTransferring, nil
+		return
+	}
+	if r.state != StateLeader && r.lead == None {
+		return
+	}
+
+	cc := pb.ConfChangeV2{
+		Changes: []pb.ConfChangeSingle{{Type: pb.ConfChangeRemoveNode, NodeID: d.ID}},
+		Context: d.Options.Context,
+	}
+	m, err := confChangeToMsg(cc)
+	if err != nil {
+		d.State, d.Err = DecommissionFailed, err
+		return
+	}
+	if err := r.Step(m); err != nil {
+		d.Err = err
+		return
+	}
+	d.State, d.Err = DecommissionProposed, nil
+	if r.state != StateLeader {
+		r.logger.Infof("%x forwarded removal of %x to leader %x", r.id, d.ID, r.lead)
+		return
+	}
+	if res := proposalResults([]pb.Entry{{Type: pb.EntryConfChangeV2}}, m.Entries)[0]; res.Err != nil {
+		d.State, d.Err = DecommissionWaiting, res.Err
+		return
+	}
+	d.Index, d.Term = m.Entries[0].Index, m.Entries[0].Term
+	r.logger.Infof("%x proposed removal of %x at index %d", r.id, d.ID, d.Index)
+}
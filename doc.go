@@ -384,6 +384,17 @@ stale log entries:
 	indicating 'MsgApp' is lost. When follower's progress state is replicate,
 	the leader sets it back to probe.
 
+	'MsgDelegateApp' is sent by the leader to a follower to which it delegates
+	the catch-up of a lagging follower (see Config.ReplicationDelegate). It
+	carries, in its responses, the 'MsgApp' (or 'MsgSnap') the leader would
+	have sent to the lagging follower, and in its index the last entry to
+	send. The delegate sends the entries from its own log on the leader's
+	behalf, so the lagging follower's 'MsgAppResp' goes to the leader.
+
+	'MsgDelegateAppResp' is sent by a delegate that is unable to serve a
+	'MsgDelegateApp'. The leader then replicates to the lagging follower
+	directly.
+
 	'MsgStorageAppend' is a message from a node to its local append storage
 	thread to write entries, hard state, and/or a snapshot to stable storage.
 	The message will carry one or more responses, one of which will be a
@@ -395,5 +406,16 @@ stale log entries:
 	thread to apply committed entries. The message will carry one response,
 	which will be a 'MsgStorageApplyResp' back to itself. Used with
 	AsynchronousStorageWrites.
+
+	'MsgStorageFetch' is a message from the leader to its local fetch thread
+	to read the log entries that a follower needs from stable storage. The
+	thread responds with a 'MsgStorageFetchResp' carrying the entries, see
+	FetchEntries, upon which the leader sends them in a 'MsgApp'. Used with
+	AsyncStorageReads.
+
+	'MsgStorageSnapshot' is a message from the leader to its local snapshot
+	thread to generate a snapshot for a follower. The thread delivers the
+	snapshot with RawNode.SnapshotReady, upon which the leader sends it in a
+	'MsgSnap'. Used with AsyncSnapshots.
 */
 package raft
@@ -0,0 +1,115 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"errors"
+	"sort"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// errEntriesNotFetched is returned by raftLog.entriesOrFetch if the entries
+// have to be fetched from Storage first.
+var errEntriesNotFetched = errors.New("raft: entries not fetched")
+
+// FetchEntries serves a MsgStorageFetch message, see Config.AsyncStorageReads.
+// It reads the requested entries from the given Storage, and returns the
+// MsgStorageFetchResp to step into the local node. If the read fails, the
+// returned response is a rejection, which should be stepped too, and the error
+// is returned along with it.
+//
+// A MsgStorageFetch requests the entries in [Index, Commit), limited to a
+// total size of RejectHint like Storage.Entries.
+func FetchEntries(s Storage, m pb.Message) (pb.Message, error) {
+	resp := pb.Message{
+		Type:  pb.MsgStorageFetchResp,
+		To:    m.From,
+		From:  LocalFetchThread,
+		Term:  m.Term,
+		Index: m.Index,
+	}
+	ents, err := s.Entries(m.Index, m.Commit, m.RejectHint)
+	if err != nil {
+		resp.Reject = true
+		return resp, err
+	}
+	resp.Entries = ents
+	return resp, nil
+}
+
+// fetchEntries requests the entries that the given follower needs, starting
+// at index lo, from the LocalFetchThread, unless they have been requested
+// already. The follower is sent a MsgApp when they arrive.
+func (r *raft) fetchEntries(to, lo uint64) {
+	if _, ok := r.fetches[to]; ok {
+		return
+	}
+	requested := false
+	for _, i := range r.fetches {
+		if i == lo {
+			requested = true
+			break
+		}
+	}
+	if r.fetches == nil {
+		r.fetches = map[uint64]uint64{}
+	}
+	r.fetches[to] = lo
+	if requested {
+		return
+	}
+	hi := r.raftLog.unstable.offset
+	r.logger.Debugf("%x fetching entries [%d, %d) for %x", r.id, lo, hi, to)
+	r.send(pb.Message{
+		To:         LocalFetchThread,
+		Type:       pb.MsgStorageFetch,
+		Index:      lo,
+		Commit:     hi,
+		RejectHint: uint64(r.maxMsgSize),
+	})
+}
+
+// handleStorageFetchResp makes the fetched entries available to the log, and
+// sends them to the followers that waited for them.
+func (r *raft) handleStorageFetchResp(m pb.Message) {
+	if m.Reject {
+		// The followers are retried on the next heartbeat response. By then,
+		// the log may have been compacted, in which case they are sent a
+		// snapshot.
+		r.logger.Warningf("%x failed to fetch entries from index %d", r.id, m.Index)
+	} else if ents := r.raftLog.verifyStored(m.Entries); len(ents) > 0 && ents[0].Index == m.Index {
+		// The entries may have been overwritten since they were requested. By
+		// the Log Matching Property, it suffices to check the last one.
+		if last := ents[len(ents)-1]; r.raftLog.matchTerm(last.Index, last.Term) {
+			r.raftLog.fetched.reset()
+			r.raftLog.fetched.add(ents)
+		}
+	}
+
+	var ids []uint64
+	for id, lo := range r.fetches {
+		if lo == m.Index {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		delete(r.fetches, id)
+		if !m.Reject && r.state == StateLeader && r.prs.Progress[id] != nil {
+			r.sendAppend(id)
+		}
+	}
+}
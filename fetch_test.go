@@ -0,0 +1,120 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// TestAsyncStorageReads tests that, with AsyncStorageReads, the leader fetches
+// the entries that lagging followers need from Storage via MsgStorageFetch,
+// and sends them once the MsgStorageFetchResp arrives.
+func TestAsyncStorageReads(t *testing.T) {
+	storage := newTestMemoryStorage(withPeers(1, 2, 3))
+	require.NoError(t, storage.Append(cacheTestEntries(1, 11, 1)))
+	require.NoError(t, storage.SetHardState(pb.HardState{Term: 1, Commit: 10}))
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.AsyncStorageReads = true
+	rn, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	r := rn.raft
+	r.becomeCandidate()
+	r.becomeLeader()
+	r.readMessages()
+
+	// Both followers need the entries from index 6 on, which are only in
+	// Storage. They share a single fetch, and Storage is not read.
+	reads := storage.callStats.entries
+	reject := func(from uint64) {
+		require.NoError(t, rn.Step(pb.Message{From: from, To: 1, Term: r.Term, Type: pb.MsgAppResp,
+			Index: 10, Reject: true, RejectHint: 5, LogTerm: 1}))
+	}
+	reject(2)
+	reject(3)
+	require.Equal(t, reads, storage.callStats.entries)
+	msgs := r.readMessages()
+	require.Equal(t, []pb.Message{{
+		Type: pb.MsgStorageFetch, To: LocalFetchThread, From: 1, Term: r.Term,
+		Index: 6, Commit: 11, RejectHint: uint64(r.maxMsgSize),
+	}}, msgs)
+	fetch := msgs[0]
+
+	// Heartbeat responses don't fetch the entries again.
+	require.NoError(t, rn.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgHeartbeatResp}))
+	require.Empty(t, r.readMessages())
+
+	// A failed fetch is retried on the next heartbeat response.
+	require.NoError(t, rn.Step(pb.Message{From: LocalFetchThread, To: 1, Term: r.Term,
+		Type: pb.MsgStorageFetchResp, Index: 6, Reject: true}))
+	require.Empty(t, r.readMessages())
+	require.NoError(t, rn.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgHeartbeatResp}))
+	require.Equal(t, []pb.Message{fetch}, r.readMessages())
+	require.NoError(t, rn.Step(pb.Message{From: 3, To: 1, Term: r.Term, Type: pb.MsgHeartbeatResp}))
+	require.Empty(t, r.readMessages())
+
+	resp, err := FetchEntries(storage, fetch)
+	require.NoError(t, err)
+	require.NoError(t, rn.Step(resp))
+	require.Equal(t, reads+1, storage.callStats.entries)
+	msgs = r.readMessages()
+	require.Len(t, msgs, 2)
+	for i, m := range msgs {
+		require.Equal(t, pb.MsgApp, m.Type)
+		require.Equal(t, uint64(i+2), m.To)
+		require.Equal(t, uint64(5), m.Index)
+		require.Equal(t, uint64(1), m.LogTerm)
+		require.Len(t, m.Entries, 6)
+		require.Equal(t, uint64(6), m.Entries[0].Index)
+	}
+
+	// The fetched entries are retained for further MsgApps.
+	require.NoError(t, rn.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgAppResp, Index: 7}))
+	msgs = r.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgApp, msgs[0].Type)
+	require.Equal(t, uint64(8), msgs[0].Entries[0].Index)
+	require.Equal(t, reads+1, storage.callStats.entries)
+}
+
+// TestAsyncStorageReadsStale tests that fetched entries that were overwritten
+// in the meantime are not used.
+func TestAsyncStorageReadsStale(t *testing.T) {
+	storage := newTestMemoryStorage(withPeers(1, 2))
+	require.NoError(t, storage.Append(cacheTestEntries(1, 6, 1)))
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.AsyncStorageReads = true
+	r := newRaft(cfg)
+	r.becomeCandidate()
+	r.becomeLeader()
+	r.readMessages()
+
+	require.NoError(t, r.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgAppResp,
+		Index: 5, Reject: true, RejectHint: 2, LogTerm: 1}))
+	msgs := r.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgStorageFetch, msgs[0].Type)
+
+	// The response carries entries from another term.
+	resp := pb.Message{From: LocalFetchThread, To: 1, Term: r.Term, Type: pb.MsgStorageFetchResp,
+		Index: 3, Entries: cacheTestEntries(3, 6, 7)}
+	require.NoError(t, r.Step(resp))
+	require.Empty(t, r.raftLog.fetched.ents)
+	// The follower is fetched for again.
+	require.Equal(t, msgs, r.readMessages())
+}
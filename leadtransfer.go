@@ -0,0 +1,211 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrNotLeader is returned by RawNode.StepDown if the local node is not the
+	// leader.
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrNoTransferCandidate is returned by RawNode.StepDown if no voter is
+	// eligible to take over the leadership.
+	ErrNoTransferCandidate = errors.New("raft: no candidate for leadership transfer")
+)
+
+// LeaderTransferResult is the outcome of a leadership transfer.
+type LeaderTransferResult uint8
+
+const (
+	// LeaderTransferInProgress means that the transfer has not completed yet.
+	// This includes the time after the old leader stepped down and before it
+	// learned who the new leader is.
+	LeaderTransferInProgress LeaderTransferResult = iota
+	// LeaderTransferSucceeded means that the transferee became the leader, or
+	// that it already was.
+	LeaderTransferSucceeded
+	// LeaderTransferTimedOut means that the transferee was caught up, but did
+	// not take over within an election timeout.
+	LeaderTransferTimedOut
+	// LeaderTransferNotVoter means that the transferee is not a voter, or
+	// stopped being one during the transfer.
+	LeaderTransferNotVoter
+	// LeaderTransferNotCaughtUp means that the transferee's log did not catch up
+	// with the leader's within an election timeout.
+	LeaderTransferNotCaughtUp
+	// LeaderTransferAborted means that the transfer was superseded by a transfer
+	// to another node, or that a node other than the transferee became leader.
+	LeaderTransferAborted
+	// LeaderTransferNotLeader means that the local node was not the leader. The
+	// request was forwarded to the leader, if known, but its outcome is not
+	// tracked. Only reported by Node.TransferLeadership and Node.StepDown.
+	LeaderTransferNotLeader
+	// LeaderTransferNoCandidate means that no voter was eligible to take over
+	// the leadership. Only reported by Node.StepDown.
+	LeaderTransferNoCandidate
+)
+
+var leaderTransferResultStrings = [...]string{
+	LeaderTransferInProgress:  "InProgress",
+	LeaderTransferSucceeded:   "Succeeded",
+	LeaderTransferTimedOut:    "TimedOut",
+	LeaderTransferNotVoter:    "NotVoter",
+	LeaderTransferNotCaughtUp: "NotCaughtUp",
+	LeaderTransferAborted:     "Aborted",
+	LeaderTransferNotLeader:   "NotLeader",
+	LeaderTransferNoCandidate: "NoCandidate",
+}
+
+func (r LeaderTransferResult) String() string {
+	if int(r) < len(leaderTransferResultStrings) {
+		return leaderTransferResultStrings[r]
+	}
+	return fmt.Sprintf("LeaderTransferResult(%d)", r)
+}
+
+// LeaderTransfer describes the last leadership transfer handled by the local
+// node while it was the leader. The zero value means that there was none.
+type LeaderTransfer struct {
+	Transferee uint64
+	Result     LeaderTransferResult
+}
+
+// LeaderTransfer returns the last leadership transfer handled by the local
+// node, see TransferLeader.
+func (rn *RawNode) LeaderTransfer() LeaderTransfer {
+	return rn.raft.leadTransfer
+}
+
+// StepDownOptions configures the choice of the transferee by StepDown.
+type StepDownOptions struct {
+	// Priority, if set, ranks the eligible voters; voters with a higher
+	// priority are preferred. Voters with a negative priority are never
+	// chosen.
+	Priority func(id uint64) int
+	// Locality, if not empty, prefers voters whose pb.NodeMetadata.Locality
+	// matches it over those with a higher Match. Priority takes precedence.
+	Locality string
+}
+
+// StepDown transfers the leadership to the voter best suited to take over,
+// and returns its ID. Only voters of the incoming configuration that have
+// recently been active are eligible. Among these, the voter with the highest
+// priority, then the one in the preferred locality, then the one with the
+// highest Match is chosen, see StepDownOptions. The transferee is caught up
+// and then told to campaign, like for TransferLeader; the outcome is reported
+// by LeaderTransfer.
+func (rn *RawNode) StepDown(opts StepDownOptions) (uint64, error) {
+	r := rn.raft
+	if r.state != StateLeader {
+		return None, ErrNotLeader
+	}
+	id := r.stepDownCandidate(opts)
+	if id == None {
+		return None, ErrNoTransferCandidate
+	}
+	rn.TransferLeader(id)
+	return id, nil
+}
+
+// stepDownCandidate returns the voter that StepDown transfers the leadership
+// to, or None if there is none.
+func (r *raft) stepDownCandidate(opts StepDownOptions) uint64 {
+	type candidate struct {
+		id, match uint64
+		priority  int
+		local     bool
+	}
+	var cands []candidate
+	for id := range r.prs.Voters[0] {
+		pr := r.prs.Progress[id]
+		if id == r.id || pr == nil || pr.IsLearner || !pr.RecentActive {
+			continue
+		}
+		c := candidate{id: id, match: pr.Match}
+		if opts.Priority != nil {
+			if c.priority = opts.Priority(id); c.priority < 0 {
+				continue
+			}
+		}
+		if opts.Locality != "" {
+			c.local = r.prs.Metadata[id].Locality == opts.Locality
+		}
+		cands = append(cands, c)
+	}
+	if len(cands) == 0 {
+		return None
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		switch {
+		case a.priority != b.priority:
+			return a.priority > b.priority
+		case a.local != b.local:
+			return a.local
+		case a.match != b.match:
+			return a.match > b.match
+		}
+		return a.id < b.id
+	})
+	return cands[0].id
+}
+
+// startLeaderTransfer records a new leadership transfer to the given node.
+func (r *raft) startLeaderTransfer(to uint64) {
+	r.leadTransferSeq++
+	r.leadTransfer = LeaderTransfer{Transferee: to, Result: LeaderTransferInProgress}
+}
+
+// finishLeaderTransfer records the outcome of the current leadership transfer,
+// unless it already has one.
+func (r *raft) finishLeaderTransfer(res LeaderTransferResult) {
+	lt := &r.leadTransfer
+	if lt.Transferee == None || lt.Result != LeaderTransferInProgress {
+		return
+	}
+	lt.Result = res
+	r.logger.Infof("%x [term %d] transfer leadership to %x finished: %s", r.id, r.Term, lt.Transferee, res)
+}
+
+// maybeResolveLeaderTransfer decides the outcome of a leadership transfer
+// during which the local node stepped down, once it is known who won the
+// subsequent election.
+func (r *raft) maybeResolveLeaderTransfer() {
+	lt := r.leadTransfer
+	if lt.Transferee == None || lt.Result != LeaderTransferInProgress || r.leadTransferee != None {
+		return
+	}
+	switch {
+	case r.state != StateFollower:
+		r.finishLeaderTransfer(LeaderTransferAborted)
+	case r.lead == lt.Transferee:
+		r.finishLeaderTransfer(LeaderTransferSucceeded)
+	case r.lead != None:
+		r.finishLeaderTransfer(LeaderTransferAborted)
+	}
+}
+
+// leaderTransferResult returns the outcome of the leadership transfer with the
+// given sequence number.
+func (r *raft) leaderTransferResult(seq uint64) LeaderTransferResult {
+	if seq != r.leadTransferSeq {
+		return LeaderTransferAborted
+	}
+	return r.leadTransfer.Result
+}
@@ -29,6 +29,18 @@ type raftLog struct {
 	// they will be saved into storage.
 	unstable unstable
 
+	// cache contains the most recent stable entries, if enabled.
+	cache entryCache
+	// fetched contains the stable entries read by the last MsgStorageFetch,
+	// see Config.AsyncStorageReads.
+	fetched entryCache
+
+	// checksums enables the verification of entry checksums, see
+	// Config.EntryChecksums. corruption is set once a corrupted entry is
+	// found in Storage.
+	checksums  bool
+	corruption *EntryCorruptionError
+
 	// committed is the highest log position that is known to be in
 	// stable storage on a quorum of nodes.
 	committed uint64
@@ -135,6 +147,8 @@ func (l *raftLog) append(ents ...pb.Entry) uint64 {
 	if after := ents[0].Index - 1; after < l.committed {
 		l.logger.Panicf("after(%d) is out of range [committed(%d)]", after, l.committed)
 	}
+	l.cache.truncateFrom(ents[0].Index)
+	l.fetched.truncateFrom(ents[0].Index)
 	l.unstable.truncateAndAppend(ents)
 	return l.lastIndex()
 }
@@ -360,7 +374,13 @@ func (l *raftLog) acceptApplying(i uint64, size entryEncodingSize, allowUnstable
 		i < l.maxAppliableIndex(allowUnstable)
 }
 
-func (l *raftLog) stableTo(i, t uint64) { l.unstable.stableTo(i, t) }
+func (l *raftLog) stableTo(i, t uint64) {
+	offset, ents := l.unstable.offset, l.unstable.entries
+	l.unstable.stableTo(i, t)
+	if n := l.unstable.offset - offset; n > 0 {
+		l.cache.add(ents[:n])
+	}
+}
 
 func (l *raftLog) stableSnapTo(i uint64) { l.unstable.stableSnapTo(i) }
 
@@ -395,6 +415,11 @@ func (l *raftLog) term(i uint64) (uint64, error) {
 	if i > l.lastIndex() {
 		return 0, ErrUnavailable
 	}
+	if l.cache.maxSize > 0 {
+		if t, ok := l.cache.term(i); ok {
+			return t, nil
+		}
+	}
 
 	t, err := l.storage.Term(i)
 	if err == nil {
@@ -413,6 +438,16 @@ func (l *raftLog) entries(i uint64, maxSize entryEncodingSize) ([]pb.Entry, erro
 	return l.slice(i, l.lastIndex()+1, maxSize)
 }
 
+// entriesOrFetch is like entries, but returns errEntriesNotFetched instead of
+// reading the first entry from Storage if it is neither cached nor fetched.
+func (l *raftLog) entriesOrFetch(i uint64, maxSize entryEncodingSize) ([]pb.Entry, error) {
+	if i < l.unstable.offset && i >= l.firstIndex() &&
+		!l.fetched.covers(i, i+1) && !l.cache.covers(i, l.unstable.offset) {
+		return nil, errEntriesNotFetched
+	}
+	return l.entries(i, maxSize)
+}
+
 // allEntries returns all entries in the log.
 func (l *raftLog) allEntries() []pb.Entry {
 	ents, err := l.entries(l.firstIndex(), noLimit)
@@ -458,6 +493,8 @@ func (l *raftLog) maybeCommit(maxIndex, term uint64) bool {
 func (l *raftLog) restore(s pb.Snapshot) {
 	l.logger.Infof("log [%s] starts to restore snapshot [index: %d, term: %d]", l, s.Metadata.Index, s.Metadata.Term)
 	l.committed = s.Metadata.Index
+	l.cache.reset()
+	l.fetched.reset()
 	l.unstable.restore(s)
 }
 
@@ -503,7 +540,7 @@ func (l *raftLog) slice(lo, hi uint64, maxSize entryEncodingSize) ([]pb.Entry, e
 	}
 
 	cut := min(hi, l.unstable.offset)
-	ents, err := l.storage.Entries(lo, cut, uint64(maxSize))
+	ents, err := l.storageEntries(lo, cut, maxSize)
 	if err == ErrCompacted {
 		return nil, err
 	} else if err == ErrUnavailable {
@@ -539,6 +576,26 @@ func (l *raftLog) slice(lo, hi uint64, maxSize entryEncodingSize) ([]pb.Entry, e
 	return extend(ents, unstable), nil
 }
 
+// storageEntries returns the stable entries in [lo, hi), from the cache or
+// the fetched entries if possible. The latter may be only a prefix of the
+// requested entries.
+func (l *raftLog) storageEntries(lo, hi uint64, maxSize entryEncodingSize) ([]pb.Entry, error) {
+	if l.cache.maxSize > 0 {
+		if ents, ok := l.cache.slice(lo, hi, maxSize); ok {
+			return ents, nil
+		}
+	}
+	if l.fetched.covers(lo, lo+1) {
+		ents, _ := l.fetched.prefix(lo, hi, maxSize)
+		return ents, nil
+	}
+	ents, err := l.storage.Entries(lo, hi, uint64(maxSize))
+	if err != nil {
+		return nil, err
+	}
+	return l.verifyStored(ents), nil
+}
+
 // l.firstIndex <= lo <= hi <= l.firstIndex + len(l.entries)
 func (l *raftLog) mustCheckOutOfBounds(lo, hi uint64) error {
 	if lo > hi {
@@ -0,0 +1,147 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import pb "go.etcd.io/raft/v3/raftpb"
+
+// EntryCacheStats describes the entry cache of a raft log, see
+// Config.MaxEntryCacheSize.
+type EntryCacheStats struct {
+	// Entries and Bytes are the number and the size of the cached entries.
+	Entries int
+	Bytes   uint64
+	// Hits and Misses count the lookups of stable entries and terms that were
+	// served from the cache, and those that fell through to Storage.
+	Hits, Misses uint64
+}
+
+// entryCache caches the most recent entries that became stable, up to a total
+// size, so that raftLog can serve them without accessing Storage. This helps
+// when catching up followers whose logs lag behind, particularly with a
+// disk-based Storage.
+//
+// The cached entries are consecutive, and the cache is kept consistent with
+// the stable log by truncating it whenever the log is.
+type entryCache struct {
+	// ents[i] has raft log position i+ents[0].Index.
+	ents    []pb.Entry
+	size    entryEncodingSize
+	maxSize entryEncodingSize
+
+	hits, misses uint64
+}
+
+// add adds the given consecutive entries, which just became stable, evicting
+// the oldest entries as needed.
+func (c *entryCache) add(ents []pb.Entry) {
+	if c.maxSize == 0 || len(ents) == 0 {
+		return
+	}
+	if len(c.ents) > 0 {
+		if last := c.ents[len(c.ents)-1].Index; ents[0].Index <= last {
+			c.truncateFrom(ents[0].Index)
+		} else if ents[0].Index > last+1 {
+			c.reset()
+		}
+	}
+	c.ents = append(c.ents, ents...)
+	c.size += entsSize(ents)
+	c.evict()
+}
+
+// evict evicts the oldest entries until the cache fits its maximum size.
+func (c *entryCache) evict() {
+	i := 0
+	for ; i < len(c.ents) && c.size > c.maxSize; i++ {
+		c.size -= entryEncodingSize(c.ents[i].Size())
+	}
+	if i == 0 {
+		return
+	}
+	c.ents = c.ents[i:]
+	// Like unstable.shrinkEntriesArray, don't hold on to a mostly unused array.
+	if len(c.ents) == 0 {
+		c.ents = nil
+	} else if len(c.ents)*2 < cap(c.ents) {
+		c.ents = append([]pb.Entry(nil), c.ents...)
+	}
+}
+
+// truncateFrom removes the cached entries at index i and above, as the log is
+// being overwritten from index i.
+func (c *entryCache) truncateFrom(i uint64) {
+	if len(c.ents) == 0 || i > c.ents[len(c.ents)-1].Index {
+		return
+	}
+	if i <= c.ents[0].Index {
+		c.reset()
+		return
+	}
+	n := i - c.ents[0].Index
+	c.size -= entsSize(c.ents[n:])
+	// NB: full slice expression makes sure that the evicted entries, which may
+	// still be referenced by slices returned from slice(), are not overwritten
+	// by future appends.
+	c.ents = c.ents[:n:n]
+}
+
+// reset empties the cache.
+func (c *entryCache) reset() {
+	c.ents, c.size = nil, 0
+}
+
+// covers returns whether the entries in [lo, hi) are all cached.
+func (c *entryCache) covers(lo, hi uint64) bool {
+	return len(c.ents) > 0 && lo >= c.ents[0].Index && hi <= c.ents[len(c.ents)-1].Index+1
+}
+
+// prefix is like slice, but returns the cached entries in [lo, hi) that
+// start at lo even if the ones at the end are not cached.
+func (c *entryCache) prefix(lo, hi uint64, maxSize entryEncodingSize) ([]pb.Entry, bool) {
+	if len(c.ents) > 0 {
+		hi = min(hi, c.ents[len(c.ents)-1].Index+1)
+	}
+	return c.slice(lo, hi, maxSize)
+}
+
+// slice returns the entries in [lo, hi), limited to maxSize like limitSize, if
+// they are all cached. Counts a hit or a miss.
+func (c *entryCache) slice(lo, hi uint64, maxSize entryEncodingSize) ([]pb.Entry, bool) {
+	if len(c.ents) == 0 || lo < c.ents[0].Index || hi > c.ents[len(c.ents)-1].Index+1 {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	first := c.ents[0].Index
+	ents := limitSize(c.ents[lo-first:hi-first], maxSize)
+	// NB: use the full slice expression to protect the cache from appends to
+	// the returned slice.
+	return ents[:len(ents):len(ents)], true
+}
+
+// term returns the term of the entry at index i, if it is cached. Counts a
+// hit or a miss.
+func (c *entryCache) term(i uint64) (uint64, bool) {
+	if len(c.ents) == 0 || i < c.ents[0].Index || i > c.ents[len(c.ents)-1].Index {
+		c.misses++
+		return 0, false
+	}
+	c.hits++
+	return c.ents[i-c.ents[0].Index].Term, true
+}
+
+func (c *entryCache) stats() EntryCacheStats {
+	return EntryCacheStats{Entries: len(c.ents), Bytes: uint64(c.size), Hits: c.hits, Misses: c.misses}
+}
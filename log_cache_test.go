@@ -0,0 +1,112 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func cacheTestEntries(lo, hi, term uint64) []pb.Entry {
+	var ents []pb.Entry
+	for i := lo; i < hi; i++ {
+		ents = append(ents, pb.Entry{Index: i, Term: term, Data: []byte("data")})
+	}
+	return ents
+}
+
+func TestEntryCache(t *testing.T) {
+	entSize := entryEncodingSize((&pb.Entry{Index: 1, Term: 1, Data: []byte("data")}).Size())
+	c := entryCache{maxSize: 3 * entSize}
+
+	c.add(cacheTestEntries(1, 3, 1))
+	require.Equal(t, EntryCacheStats{Entries: 2, Bytes: uint64(2 * entSize)}, c.stats())
+	ents, ok := c.slice(1, 3, noLimit)
+	require.True(t, ok)
+	require.Equal(t, cacheTestEntries(1, 3, 1), ents)
+
+	// The oldest entry is evicted.
+	c.add(cacheTestEntries(3, 5, 1))
+	require.Equal(t, uint64(2), c.ents[0].Index)
+	_, ok = c.slice(1, 3, noLimit)
+	require.False(t, ok)
+	ents, ok = c.slice(2, 5, entSize)
+	require.True(t, ok)
+	require.Equal(t, cacheTestEntries(2, 3, 1), ents)
+	_, ok = c.term(5)
+	require.False(t, ok)
+	term, ok := c.term(4)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), term)
+
+	// Appends to returned slices don't corrupt the cache.
+	_ = append(ents, pb.Entry{Index: 3, Term: 9})
+	term, _ = c.term(3)
+	require.Equal(t, uint64(1), term)
+
+	// Overwriting entries truncates the cache.
+	c.add(cacheTestEntries(4, 5, 2))
+	require.Equal(t, 3, len(c.ents))
+	term, _ = c.term(4)
+	require.Equal(t, uint64(2), term)
+	c.truncateFrom(3)
+	require.Equal(t, EntryCacheStats{Entries: 1, Bytes: uint64(entSize), Hits: 5, Misses: 2}, c.stats())
+
+	// A gap resets the cache.
+	c.add(cacheTestEntries(7, 8, 2))
+	require.Equal(t, uint64(7), c.ents[0].Index)
+	require.Len(t, c.ents, 1)
+}
+
+// TestRaftLogEntryCache verifies that raftLog serves stable entries from the
+// cache without accessing Storage.
+func TestRaftLogEntryCache(t *testing.T) {
+	storage := NewMemoryStorage()
+	l := newLog(storage, raftLogger)
+	l.cache.maxSize = noLimit
+
+	l.append(cacheTestEntries(1, 6, 1)...)
+	require.NoError(t, storage.Append(l.nextUnstableEnts()))
+	l.stableTo(5, 1)
+	require.Equal(t, 5, l.cache.stats().Entries)
+
+	calls := storage.callStats
+	ents, err := l.slice(2, 6, noLimit)
+	require.NoError(t, err)
+	require.Equal(t, cacheTestEntries(2, 6, 1), ents)
+	term, err := l.term(3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), term)
+	require.Equal(t, calls.entries, storage.callStats.entries)
+	require.Equal(t, calls.term, storage.callStats.term)
+	require.Equal(t, uint64(2), l.cache.stats().Hits)
+
+	// A conflicting append truncates the cache, so that the overwritten
+	// entries are not served from it.
+	l.append(cacheTestEntries(4, 5, 2)...)
+	require.Equal(t, 3, l.cache.stats().Entries)
+	require.NoError(t, storage.Append(l.nextUnstableEnts()))
+	l.stableTo(4, 2)
+	term, err = l.term(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), term)
+
+	// Restoring a snapshot empties the cache.
+	l.restore(pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 10, Term: 3}})
+	require.Zero(t, l.cache.stats().Entries)
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// logCheckBatch is the number of entries that CheckLogs reads at a time.
+const logCheckBatch = 1024
+
+// LogDivergence describes an inconsistency between the logs of replicas of
+// the same group, as found by CheckLogs.
+type LogDivergence struct {
+	// Index is the first index at which the logs are inconsistent.
+	Index uint64
+	// IDs are the replicas whose logs are inconsistent. The second one is None
+	// if the log of the first one is inconsistent with its own HardState.
+	IDs [2]uint64
+	// Entries are the replicas' entries at Index, if they have one.
+	Entries [2][]pb.Entry
+	// Reason describes the violated property.
+	Reason string
+}
+
+func (d *LogDivergence) Error() string {
+	if d.IDs[1] == None {
+		return fmt.Sprintf("raft: log of %x is inconsistent at index %d: %s", d.IDs[0], d.Index, d.Reason)
+	}
+	return fmt.Sprintf("raft: logs of %x and %x diverge at index %d: %s", d.IDs[0], d.IDs[1], d.Index, d.Reason)
+}
+
+// Describe returns a human-readable description of the divergence, including
+// the entries at Index, for debugging.
+func (d *LogDivergence) Describe(f EntryFormatter) string {
+	var buf bytes.Buffer
+	buf.WriteString(d.Error())
+	buf.WriteByte('\n')
+	for i, id := range d.IDs {
+		if id == None {
+			continue
+		}
+		fmt.Fprintf(&buf, "%x: ", id)
+		if len(d.Entries[i]) == 0 {
+			buf.WriteString("no entry\n")
+		} else {
+			buf.WriteString(DescribeEntries(d.Entries[i], f))
+		}
+	}
+	return buf.String()
+}
+
+// CheckLogs verifies that the logs in the given Storages, keyed by the IDs of
+// the replicas of a group that they belong to, are consistent:
+//
+//   - the commit index of each replica's HardState is within its log;
+//   - entries with the same index and term are identical, and so are all
+//     entries before them (the Log Matching Property);
+//   - entries at indexes that both replicas consider committed are identical.
+//
+// It returns a *LogDivergence describing the first inconsistency found, or an
+// error returned by a Storage. Only the parts of the logs that are present in
+// both Storages, i.e. not compacted, are compared.
+func CheckLogs(replicas map[uint64]Storage) error {
+	ids := make([]uint64, 0, len(replicas))
+	for id := range replicas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	logs := make([]*raftLog, len(ids))
+	for i, id := range ids {
+		s := replicas[id]
+		hs, _, err := s.InitialState()
+		if err != nil {
+			return err
+		}
+		l := newLog(s, getLogger())
+		if hs.Commit > l.lastIndex() {
+			return &LogDivergence{Index: hs.Commit, IDs: [2]uint64{id, None},
+				Reason: fmt.Sprintf("commit index beyond last index %d", l.lastIndex())}
+		}
+		if hs.Commit > l.committed {
+			l.committed = hs.Commit
+		}
+		logs[i] = l
+	}
+
+	var first *LogDivergence
+	for i := range logs {
+		for j := i + 1; j < len(logs); j++ {
+			d, err := checkLogPair(logs[i], logs[j])
+			if err != nil {
+				return err
+			}
+			if d != nil && (first == nil || d.Index < first.Index) {
+				d.IDs = [2]uint64{ids[i], ids[j]}
+				first = d
+			}
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return first
+}
+
+// checkLogPair compares the overlapping parts of the given logs, and returns
+// the first inconsistency between them.
+func checkLogPair(a, b *raftLog) (*LogDivergence, error) {
+	lo := max(a.firstIndex(), b.firstIndex())
+	hi := min(a.lastIndex(), b.lastIndex())
+	committed := min(a.committed, b.committed)
+
+	// diverged is the first index at which the terms differ, if any.
+	var diverged uint64
+	var divergedEnts [2][]pb.Entry
+	for lo <= hi {
+		next := min(hi+1, lo+logCheckBatch)
+		entsA, err := a.slice(lo, next, noLimit)
+		if err != nil {
+			return nil, err
+		}
+		entsB, err := b.slice(lo, next, noLimit)
+		if err != nil {
+			return nil, err
+		}
+		for k := range entsA {
+			ea, eb := entsA[k], entsB[k]
+			ents := [2][]pb.Entry{{ea}, {eb}}
+			if ea.Term != eb.Term {
+				if ea.Index <= committed {
+					return &LogDivergence{Index: ea.Index, Entries: ents,
+						Reason: "committed entries differ"}, nil
+				}
+				if diverged == 0 {
+					diverged, divergedEnts = ea.Index, ents
+				}
+				continue
+			}
+			if diverged != 0 {
+				return &LogDivergence{Index: diverged, Entries: divergedEnts,
+					Reason: fmt.Sprintf("terms differ although they agree at index %d", ea.Index)}, nil
+			}
+			if !entriesEqual(ea, eb) {
+				return &LogDivergence{Index: ea.Index, Entries: ents,
+					Reason: "entries with the same index and term differ"}, nil
+			}
+		}
+		lo = next
+	}
+	return nil, nil
+}
+
+// entriesEqual returns whether the given entries have the same contents. The
+// Checksum is not compared, since one replica may carry it and another not.
+func entriesEqual(a, b pb.Entry) bool {
+	return a.Type == b.Type && a.Term == b.Term && a.Index == b.Index && bytes.Equal(a.Data, b.Data)
+}
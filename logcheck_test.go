@@ -0,0 +1,99 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func TestCheckLogs(t *testing.T) {
+	// newStorage returns a storage with the given commit index and entries
+	// with the given terms, starting at index 1.
+	newStorage := func(commit uint64, terms ...uint64) *MemoryStorage {
+		s := NewMemoryStorage()
+		var ents []pb.Entry
+		for i, term := range terms {
+			ents = append(ents, pb.Entry{Index: uint64(i + 1), Term: term, Data: []byte("data")})
+		}
+		require.NoError(t, s.Append(ents))
+		require.NoError(t, s.SetHardState(pb.HardState{Term: 3, Commit: commit}))
+		return s
+	}
+
+	for _, tt := range []struct {
+		name     string
+		replicas map[uint64]Storage
+		wantErr  string
+	}{{
+		name: "consistent",
+		replicas: map[uint64]Storage{
+			1: newStorage(3, 1, 1, 2, 2, 3),
+			2: newStorage(3, 1, 1, 2, 2),
+			// Uncommitted entries may differ.
+			3: newStorage(2, 1, 1, 2, 3),
+		},
+	}, {
+		name: "committed entries differ",
+		replicas: map[uint64]Storage{
+			1: newStorage(4, 1, 1, 2, 2),
+			2: newStorage(4, 1, 1, 2, 3),
+		},
+		wantErr: "raft: logs of 1 and 2 diverge at index 4: committed entries differ",
+	}, {
+		name: "log matching",
+		replicas: map[uint64]Storage{
+			1: newStorage(1, 1, 1, 2, 3),
+			2: newStorage(1, 1, 2, 2, 3),
+			3: newStorage(1, 1, 2),
+		},
+		wantErr: "raft: logs of 1 and 2 diverge at index 2: terms differ although they agree at index 3",
+	}, {
+		name: "commit beyond log",
+		replicas: map[uint64]Storage{
+			1: newStorage(2, 1, 1),
+			2: newStorage(3, 1, 1),
+		},
+		wantErr: "raft: log of 2 is inconsistent at index 3: commit index beyond last index 2",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckLogs(tt.replicas)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Entries that only differ in their checksum are identical.
+	s1, s2 := newStorage(0, 1, 1), newStorage(0, 1, 1)
+	s2.ents[2].SetChecksum()
+	require.NoError(t, CheckLogs(map[uint64]Storage{1: s1, 2: s2}))
+
+	// Entries with the same index and term must be identical otherwise.
+	s2.ents[2].Data = []byte("dat4")
+	err := CheckLogs(map[uint64]Storage{1: s1, 2: s2})
+	require.EqualError(t, err, "raft: logs of 1 and 2 diverge at index 2: entries with the same index and term differ")
+	d, ok := err.(*LogDivergence)
+	require.True(t, ok)
+	require.Equal(t, `raft: logs of 1 and 2 diverge at index 2: entries with the same index and term differ
+1: 1/2 EntryNormal "data"
+2: 1/2 EntryNormal "dat4"
+`, d.Describe(nil))
+}
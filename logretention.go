@@ -0,0 +1,164 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import "go.etcd.io/raft/v3/tracker"
+
+// Compactor is a Storage that can discard the log prefix, like MemoryStorage.
+type Compactor interface {
+	// Compact discards all log entries prior to compactIndex. It is the
+	// application's responsibility to not attempt to compact an index greater
+	// than the applied index, and to be able to provide a snapshot covering
+	// the compacted entries via Storage.Snapshot.
+	Compact(compactIndex uint64) error
+}
+
+// RetentionPolicy configures which part of the log CompactionIndex retains.
+// The zero value retains the entries that any follower still needs.
+type RetentionPolicy struct {
+	// MinEntries is the number of entries up to the applied index that are
+	// always retained.
+	MinEntries uint64
+	// MaxEntries, if non-zero, is the number of entries up to the applied
+	// index beyond which the log is compacted even if a follower still needs
+	// them. Such a follower is caught up with a snapshot instead.
+	MaxEntries uint64
+	// MaxBytes, if non-zero, is like MaxEntries, but limits the total size of
+	// the retained entries up to the applied index.
+	MaxBytes uint64
+	// IgnoreInactive makes followers that have not recently been active (see
+	// tracker.Progress.RecentActive) not hold back compaction. This is only
+	// meaningful with Config.CheckQuorum.
+	IgnoreInactive bool
+}
+
+// CompactionIndex returns the highest index up to which the log in the given
+// Storage can be compacted according to the policy, or zero if there is
+// nothing to compact. The index is at most the applied index, and, on the
+// leader, at most the Match of every follower and observer that is not in
+// StateSnapshot, so that none of them needs a snapshot to catch up, unless the
+// policy's thresholds are exceeded. On other nodes, only the applied index and
+// the thresholds are considered.
+func CompactionIndex(st Status, s Storage, p RetentionPolicy) (uint64, error) {
+	first, err := s.FirstIndex()
+	if err != nil {
+		return 0, err
+	}
+	last, err := s.LastIndex()
+	if err != nil {
+		return 0, err
+	}
+	applied := st.Applied
+	if applied > last {
+		applied = last
+	}
+	if applied < p.MinEntries || applied-p.MinEntries < first {
+		return 0, nil
+	}
+	// NB: the entry at the compaction index itself is retained as a dummy
+	// entry by MemoryStorage, so the entries after it are the retained ones.
+	index := applied - p.MinEntries
+
+	holdBack := func(prs map[uint64]tracker.Progress) {
+		for id, pr := range prs {
+			if id == st.ID || pr.State == tracker.StateSnapshot || (p.IgnoreInactive && !pr.RecentActive) {
+				continue
+			}
+			if pr.Match < index {
+				index = pr.Match
+			}
+		}
+	}
+	if st.RaftState == StateLeader {
+		holdBack(st.Progress)
+		holdBack(st.Observers)
+	}
+
+	if p.MaxEntries > 0 && applied-index > p.MaxEntries {
+		index = applied - p.MaxEntries
+	}
+	if p.MaxBytes > 0 && index < applied {
+		lo := index
+		if lo < first-1 {
+			lo = first - 1
+		}
+		bytesIndex, err := maxBytesCompactionIndex(s, lo, applied, p.MaxBytes)
+		if err != nil {
+			return 0, err
+		}
+		if bytesIndex > index {
+			index = bytesIndex
+		}
+	}
+
+	if index > applied-p.MinEntries {
+		// MinEntries takes precedence over the thresholds.
+		index = applied - p.MinEntries
+	}
+	if index < first {
+		return 0, nil
+	}
+	return index, nil
+}
+
+// maxBytesCompactionIndex returns the highest index in (lo, hi] such that the
+// entries after it, up to hi, fit into maxBytes, or lo if all entries in
+// (lo, hi] fit. The entries are read backwards from hi in pages limited to the
+// remaining budget, so that at most maxBytes (or a single larger entry) are
+// held in memory at a time, and reading stops as soon as the budget is
+// exceeded.
+func maxBytesCompactionIndex(s Storage, lo, hi, maxBytes uint64) (uint64, error) {
+	n := uint64(1) // the number of entries to read next
+	for hi > lo {
+		from := lo + 1
+		if hi-lo > n {
+			from = hi - n + 1
+		}
+		ents, err := s.Entries(from, hi+1, maxBytes)
+		if err != nil {
+			return 0, err
+		}
+		var size uint64
+		for i := range ents {
+			size += uint64(ents[i].Size())
+		}
+		if uint64(len(ents)) == hi+1-from && size <= maxBytes {
+			maxBytes -= size
+			hi = from - 1
+			n *= 2
+			continue
+		}
+		if hi == from {
+			// The entry at hi alone exceeds the remaining budget.
+			return hi, nil
+		}
+		// The budget is exceeded within the page; retry with a smaller one.
+		n = (hi + 1 - from) / 2
+	}
+	return lo, nil
+}
+
+// CompactLog compacts the log in the given Storage up to the index returned by
+// CompactionIndex, if any, and returns that index.
+func CompactLog(st Status, s Storage, c Compactor, p RetentionPolicy) (uint64, error) {
+	index, err := CompactionIndex(st, s, p)
+	if err != nil || index == 0 {
+		return 0, err
+	}
+	if err := c.Compact(index); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+func TestCompactionIndex(t *testing.T) {
+	// The log holds entries 3-20 of equal size.
+	ent := func(i uint64) pb.Entry { return pb.Entry{Index: i, Term: 1, Data: []byte("x")} }
+	entSize := uint64((&pb.Entry{Index: 20, Term: 1, Data: []byte("x")}).Size())
+	newStorage := func() *MemoryStorage {
+		s := NewMemoryStorage()
+		require.NoError(t, s.ApplySnapshot(pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 2, Term: 1}}))
+		var ents []pb.Entry
+		for i := uint64(3); i <= 20; i++ {
+			ents = append(ents, ent(i))
+		}
+		require.NoError(t, s.Append(ents))
+		return s
+	}
+
+	leader := func(applied uint64, prs map[uint64]tracker.Progress) Status {
+		var st Status
+		st.ID, st.RaftState, st.Applied, st.Progress = 1, StateLeader, applied, prs
+		return st
+	}
+	follower := Status{}
+	follower.ID, follower.RaftState, follower.Applied = 1, StateFollower, 15
+	prs := map[uint64]tracker.Progress{
+		1: {Match: 20, RecentActive: true},
+		2: {Match: 18, RecentActive: true},
+		3: {Match: 8},
+		4: {Match: 4, State: tracker.StateSnapshot},
+	}
+
+	for _, tt := range []struct {
+		name string
+		st   Status
+		p    RetentionPolicy
+		exp  uint64
+	}{
+		{"follower", follower, RetentionPolicy{}, 15},
+		{"follower min entries", follower, RetentionPolicy{MinEntries: 5}, 10},
+		{"follower retains all", follower, RetentionPolicy{MinEntries: 13}, 0},
+		{"leader", leader(15, prs), RetentionPolicy{}, 8},
+		{"leader ignoring inactive", leader(15, prs), RetentionPolicy{IgnoreInactive: true}, 15},
+		{"leader max entries", leader(15, prs), RetentionPolicy{MaxEntries: 5}, 10},
+		{"leader max entries and min entries", leader(15, prs), RetentionPolicy{MinEntries: 7, MaxEntries: 5}, 8},
+		{"leader max bytes", leader(15, prs), RetentionPolicy{MaxBytes: 3*entSize + entSize/2}, 12},
+		{"leader max bytes not exceeded", leader(15, prs), RetentionPolicy{MaxBytes: 10 * entSize}, 8},
+		{"leader max bytes exact", leader(15, prs), RetentionPolicy{MaxBytes: 3 * entSize}, 12},
+		{"leader max bytes below entry size", leader(15, prs), RetentionPolicy{MaxBytes: entSize / 2}, 15},
+		{"leader max bytes many pages", leader(20, prs), RetentionPolicy{MaxBytes: 5*entSize + 1}, 15},
+		{"applied beyond storage", leader(30, nil), RetentionPolicy{}, 20},
+		{"nothing applied", leader(2, nil), RetentionPolicy{}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage()
+			idx, err := CompactionIndex(tt.st, s, tt.p)
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, idx)
+
+			idx, err = CompactLog(tt.st, s, s, tt.p)
+			require.NoError(t, err)
+			require.Equal(t, tt.exp, idx)
+			if tt.exp != 0 {
+				first, err := s.FirstIndex()
+				require.NoError(t, err)
+				require.Equal(t, tt.exp+1, first)
+			}
+		})
+	}
+}
+
+// entriesRecordingStorage records the range and size of the entries returned
+// by Entries.
+type entriesRecordingStorage struct {
+	*MemoryStorage
+	lowest  uint64
+	maxRead uint64
+}
+
+func (s *entriesRecordingStorage) Entries(lo, hi, maxSize uint64) ([]pb.Entry, error) {
+	ents, err := s.MemoryStorage.Entries(lo, hi, maxSize)
+	if s.lowest == 0 || lo < s.lowest {
+		s.lowest = lo
+	}
+	var size uint64
+	for i := range ents {
+		size += uint64(ents[i].Size())
+	}
+	if size > s.maxRead {
+		s.maxRead = size
+	}
+	return ents, err
+}
+
+func TestCompactionIndexMaxBytesReads(t *testing.T) {
+	ms := NewMemoryStorage()
+	for i := uint64(1); i <= 1000; i++ {
+		require.NoError(t, ms.Append([]pb.Entry{{Index: i, Term: 1, Data: []byte("xxxxxxxx")}}))
+	}
+	s := &entriesRecordingStorage{MemoryStorage: ms}
+	var st Status
+	st.ID, st.RaftState, st.Applied = 1, StateLeader, 1000
+	st.Progress = map[uint64]tracker.Progress{1: {Match: 1000}, 2: {Match: 3}}
+	entSize := uint64((&pb.Entry{Index: 1000, Term: 1, Data: []byte("xxxxxxxx")}).Size())
+
+	idx, err := CompactionIndex(st, s, RetentionPolicy{MaxBytes: 10 * entSize})
+	require.NoError(t, err)
+	require.Equal(t, uint64(990), idx)
+	// Only the entries near the budget were read, never more than it at once.
+	require.GreaterOrEqual(t, s.lowest, uint64(980))
+	require.LessOrEqual(t, s.maxRead, 10*entSize)
+}
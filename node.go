@@ -138,6 +138,18 @@ type Node interface {
 	// Propose proposes that data be appended to the log. Note that proposals can be lost without
 	// notice, therefore it is user's job to ensure proposal retries.
 	Propose(ctx context.Context, data []byte) error
+	// ProposeBatch proposes that each element of data be appended to the log
+	// as a separate EntryNormal. The entries are submitted to raft as a single
+	// proposal and are thus accepted or dropped as a unit; in particular,
+	// MaxUncommittedEntriesSize is applied to the batch as a whole. If the
+	// batch is accepted, the returned slice holds one ProposalResult per
+	// entry, in order. Like any proposal, accepted entries can still be lost
+	// without notice.
+	ProposeBatch(ctx context.Context, data [][]byte) ([]ProposalResult, error)
+	// ProposeEntries is like ProposeBatch, but accepts entries with explicit
+	// types, such as EntryConfChangeV2. Only the Type and Data fields of the
+	// provided entries are used.
+	ProposeEntries(ctx context.Context, ents []pb.Entry) ([]ProposalResult, error)
 	// ProposeConfChange proposes a configuration change. Like any proposal, the
 	// configuration change may be dropped with or without an error being
 	// returned. In particular, configuration changes are dropped unless the
@@ -187,7 +199,18 @@ type Node interface {
 	ApplyConfChange(cc pb.ConfChangeI) *pb.ConfState
 
 	// TransferLeadership attempts to transfer leadership to the given transferee.
-	TransferLeadership(ctx context.Context, lead, transferee uint64)
+	// The returned channel receives the outcome of the transfer once it is
+	// known. If the local node is not the leader, the request is forwarded to
+	// the leader and LeaderTransferNotLeader is reported right away. If ctx is
+	// done before the request is accepted, or the node is stopped before the
+	// outcome is known, LeaderTransferAborted is reported.
+	TransferLeadership(ctx context.Context, lead, transferee uint64) <-chan LeaderTransferResult
+	// StepDown transfers the leadership to the voter best suited to take over,
+	// see RawNode.StepDown. The returned channel receives the outcome like for
+	// TransferLeadership, or LeaderTransferNoCandidate if no voter is eligible.
+	// Unlike TransferLeadership, the request is not forwarded if the local node
+	// is not the leader.
+	StepDown(ctx context.Context, opts StepDownOptions) <-chan LeaderTransferResult
 
 	// ForgetLeader forgets a follower's current leader, changing it to None. It
 	// remains a leaderless follower in the current term, without campaigning.
@@ -223,8 +246,35 @@ type Node interface {
 	// to ensure read index retries.
 	ReadIndex(ctx context.Context, rctx []byte) error
 
+	// AddObserver attaches an observer to the local node, see
+	// RawNode.AddObserver.
+	AddObserver(ctx context.Context, id uint64) error
+	// RemoveObserver detaches an observer attached with AddObserver.
+	RemoveObserver(ctx context.Context, id uint64) error
+
+	// DecommissionNode registers the given node for removal from the
+	// configuration, see RawNode.DecommissionNode.
+	DecommissionNode(ctx context.Context, id uint64, opts DecommissionOptions) error
+	// NodeDecommission returns the state of the decommission of the given
+	// node, if it is registered.
+	NodeDecommission(id uint64) (NodeDecommission, bool)
+	// CancelNodeDecommission unregisters the decommission of the given node,
+	// see RawNode.CancelNodeDecommission.
+	CancelNodeDecommission(ctx context.Context, id uint64) error
+
 	// Status returns the current status of the raft state machine.
 	Status() Status
+	// ProposalQuota returns the capacity of the node to accept further
+	// proposals, which is only meaningful on the leader. See ProposalQuota for
+	// details.
+	ProposalQuota() ProposalQuota
+	// ProposalThrottled returns a channel signaling changes to
+	// ProposalQuota.Throttled: true is delivered when the leader starts
+	// dropping proposals because MaxUncommittedEntriesSize is exhausted, and
+	// false once committed entries have freed up quota again (or the node
+	// changes term). Only the most recent value is retained in the channel, so
+	// slow consumers observe the latest state rather than every transition.
+	ProposalThrottled() <-chan bool
 	// ReportUnreachable reports the given node is not reachable for the last send.
 	ReportUnreachable(id uint64)
 	// ReportSnapshot reports the status of the sent snapshot. The id is the raft ID of the follower
@@ -242,6 +292,20 @@ type Node interface {
 	Stop()
 }
 
+// ProposalResult describes the outcome of a single entry of a proposal made
+// via ProposeBatch or ProposeEntries.
+type ProposalResult struct {
+	// Index and Term are the log position assigned to the entry by the local
+	// leader. Both are zero if the proposal was forwarded to a remote leader,
+	// in which case the position is not known at proposal time.
+	Index, Term uint64
+	// Err is non-nil if the entry was refused even though the batch it was
+	// part of was accepted. This is currently only the case for configuration
+	// changes failing the leader's validation, which are replaced with an
+	// empty entry at Index.
+	Err error
+}
+
 type Peer struct {
 	ID      uint64
 	Context []byte
@@ -251,11 +315,8 @@ func setupNode(c *Config, peers []Peer) *node {
 	if len(peers) == 0 {
 		panic("no peers given; use RestartNode instead")
 	}
-	rn, err := NewRawNode(c)
-	if err != nil {
-		panic(err)
-	}
-	err = rn.Bootstrap(peers)
+	rn := newNodeRawNode(c)
+	err := rn.Bootstrap(peers)
 	if err != nil {
 		c.Logger.Warningf("error occurred during starting a new node: %v", err)
 	}
@@ -279,13 +340,23 @@ func StartNode(c *Config, peers []Peer) Node {
 // If the caller has an existing state machine, pass in the last log index that
 // has been applied to it; otherwise use zero.
 func RestartNode(c *Config) Node {
+	rn := newNodeRawNode(c)
+	n := newNode(rn)
+	go n.run()
+	return &n
+}
+
+// newNodeRawNode returns the RawNode underlying a Node. It panics if the
+// configuration is invalid, or uses options that require the use of RawNode.
+func newNodeRawNode(c *Config) *RawNode {
+	if c.AsyncSnapshots {
+		panic("AsyncSnapshots requires the use of RawNode")
+	}
 	rn, err := NewRawNode(c)
 	if err != nil {
 		panic(err)
 	}
-	n := newNode(rn)
-	go n.run()
-	return &n
+	return rn
 }
 
 type msgWithResult struct {
@@ -293,10 +364,34 @@ type msgWithResult struct {
 	result chan error
 }
 
+// leaderTransferWaiter is a caller of TransferLeadership waiting for the
+// outcome of the leadership transfer with sequence number seq.
+type leaderTransferWaiter struct {
+	seq    uint64
+	result chan LeaderTransferResult
+}
+
+// leaderTransferRequest is a TransferLeadership call, or a StepDown call if
+// stepDown is set.
+type leaderTransferRequest struct {
+	m        pb.Message
+	stepDown *StepDownOptions
+	result   chan LeaderTransferResult
+}
+
+// nodeCall is a call of a RawNode method on behalf of a Node method, made
+// by run() so that it is serialized with the other uses of the RawNode.
+type nodeCall struct {
+	fn     func(rn *RawNode) error
+	result chan error
+}
+
 // node is the canonical implementation of the Node interface
 type node struct {
 	propc      chan msgWithResult
 	recvc      chan pb.Message
+	transferc  chan leaderTransferRequest
+	callc      chan nodeCall
 	confc      chan pb.ConfChangeV2
 	confstatec chan pb.ConfState
 	readyc     chan Ready
@@ -305,6 +400,8 @@ type node struct {
 	done       chan struct{}
 	stop       chan struct{}
 	status     chan chan Status
+	quota      chan chan ProposalQuota
+	throttlec  chan bool
 
 	rn *RawNode
 }
@@ -313,6 +410,8 @@ func newNode(rn *RawNode) node {
 	return node{
 		propc:      make(chan msgWithResult),
 		recvc:      make(chan pb.Message),
+		transferc:  make(chan leaderTransferRequest),
+		callc:      make(chan nodeCall),
 		confc:      make(chan pb.ConfChangeV2),
 		confstatec: make(chan pb.ConfState),
 		readyc:     make(chan Ready),
@@ -324,7 +423,11 @@ func newNode(rn *RawNode) node {
 		done:   make(chan struct{}),
 		stop:   make(chan struct{}),
 		status: make(chan chan Status),
-		rn:     rn,
+		quota:  make(chan chan ProposalQuota),
+		// throttlec holds only the latest throttling state, see
+		// notifyThrottled.
+		throttlec: make(chan bool, 1),
+		rn:        rn,
 	}
 }
 
@@ -349,6 +452,8 @@ func (n *node) run() {
 	r := n.rn.raft
 
 	lead := None
+	throttled := false
+	var transfers []leaderTransferWaiter
 
 	for {
 		if advancec == nil && n.rn.HasReady() {
@@ -379,6 +484,15 @@ func (n *node) run() {
 			lead = r.lead
 		}
 
+		if throttled != r.proposalsThrottled {
+			throttled = r.proposalsThrottled
+			n.notifyThrottled(throttled)
+		}
+
+		if len(transfers) > 0 {
+			transfers = notifyLeaderTransfers(r, transfers)
+		}
+
 		select {
 		// TODO: maybe buffer the config propose if there exists one (the way
 		// described in raft dissertation)
@@ -397,9 +511,34 @@ func (n *node) run() {
 				break
 			}
 			r.Step(m)
+		case req := <-n.transferc:
+			if r.state != StateLeader {
+				if req.stepDown == nil {
+					// Forwarded to the leader, if known.
+					r.Step(req.m)
+				}
+				req.result <- LeaderTransferNotLeader
+				break
+			}
+			if req.stepDown != nil {
+				if req.m.From = r.stepDownCandidate(*req.stepDown); req.m.From == None {
+					req.result <- LeaderTransferNoCandidate
+					break
+				}
+			}
+			r.Step(req.m)
+			if r.leadTransfer.Transferee != req.m.From {
+				// The transferee is a learner, and the transfer in progress
+				// to another node was kept.
+				req.result <- LeaderTransferNotVoter
+				break
+			}
+			transfers = append(transfers, leaderTransferWaiter{seq: r.leadTransferSeq, result: req.result})
+		case c := <-n.callc:
+			c.result <- c.fn(n.rn)
 		case cc := <-n.confc:
 			_, okBefore := r.prs.Progress[r.id]
-			cs := r.applyConfChange(cc)
+			cs := *n.rn.ApplyConfChange(cc)
 			// If the node was removed, block incoming proposals. Note that we
 			// only do this if the node was in the config before. Nodes may be
 			// a member of the group without knowing this (when they're catching
@@ -446,13 +585,43 @@ func (n *node) run() {
 			advancec = nil
 		case c := <-n.status:
 			c <- getStatus(r)
+		case c := <-n.quota:
+			c <- getProposalQuota(r)
 		case <-n.stop:
+			for _, w := range transfers {
+				w.result <- LeaderTransferAborted
+			}
 			close(n.done)
 			return
 		}
 	}
 }
 
+// notifyLeaderTransfers reports the outcome of the leadership transfers that
+// have one, and returns the waiters that are still waiting.
+func notifyLeaderTransfers(r *raft, transfers []leaderTransferWaiter) []leaderTransferWaiter {
+	waiting := transfers[:0]
+	for _, w := range transfers {
+		if res := r.leaderTransferResult(w.seq); res != LeaderTransferInProgress {
+			w.result <- res
+		} else {
+			waiting = append(waiting, w)
+		}
+	}
+	return waiting
+}
+
+// notifyThrottled replaces any unconsumed value in throttlec with the given
+// one. It must only be called from run(), which is the only sender, so the
+// send never blocks.
+func (n *node) notifyThrottled(throttled bool) {
+	select {
+	case <-n.throttlec:
+	default:
+	}
+	n.throttlec <- throttled
+}
+
 // Tick increments the internal logical clock for this Node. Election timeouts
 // and heartbeat timeouts are in units of ticks.
 func (n *node) Tick() {
@@ -470,6 +639,23 @@ func (n *node) Propose(ctx context.Context, data []byte) error {
 	return n.stepWait(ctx, pb.Message{Type: pb.MsgProp, Entries: []pb.Entry{{Data: data}}})
 }
 
+func (n *node) ProposeBatch(ctx context.Context, data [][]byte) ([]ProposalResult, error) {
+	return n.ProposeEntries(ctx, dataToEntries(data))
+}
+
+func (n *node) ProposeEntries(ctx context.Context, ents []pb.Entry) ([]ProposalResult, error) {
+	if len(ents) == 0 {
+		return nil, nil
+	}
+	m := batchToMsg(ents)
+	// The raft goroutine assigns indexes to m.Entries in place; the result
+	// channel orders these writes before our reads below.
+	if err := n.stepWait(ctx, m); err != nil {
+		return nil, err
+	}
+	return proposalResults(ents, m.Entries), nil
+}
+
 func (n *node) Step(ctx context.Context, m pb.Message) error {
 	// Ignore unexpected local messages receiving over network.
 	if IsLocalMsg(m.Type) && !IsLocalMsgTarget(m.From) {
@@ -487,6 +673,38 @@ func confChangeToMsg(c pb.ConfChangeI) (pb.Message, error) {
 	return pb.Message{Type: pb.MsgProp, Entries: []pb.Entry{{Type: typ, Data: data}}}, nil
 }
 
+func dataToEntries(data [][]byte) []pb.Entry {
+	ents := make([]pb.Entry, len(data))
+	for i := range data {
+		ents[i] = pb.Entry{Data: data[i]}
+	}
+	return ents
+}
+
+// batchToMsg returns a MsgProp carrying copies of the given entries, so that
+// raft can assign their indexes without mutating the caller's slice.
+func batchToMsg(ents []pb.Entry) pb.Message {
+	propEnts := make([]pb.Entry, len(ents))
+	for i := range ents {
+		propEnts[i] = pb.Entry{Type: ents[i].Type, Data: ents[i].Data}
+	}
+	return pb.Message{Type: pb.MsgProp, Entries: propEnts}
+}
+
+// proposalResults builds the per-entry results of a batch proposal from the
+// proposed entries and the entries of the MsgProp after it has been stepped.
+func proposalResults(proposed, stepped []pb.Entry) []ProposalResult {
+	res := make([]ProposalResult, len(stepped))
+	for i := range stepped {
+		res[i] = ProposalResult{Index: stepped[i].Index, Term: stepped[i].Term}
+		if stepped[i].Type != proposed[i].Type {
+			// The leader replaces refused conf changes with empty entries.
+			res[i].Err = &ProposalDroppedError{Reason: ProposalDropConfChangeRefused}
+		}
+	}
+	return res
+}
+
 func (n *node) ProposeConfChange(ctx context.Context, cc pb.ConfChangeI) error {
 	msg, err := confChangeToMsg(cc)
 	if err != nil {
@@ -576,6 +794,18 @@ func (n *node) Status() Status {
 	}
 }
 
+func (n *node) ProposalQuota() ProposalQuota {
+	c := make(chan ProposalQuota)
+	select {
+	case n.quota <- c:
+		return <-c
+	case <-n.done:
+		return ProposalQuota{}
+	}
+}
+
+func (n *node) ProposalThrottled() <-chan bool { return n.throttlec }
+
 func (n *node) ReportUnreachable(id uint64) {
 	select {
 	case n.recvc <- pb.Message{Type: pb.MsgUnreachable, From: id}:
@@ -592,19 +822,91 @@ func (n *node) ReportSnapshot(id uint64, status SnapshotStatus) {
 	}
 }
 
-func (n *node) TransferLeadership(ctx context.Context, lead, transferee uint64) {
+func (n *node) TransferLeadership(ctx context.Context, lead, transferee uint64) <-chan LeaderTransferResult {
+	// The result channel is buffered so that run() never blocks on it.
+	res := make(chan LeaderTransferResult, 1)
 	select {
 	// manually set 'from' and 'to', so that leader can voluntarily transfers its leadership
-	case n.recvc <- pb.Message{Type: pb.MsgTransferLeader, From: transferee, To: lead}:
+	case n.transferc <- leaderTransferRequest{m: pb.Message{Type: pb.MsgTransferLeader, From: transferee, To: lead}, result: res}:
+	case <-n.done:
+		res <- LeaderTransferAborted
+	case <-ctx.Done():
+		res <- LeaderTransferAborted
+	}
+	return res
+}
+
+func (n *node) StepDown(ctx context.Context, opts StepDownOptions) <-chan LeaderTransferResult {
+	res := make(chan LeaderTransferResult, 1)
+	select {
+	case n.transferc <- leaderTransferRequest{m: pb.Message{Type: pb.MsgTransferLeader}, stepDown: &opts, result: res}:
 	case <-n.done:
+		res <- LeaderTransferAborted
 	case <-ctx.Done():
+		res <- LeaderTransferAborted
 	}
+	return res
 }
 
 func (n *node) ForgetLeader(ctx context.Context) error {
 	return n.step(ctx, pb.Message{Type: pb.MsgForgetLeader})
 }
 
+func (n *node) AddObserver(ctx context.Context, id uint64) error {
+	return n.call(ctx, func(rn *RawNode) error { return rn.AddObserver(id) })
+}
+
+func (n *node) RemoveObserver(ctx context.Context, id uint64) error {
+	return n.call(ctx, func(rn *RawNode) error {
+		rn.RemoveObserver(id)
+		return nil
+	})
+}
+
+func (n *node) DecommissionNode(ctx context.Context, id uint64, opts DecommissionOptions) error {
+	return n.call(ctx, func(rn *RawNode) error { return rn.DecommissionNode(id, opts) })
+}
+
+func (n *node) NodeDecommission(id uint64) (NodeDecommission, bool) {
+	var d NodeDecommission
+	var ok bool
+	if err := n.call(context.Background(), func(rn *RawNode) error {
+		d, ok = rn.NodeDecommission(id)
+		return nil
+	}); err != nil {
+		return NodeDecommission{}, false
+	}
+	return d, ok
+}
+
+func (n *node) CancelNodeDecommission(ctx context.Context, id uint64) error {
+	return n.call(ctx, func(rn *RawNode) error {
+		rn.CancelNodeDecommission(id)
+		return nil
+	})
+}
+
+// call runs fn on the RawNode from run(), and returns its result.
+func (n *node) call(ctx context.Context, fn func(rn *RawNode) error) error {
+	// The result channel is buffered so that run() never blocks on it.
+	c := nodeCall{fn: fn, result: make(chan error, 1)}
+	select {
+	case n.callc <- c:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.done:
+		return ErrStopped
+	}
+	select {
+	case err := <-c.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.done:
+		return ErrStopped
+	}
+}
+
 func (n *node) ReadIndex(ctx context.Context, rctx []byte) error {
 	return n.step(ctx, pb.Message{Type: pb.MsgReadIndex, Entries: []pb.Entry{{Data: rctx}}})
 }
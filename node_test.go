@@ -174,6 +174,86 @@ func TestNodePropose(t *testing.T) {
 	}
 }
 
+// TestNodeProposeBatch ensures that node.ProposeBatch sends a single MsgProp
+// carrying all entries and reports the log positions assigned to them.
+func TestNodeProposeBatch(t *testing.T) {
+	s := newTestMemoryStorage(withPeers(1))
+	rn := newTestRawNode(1, 10, 1, s)
+	n := newNode(rn)
+	r := rn.raft
+	go n.run()
+	defer n.Stop()
+	require.NoError(t, n.Campaign(context.TODO()))
+	for {
+		rd := <-n.Ready()
+		s.Append(rd.Entries)
+		n.Advance()
+		if rd.SoftState != nil && rd.SoftState.Lead == r.id {
+			break
+		}
+	}
+
+	data := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	res, err := n.ProposeBatch(context.TODO(), data)
+	require.NoError(t, err)
+	require.Len(t, res, len(data))
+
+	rd := <-n.Ready()
+	require.Len(t, rd.Entries, len(data))
+	for i, ent := range rd.Entries {
+		require.Equal(t, data[i], ent.Data)
+		require.Equal(t, ProposalResult{Index: ent.Index, Term: ent.Term}, res[i])
+	}
+	s.Append(rd.Entries)
+	n.Advance()
+}
+
+// TestNodeProposalThrottled ensures that node.ProposalThrottled signals when
+// proposals start being dropped due to the uncommitted size limit, and when
+// the throttle is lifted.
+func TestNodeProposalThrottled(t *testing.T) {
+	data := []byte("testdata")
+	s := newTestMemoryStorage(withPeers(1))
+	cfg := newTestConfig(1, 10, 1, s)
+	cfg.MaxUncommittedEntriesSize = uint64(payloadSize(raftpb.Entry{Data: data}))
+	rn, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	n := newNode(rn)
+	go n.run()
+	defer n.Stop()
+	require.NoError(t, n.Campaign(context.TODO()))
+	for {
+		rd := <-n.Ready()
+		s.Append(rd.Entries)
+		n.Advance()
+		if len(rd.CommittedEntries) > 0 {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, n.Propose(ctx, data))
+	require.ErrorIs(t, n.Propose(ctx, data), ErrProposalDropped)
+	require.True(t, <-n.ProposalThrottled())
+	q := n.ProposalQuota()
+	require.True(t, q.Throttled)
+	require.Zero(t, q.Available)
+
+	// Commit and apply the accepted proposal, which lifts the throttle.
+	for throttled := true; throttled; {
+		select {
+		case rd := <-n.Ready():
+			s.Append(rd.Entries)
+			n.Advance()
+		case throttled = <-n.ProposalThrottled():
+		case <-ctx.Done():
+			t.Fatal("throttle not lifted")
+		}
+	}
+	require.False(t, n.ProposalQuota().Throttled)
+}
+
 // TestDisableProposalForwarding ensures that proposals are not forwarded to
 // the leader when DisableProposalForwarding is true.
 func TestDisableProposalForwarding(t *testing.T) {
@@ -198,7 +278,12 @@ func TestDisableProposalForwarding(t *testing.T) {
 	}
 
 	// send proposal to r3(follower) where DisableProposalForwarding is true
-	r3.Step(raftpb.Message{From: 3, To: 3, Type: raftpb.MsgProp, Entries: testEntries})
+	err := r3.Step(raftpb.Message{From: 3, To: 3, Type: raftpb.MsgProp, Entries: testEntries})
+	var dropErr *ProposalDroppedError
+	require.ErrorAs(t, err, &dropErr)
+	require.ErrorIs(t, err, ErrProposalDropped)
+	require.Equal(t, ProposalDropForwardingDisabled, dropErr.Reason)
+	require.Equal(t, uint64(1), dropErr.Lead)
 
 	// verify r3(follower) does not forward the proposal when DisableProposalForwarding is true
 	if len(r3.msgs) != 0 {
@@ -476,6 +561,94 @@ func TestNodeProposeWaitDropped(t *testing.T) {
 	}
 }
 
+// TestNodeTransferLeadership verifies that Node.TransferLeadership reports the
+// outcome of the transfer.
+func TestNodeTransferLeadership(t *testing.T) {
+	ctx := context.Background()
+	rn := newTestRawNode(1, 10, 1, newTestMemoryStorage(withPeers(1, 2, 3), withLearners(4)))
+	r := rn.raft
+	n := newNode(rn)
+	go n.run()
+
+	require.Equal(t, LeaderTransferNotLeader, <-n.TransferLeadership(ctx, 1, 2))
+	require.Equal(t, LeaderTransferNotLeader, <-n.StepDown(ctx, StepDownOptions{}))
+
+	n.Stop()
+	r.becomeCandidate()
+	r.becomeLeader()
+	n = newNode(rn)
+	go n.run()
+
+	require.Equal(t, LeaderTransferSucceeded, <-n.TransferLeadership(ctx, 1, 1))
+	require.Equal(t, LeaderTransferNotVoter, <-n.TransferLeadership(ctx, 1, 4))
+	// No follower has been heard from.
+	require.Equal(t, LeaderTransferNoCandidate, <-n.StepDown(ctx, StepDownOptions{}))
+
+	// Node 2 does not catch up, as no messages are delivered.
+	res := n.TransferLeadership(ctx, 1, 2)
+	for i := 0; i < r.electionTimeout; i++ {
+		n.Tick()
+	}
+	require.Equal(t, LeaderTransferNotCaughtUp, <-res)
+
+	// The transfer to node 3 supersedes the one to node 2.
+	res2 := n.TransferLeadership(ctx, 1, 2)
+	res3 := n.TransferLeadership(ctx, 1, 3)
+	require.Equal(t, LeaderTransferAborted, <-res2)
+	n.Stop()
+	require.Equal(t, LeaderTransferAborted, <-res3)
+	require.Equal(t, LeaderTransferAborted, <-n.TransferLeadership(ctx, 1, 3))
+}
+
+// TestNodeObserver verifies that Node.AddObserver and Node.RemoveObserver
+// attach and detach observers via the node goroutine.
+func TestNodeObserver(t *testing.T) {
+	ctx := context.Background()
+	rn := newTestRawNode(1, 10, 1, newTestMemoryStorage(withPeers(1, 2)))
+	rn.raft.becomeCandidate()
+	rn.raft.becomeLeader()
+	n := newNode(rn)
+	go n.run()
+
+	require.Equal(t, ErrObserverInConfig, n.AddObserver(ctx, 2))
+	require.Equal(t, ErrInvalidObserver, n.AddObserver(ctx, 1))
+	require.NoError(t, n.AddObserver(ctx, 3))
+	require.Contains(t, n.Status().Observers, uint64(3))
+	require.NoError(t, n.RemoveObserver(ctx, 3))
+	require.Empty(t, n.Status().Observers)
+
+	n.Stop()
+	require.Equal(t, ErrStopped, n.AddObserver(ctx, 3))
+}
+
+// TestNodeDecommission verifies that the decommission of a node can be driven
+// via Node, and that it advances when the removal is applied.
+func TestNodeDecommission(t *testing.T) {
+	ctx := context.Background()
+	rn := newTestRawNode(1, 10, 1, newTestMemoryStorage(withPeers(1, 2, 3)))
+	rn.raft.becomeCandidate()
+	rn.raft.becomeLeader()
+	n := newNode(rn)
+	go n.run()
+
+	require.Equal(t, ErrNotInConfig, n.DecommissionNode(ctx, 4, DecommissionOptions{}))
+	require.NoError(t, n.DecommissionNode(ctx, 3, DecommissionOptions{}))
+	d, ok := n.NodeDecommission(3)
+	require.True(t, ok)
+	require.Equal(t, DecommissionProposed, d.State)
+
+	n.ApplyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: 3})
+	d, _ = n.NodeDecommission(3)
+	require.Equal(t, DecommissionSucceeded, d.State)
+
+	require.NoError(t, n.CancelNodeDecommission(ctx, 3))
+	_, ok = n.NodeDecommission(3)
+	require.False(t, ok)
+
+	n.Stop()
+	require.Equal(t, ErrStopped, n.DecommissionNode(ctx, 2, DecommissionOptions{}))
+}
+
 // TestNodeTick ensures that node.Tick() will increase the
 // elapsed of the underlying raft state machine.
 func TestNodeTick(t *testing.T) {
@@ -532,6 +705,15 @@ func TestNodeStop(t *testing.T) {
 	n.Stop()
 }
 
+// TestNodeAsyncSnapshots ensures that Node refuses Config.AsyncSnapshots,
+// which requires the use of RawNode.
+func TestNodeAsyncSnapshots(t *testing.T) {
+	c := newTestConfig(1, 10, 1, newTestMemoryStorage(withPeers(1)))
+	c.AsyncSnapshots = true
+	require.Panics(t, func() { StartNode(c, []Peer{{ID: 1}}) })
+	require.Panics(t, func() { RestartNode(c) })
+}
+
 // TestNodeStart ensures that a node can be started correctly. The node should
 // start with correct configuration change entries, and can accept and commit
 // proposals.
@@ -0,0 +1,202 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"errors"
+	"sort"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// ErrObserverInConfig is returned by RawNode.AddObserver if the given peer is
+// part of the configuration.
+var ErrObserverInConfig = errors.New("raft: observer is part of the configuration")
+
+// ErrInvalidObserver is returned by RawNode.AddObserver if the given ID is
+// None or the ID of the local node.
+var ErrInvalidObserver = errors.New("raft: invalid observer ID")
+
+// AddObserver attaches an observer: a peer outside the configuration to which
+// the leader replicates committed entries only. Observers never take part in
+// elections or in committing entries, and are attached without a
+// configuration change. The observer's raft instance should be configured
+// with Config.Observer.
+//
+// Observers are local to this node and only served while it is the leader.
+// To keep an observer attached across leadership changes, it can be attached
+// on all voters. Its replication progress is reported in Status.Observers.
+// Node exposes the same functionality via Node.AddObserver.
+func (rn *RawNode) AddObserver(id uint64) error {
+	return rn.raft.addObserver(id)
+}
+
+// RemoveObserver detaches an observer attached with AddObserver.
+func (rn *RawNode) RemoveObserver(id uint64) {
+	delete(rn.raft.observers, id)
+}
+
+func (r *raft) addObserver(id uint64) error {
+	if id == None || id == r.id {
+		return ErrInvalidObserver
+	}
+	if _, ok := r.prs.Progress[id]; ok {
+		return ErrObserverInConfig
+	}
+	if _, ok := r.observers[id]; ok {
+		return nil
+	}
+	if r.observers == nil {
+		r.observers = tracker.ProgressMap{}
+	}
+	r.observers[id] = r.newObserverProgress()
+	if r.state == StateLeader {
+		r.maybeSendObserverAppend(id, true /* sendIfEmpty */)
+	}
+	return nil
+}
+
+// newObserverProgress returns the progress of an observer that has not been
+// heard from yet. It is probed at the committed index.
+func (r *raft) newObserverProgress() *tracker.Progress {
+	return &tracker.Progress{
+		Next:         r.raftLog.committed + 1,
+		Inflights:    r.prs.NewInflights(),
+		RecentActive: true,
+	}
+}
+
+// visitObservers invokes the supplied closure for all observers in stable
+// order.
+func (r *raft) visitObservers(f func(id uint64, pr *tracker.Progress)) {
+	if len(r.observers) == 0 {
+		return
+	}
+	ids := make([]uint64, 0, len(r.observers))
+	for id := range r.observers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		f(id, r.observers[id])
+	}
+}
+
+// maybeSendObserverAppend sends committed entries to the given observer, or a
+// snapshot if they are no longer available. Like maybeSendAppend, it returns
+// true if a message was sent.
+func (r *raft) maybeSendObserverAppend(to uint64, sendIfEmpty bool) bool {
+	pr := r.observers[to]
+	if pr.IsPaused() {
+		return false
+	}
+
+	prevIndex, committed := pr.Next-1, r.raftLog.committed
+	prevTerm, errt := r.raftLog.term(prevIndex)
+	var ents []pb.Entry
+	var erre error
+	if pr.Next <= committed && (pr.State != tracker.StateReplicate || !pr.Inflights.Full()) {
+		ents, erre = r.raftLog.slice(pr.Next, committed+1, r.maxMsgSize)
+	}
+	if len(ents) == 0 && !sendIfEmpty {
+		return false
+	}
+
+	if errt != nil || erre != nil {
+		if !pr.RecentActive {
+			return false
+		}
+		snapshot, err := r.raftLog.snapshot()
+		if err != nil {
+			if err == ErrSnapshotTemporarilyUnavailable {
+				r.logger.Debugf("%x failed to send snapshot to observer %x because snapshot is temporarily unavailable", r.id, to)
+				return false
+			}
+			panic(err)
+		}
+		if IsEmptySnap(snapshot) {
+			panic("need non-empty snapshot")
+		}
+		r.logger.Debugf("%x sent snapshot[index: %d, term: %d] to observer %x [%s]",
+			r.id, snapshot.Metadata.Index, snapshot.Metadata.Term, to, pr)
+		pr.BecomeSnapshot(snapshot.Metadata.Index)
+		r.send(pb.Message{To: to, Type: pb.MsgSnap, Snapshot: &snapshot})
+		return true
+	}
+
+	if err := pr.UpdateOnEntriesSend(len(ents), uint64(payloadsSize(ents)), pr.Next); err != nil {
+		r.logger.Panicf("%x: %v", r.id, err)
+	}
+	r.send(pb.Message{
+		To:      to,
+		Type:    pb.MsgApp,
+		Index:   prevIndex,
+		LogTerm: prevTerm,
+		Entries: ents,
+		Commit:  committed,
+	})
+	return true
+}
+
+// stepObserver handles a message from an observer on the leader.
+func (r *raft) stepObserver(m pb.Message, pr *tracker.Progress) {
+	switch m.Type {
+	case pb.MsgAppResp:
+		pr.RecentActive = true
+		if m.Reject {
+			if pr.MaybeDecrTo(m.Index, m.RejectHint) {
+				if pr.State == tracker.StateReplicate {
+					pr.BecomeProbe()
+				}
+				r.maybeSendObserverAppend(m.From, true /* sendIfEmpty */)
+			}
+			return
+		}
+		if !pr.MaybeUpdate(m.Index) {
+			return
+		}
+		switch {
+		case pr.State == tracker.StateProbe:
+			pr.BecomeReplicate()
+		case pr.State == tracker.StateSnapshot && pr.Match+1 >= r.raftLog.firstIndex():
+			pr.BecomeProbe()
+			pr.BecomeReplicate()
+		case pr.State == tracker.StateReplicate:
+			pr.Inflights.FreeLE(m.Index)
+		}
+		for r.maybeSendObserverAppend(m.From, false /* sendIfEmpty */) {
+		}
+	case pb.MsgHeartbeatResp:
+		pr.RecentActive = true
+		pr.MsgAppFlowPaused = false
+		if pr.Match < r.raftLog.committed {
+			r.maybeSendObserverAppend(m.From, true /* sendIfEmpty */)
+		}
+	case pb.MsgSnapStatus:
+		if pr.State != tracker.StateSnapshot {
+			return
+		}
+		if m.Reject {
+			pr.PendingSnapshot = 0
+		}
+		pr.BecomeProbe()
+		pr.MsgAppFlowPaused = true
+	case pb.MsgUnreachable:
+		if pr.State == tracker.StateReplicate {
+			pr.BecomeProbe()
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// EntryDataParser is the inverse of an EntryFormatter. It parses the data of
+// an entry from the beginning of s, and returns it along with the rest of s.
+// Nil is a valid EntryDataParser and parses the default format of a nil
+// EntryFormatter.
+type EntryDataParser func(s string) (data []byte, rest string, err error)
+
+// parseQuotedData is the default EntryDataParser.
+func parseQuotedData(s string) ([]byte, string, error) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := strconv.Unquote(quoted)
+	if err != nil {
+		return nil, "", err
+	}
+	if data == "" {
+		return nil, s[len(quoted):], nil
+	}
+	return []byte(data), s[len(quoted):], nil
+}
+
+// ParseMessage parses the output of DescribeMessage, with the entry data
+// formatted by the EntryFormatter that p is the inverse of.
+//
+// The description does not contain all fields of a message, so the parsed
+// message may differ from the described one: the Context, the snapshot data,
+// entry checksums, and the context and transition of conf changes are not
+// described and are left empty, and so is an empty snapshot.
+func ParseMessage(s string, p EntryDataParser) (pb.Message, error) {
+	d := describeParser{s: s, p: p}
+	m, err := d.message()
+	if err == nil && d.s != "" {
+		err = d.errorf("unexpected suffix")
+	}
+	if err != nil {
+		return pb.Message{}, err
+	}
+	return m, nil
+}
+
+// ParseEntry parses the output of DescribeEntry, with the data formatted by
+// the EntryFormatter that p is the inverse of. See ParseMessage for the fields
+// that are not described.
+func ParseEntry(s string, p EntryDataParser) (pb.Entry, error) {
+	d := describeParser{s: s, p: p}
+	e, err := d.entry()
+	if err == nil && d.s != "" {
+		err = d.errorf("unexpected suffix")
+	}
+	if err != nil {
+		return pb.Entry{}, err
+	}
+	return e, nil
+}
+
+// describeParser parses descriptions of messages and entries. s is the
+// remaining input.
+type describeParser struct {
+	s string
+	p EntryDataParser
+}
+
+func (d *describeParser) errorf(format string, args ...interface{}) error {
+	rest := d.s
+	if len(rest) > 20 {
+		rest = rest[:20] + "..."
+	}
+	return fmt.Errorf("raft: parsing description: %s at %q", fmt.Sprintf(format, args...), rest)
+}
+
+// consume removes the given prefix from the input, and returns whether it was
+// there.
+func (d *describeParser) consume(prefix string) bool {
+	if !strings.HasPrefix(d.s, prefix) {
+		return false
+	}
+	d.s = d.s[len(prefix):]
+	return true
+}
+
+func (d *describeParser) expect(prefix string) error {
+	if !d.consume(prefix) {
+		return d.errorf("expected %q", prefix)
+	}
+	return nil
+}
+
+// token removes the prefix of the input up to the first of the given
+// terminators, or the whole input, and returns it.
+func (d *describeParser) token(terminators string) string {
+	i := strings.IndexAny(d.s, terminators)
+	if i < 0 {
+		i = len(d.s)
+	}
+	tok := d.s[:i]
+	d.s = d.s[i:]
+	return tok
+}
+
+// uint parses an unsigned integer in the given base.
+func (d *describeParser) uint(base int) (uint64, error) {
+	i := 0
+	for i < len(d.s) && strings.IndexByte("0123456789abcdef"[:base], d.s[i]) >= 0 {
+		i++
+	}
+	n, err := strconv.ParseUint(d.s[:i], base, 64)
+	if err != nil {
+		return 0, d.errorf("expected a number")
+	}
+	d.s = d.s[i:]
+	return n, nil
+}
+
+// field parses "<name>:<decimal>".
+func (d *describeParser) field(name string) (uint64, error) {
+	if err := d.expect(name + ":"); err != nil {
+		return 0, err
+	}
+	return d.uint(10)
+}
+
+// target parses the output of describeTarget.
+func (d *describeParser) target() (uint64, error) {
+	for id, name := range map[uint64]string{
+		None:                "None",
+		LocalAppendThread:   "AppendThread",
+		LocalApplyThread:    "ApplyThread",
+		LocalFetchThread:    "FetchThread",
+		LocalSnapshotThread: "SnapshotThread",
+	} {
+		if d.consume(name) {
+			return id, nil
+		}
+	}
+	return d.uint(16)
+}
+
+// list parses a list of numbers formatted with %v, e.g. "[1 2 3]".
+func (d *describeParser) list() ([]uint64, error) {
+	if err := d.expect("["); err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for !d.consume("]") {
+		if len(ids) > 0 {
+			if err := d.expect(" "); err != nil {
+				return nil, err
+			}
+		}
+		id, err := d.uint(10)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (d *describeParser) message() (m pb.Message, err error) {
+	if m.From, err = d.target(); err != nil {
+		return m, err
+	}
+	if err = d.expect("->"); err != nil {
+		return m, err
+	}
+	if m.To, err = d.target(); err != nil {
+		return m, err
+	}
+	if err = d.expect(" "); err != nil {
+		return m, err
+	}
+	typ := d.token(" ")
+	t, ok := pb.MessageType_value[typ]
+	if !ok {
+		return m, d.errorf("unknown message type %q", typ)
+	}
+	m.Type = pb.MessageType(t)
+	if err = d.expect(" "); err != nil {
+		return m, err
+	}
+	if m.Term, err = d.field("Term"); err != nil {
+		return m, err
+	}
+	if err = d.expect(" "); err != nil {
+		return m, err
+	}
+	if m.LogTerm, err = d.field("Log"); err != nil {
+		return m, err
+	}
+	if err = d.expect("/"); err != nil {
+		return m, err
+	}
+	if m.Index, err = d.uint(10); err != nil {
+		return m, err
+	}
+
+	if d.consume(" Range:[") {
+		// MsgStorageFetch, see DescribeMessage.
+		if _, err = d.uint(10); err != nil {
+			return m, err
+		}
+		if err = d.expect(","); err != nil {
+			return m, err
+		}
+		if m.Commit, err = d.uint(10); err != nil {
+			return m, err
+		}
+		if err = d.expect(") "); err != nil {
+			return m, err
+		}
+		if m.RejectHint, err = d.field("MaxSize"); err != nil {
+			return m, err
+		}
+	}
+	if d.consume(" Failed") {
+		m.Reject = true
+	}
+	if d.consume(" Rejected (Hint: ") {
+		m.Reject = true
+		if m.RejectHint, err = d.uint(10); err != nil {
+			return m, err
+		}
+		if err = d.expect(")"); err != nil {
+			return m, err
+		}
+	}
+	if d.consume(" Commit:") {
+		if m.Commit, err = d.uint(10); err != nil {
+			return m, err
+		}
+	}
+	if d.consume(" For:") {
+		// MsgStorageSnapshot, see DescribeMessage.
+		if m.Vote, err = d.target(); err != nil {
+			return m, err
+		}
+	}
+	if d.consume(" Vote:") {
+		if m.Vote, err = d.uint(10); err != nil {
+			return m, err
+		}
+	}
+	if d.consume(" Entries:[") {
+		for !d.consume("]") {
+			if len(m.Entries) > 0 {
+				if err = d.expect(", "); err != nil {
+					return m, err
+				}
+			}
+			e, err := d.entry()
+			if err != nil {
+				return m, err
+			}
+			m.Entries = append(m.Entries, e)
+		}
+	}
+	if d.consume(" Snapshot: ") {
+		var snap pb.Snapshot
+		if snap.Metadata, err = d.snapshotMetadata(); err != nil {
+			return m, err
+		}
+		m.Snapshot = &snap
+	}
+	if d.consume(" Responses:[") {
+		for !d.consume("]") {
+			if len(m.Responses) > 0 {
+				if err = d.expect(", "); err != nil {
+					return m, err
+				}
+			}
+			resp, err := d.message()
+			if err != nil {
+				return m, err
+			}
+			m.Responses = append(m.Responses, resp)
+		}
+	}
+	return m, nil
+}
+
+// snapshotMetadata parses the output of DescribeSnapshot.
+func (d *describeParser) snapshotMetadata() (md pb.SnapshotMetadata, err error) {
+	if md.Index, err = d.field("Index"); err != nil {
+		return md, err
+	}
+	if err = d.expect(" "); err != nil {
+		return md, err
+	}
+	if md.Term, err = d.field("Term"); err != nil {
+		return md, err
+	}
+	cs := &md.ConfState
+	for _, l := range []struct {
+		name string
+		ids  *[]uint64
+	}{
+		{" ConfState:Voters:", &cs.Voters},
+		{" VotersOutgoing:", &cs.VotersOutgoing},
+		{" Learners:", &cs.Learners},
+		{" LearnersNext:", &cs.LearnersNext},
+	} {
+		if err = d.expect(l.name); err != nil {
+			return md, err
+		}
+		if *l.ids, err = d.list(); err != nil {
+			return md, err
+		}
+	}
+	if err = d.expect(" AutoLeave:"); err != nil {
+		return md, err
+	}
+	if cs.AutoLeave, err = strconv.ParseBool(d.token(" ,]")); err != nil {
+		return md, d.errorf("expected a bool")
+	}
+	return md, nil
+}
+
+// entry parses the output of DescribeEntry.
+func (d *describeParser) entry() (e pb.Entry, err error) {
+	if e.Term, err = d.uint(10); err != nil {
+		return e, err
+	}
+	if err = d.expect("/"); err != nil {
+		return e, err
+	}
+	if e.Index, err = d.uint(10); err != nil {
+		return e, err
+	}
+	if err = d.expect(" "); err != nil {
+		return e, err
+	}
+	typ := d.token(" ,]")
+	t, ok := pb.EntryType_value[typ]
+	if !ok {
+		return e, d.errorf("unknown entry type %q", typ)
+	}
+	e.Type = pb.EntryType(t)
+
+	switch e.Type {
+	case pb.EntryNormal:
+		if !d.consume(" ") {
+			// The EntryFormatter returned an empty string.
+			return e, nil
+		}
+		p := d.p
+		if p == nil {
+			p = parseQuotedData
+		}
+		if e.Data, d.s, err = p(d.s); err != nil {
+			return e, d.errorf("parsing entry data: %v", err)
+		}
+	case pb.EntryConfChange, pb.EntryConfChangeV2:
+		var ccs []pb.ConfChangeSingle
+		if d.consume(" ") {
+			if ccs, err = pb.ConfChangesFromString(d.token(",]")); err != nil {
+				return e, d.errorf("parsing conf change: %v", err)
+			}
+		}
+		var cc pb.ConfChangeI = pb.ConfChangeV2{Changes: ccs}
+		if e.Type == pb.EntryConfChange {
+			if len(ccs) != 1 {
+				return e, d.errorf("expected a single conf change, got %d", len(ccs))
+			}
+			cc = pb.ConfChange{Type: ccs[0].Type, NodeID: ccs[0].NodeID}
+		}
+		if _, e.Data, err = pb.MarshalConfChange(cc); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
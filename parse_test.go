@@ -0,0 +1,105 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func TestParseMessage(t *testing.T) {
+	confChange := func(typ pb.EntryType, cc pb.ConfChangeI) pb.Entry {
+		_, data, err := pb.MarshalConfChange(cc)
+		require.NoError(t, err)
+		return pb.Entry{Term: 2, Index: 4, Type: typ, Data: data}
+	}
+	ents := []pb.Entry{
+		{Term: 1, Index: 2, Data: []byte("foo, bar]")},
+		{Term: 2, Index: 3},
+		confChange(pb.EntryConfChange, pb.ConfChange{Type: pb.ConfChangeRemoveNode, NodeID: 3}),
+		confChange(pb.EntryConfChangeV2, pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{
+			{Type: pb.ConfChangeAddNode, NodeID: 4}, {Type: pb.ConfChangeAddLearnerNode, NodeID: 5},
+		}}),
+		confChange(pb.EntryConfChangeV2, pb.ConfChangeV2{}),
+	}
+	snap := &pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 10, Term: 3, ConfState: pb.ConfState{
+		Voters: []uint64{1, 2}, VotersOutgoing: []uint64{1, 2, 3}, LearnersNext: []uint64{3}, AutoLeave: true,
+	}}}
+
+	for _, m := range []pb.Message{
+		{From: 1, To: 2, Type: pb.MsgApp, Term: 3, LogTerm: 1, Index: 1, Commit: 2, Entries: ents},
+		{From: 0x1a, To: 0x2b, Type: pb.MsgAppResp, Term: 3, Index: 1, Reject: true, RejectHint: 7},
+		{From: 1, To: 2, Type: pb.MsgSnap, Term: 3, Snapshot: snap},
+		{From: 1, To: 2, Type: pb.MsgVote, Term: 3, LogTerm: 2, Index: 5, Vote: 1},
+		{From: 1, To: LocalSnapshotThread, Type: pb.MsgStorageSnapshot, Vote: 2, Index: 9},
+		{From: 1, To: LocalAppendThread, Type: pb.MsgStorageAppend, Entries: ents[:2], Responses: []pb.Message{
+			{From: LocalAppendThread, To: 1, Type: pb.MsgStorageAppendResp, Index: 3, LogTerm: 2},
+			{From: LocalAppendThread, To: LocalApplyThread, Type: pb.MsgStorageApply, Entries: ents[2:],
+				Responses: []pb.Message{{From: LocalApplyThread, To: 1, Type: pb.MsgStorageApplyResp}}},
+		}},
+		{From: LocalFetchThread, To: 1, Type: pb.MsgStorageFetchResp, Index: 2, Entries: ents[:1]},
+		{From: LocalFetchThread, To: 1, Type: pb.MsgStorageFetchResp, Index: 2, Reject: true},
+		{From: 1, To: LocalFetchThread, Type: pb.MsgStorageFetch, Index: 2, Commit: 5, RejectHint: 1024},
+	} {
+		desc := DescribeMessage(m, nil)
+		parsed, err := ParseMessage(desc, nil)
+		require.NoError(t, err, desc)
+		require.Equal(t, m, parsed, desc)
+	}
+}
+
+func TestParseEntryFormatter(t *testing.T) {
+	e := pb.Entry{Term: 1, Index: 2, Data: []byte{0, 1, 0xff}}
+	desc := DescribeEntry(e, hex.EncodeToString)
+	require.Equal(t, "1/2 EntryNormal 0001ff", desc)
+	parsed, err := ParseEntry(desc, func(s string) ([]byte, string, error) {
+		tok := s
+		if i := strings.IndexAny(s, ",]"); i >= 0 {
+			tok = s[:i]
+		}
+		data, err := hex.DecodeString(tok)
+		return data, s[len(tok):], err
+	})
+	require.NoError(t, err)
+	require.Equal(t, e, parsed)
+
+	// Entries whose data is formatted as an empty string have no data.
+	desc = DescribeEntry(e, func([]byte) string { return "" })
+	require.Equal(t, "1/2 EntryNormal", desc)
+	parsed, err = ParseEntry(desc, nil)
+	require.NoError(t, err)
+	require.Equal(t, pb.Entry{Term: 1, Index: 2}, parsed)
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"1->2 MsgFoo Term:1 Log:0/0",
+		"1->2 MsgApp Term:1 Log:0",
+		"1->2 MsgApp Term:1 Log:0/0 Commit:",
+		"1->2 MsgApp Term:1 Log:0/0 Entries:[1/2 EntryNormal \"foo]",
+		"1->2 MsgApp Term:1 Log:0/0 Entries:[1/2 EntryConfChange v1 v2]",
+		"1->2 MsgApp Term:1 Log:0/0 Snapshot: Index:1 Term:1",
+		"1->2 MsgApp Term:1 Log:0/0 trailing",
+	} {
+		_, err := ParseMessage(s, nil)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+var (
+	// ErrNotLearner is returned by RawNode.PromoteLearner if the given peer is
+	// not a learner in the current configuration.
+	ErrNotLearner = errors.New("raft: not a learner")
+	// ErrLearnerRemoved is reported by a failed LearnerPromotion if the learner
+	// was removed from the configuration before being promoted.
+	ErrLearnerRemoved = errors.New("raft: learner removed from configuration")
+	// ErrPromotionRejected is reported by a failed LearnerPromotion if the
+	// promotion was committed, but the learner is still a learner after its
+	// application, i.e. the application did not apply it.
+	ErrPromotionRejected = errors.New("raft: promotion was not applied")
+)
+
+// PromotionOptions configures the automatic promotion of a learner, see
+// RawNode.PromoteLearner.
+type PromotionOptions struct {
+	// MaxLag is the number of entries by which the learner's acknowledged log
+	// may trail the leader's last index for the learner to be considered
+	// caught up.
+	MaxLag uint64
+	// CaughtUpTicks is the number of consecutive ticks for which the learner
+	// needs to be caught up (and recently active) before it is promoted. A
+	// value of zero is treated as one.
+	CaughtUpTicks int
+	// Joint proposes the promotion as a ConfChangeV2 using joint consensus
+	// (ConfChangeTransitionJointImplicit) rather than the simple protocol.
+	Joint bool
+	// Context is attached to the proposed ConfChangeV2.
+	Context []byte
+}
+
+// PromotionState is the state of a LearnerPromotion.
+type PromotionState uint8
+
+const (
+	// PromotionWaiting means that the learner is not (yet) caught up, or that
+	// the local node is not the leader.
+	PromotionWaiting PromotionState = iota
+	// PromotionProposed means that the promotion has been proposed and is
+	// waiting to be applied.
+	PromotionProposed
+	// PromotionSucceeded means that the learner is now a voter, and the
+	// configuration is no longer joint.
+	PromotionSucceeded
+	// PromotionFailed means that the promotion was abandoned; see
+	// LearnerPromotion.Err.
+	PromotionFailed
+)
+
+var promotionStateStrings = [...]string{
+	PromotionWaiting:   "Waiting",
+	PromotionProposed:  "Proposed",
+	PromotionSucceeded: "Succeeded",
+	PromotionFailed:    "Failed",
+}
+
+func (s PromotionState) String() string {
+	if int(s) < len(promotionStateStrings) {
+		return promotionStateStrings[s]
+	}
+	return fmt.Sprintf("PromotionState(%d)", s)
+}
+
+// LearnerPromotion describes the automatic promotion of a learner.
+type LearnerPromotion struct {
+	// ID is the learner being promoted.
+	ID      uint64
+	Options PromotionOptions
+	State   PromotionState
+	// CaughtUpTicks is the number of consecutive ticks for which the learner
+	// has been caught up. Only tracked on the leader in PromotionWaiting.
+	CaughtUpTicks int
+	// Index and Term identify the proposed ConfChangeV2 in PromotionProposed.
+	Index, Term uint64
+	// Err is the reason for PromotionFailed. In PromotionWaiting, it is the
+	// error of the last unsuccessful proposal, if any, which is retried once
+	// the learner has been caught up for another CaughtUpTicks.
+	Err error
+}
+
+// PromoteLearner registers the given learner for promotion to a voter. Once
+// the learner's log is within opts.MaxLag entries of the leader's for
+// opts.CaughtUpTicks consecutive ticks while the local node is the leader, a
+// ConfChangeV2 promoting it is proposed. The outcome is reported by
+// LearnerPromotion. Registering a learner again replaces its promotion.
+func (rn *RawNode) PromoteLearner(id uint64, opts PromotionOptions) error {
+	if _, ok := rn.raft.prs.Learners[id]; !ok {
+		return ErrNotLearner
+	}
+	if rn.promotions == nil {
+		rn.promotions = map[uint64]*LearnerPromotion{}
+	}
+	rn.promotions[id] = &LearnerPromotion{ID: id, Options: opts}
+	return nil
+}
+
+// LearnerPromotion returns the state of the promotion of the given learner, if
+// it is registered.
+func (rn *RawNode) LearnerPromotion(id uint64) (LearnerPromotion, bool) {
+	p, ok := rn.promotions[id]
+	if !ok {
+		return LearnerPromotion{}, false
+	}
+	return *p, true
+}
+
+// CancelLearnerPromotion unregisters the promotion of the given learner. A
+// promotion that was already proposed is not withdrawn.
+func (rn *RawNode) CancelLearnerPromotion(id uint64) {
+	delete(rn.promotions, id)
+}
+
+// updatePromotions advances the registered promotions. If tick is true, the
+// caught-up learners' tick counters are advanced.
+func (rn *RawNode) updatePromotions(tick bool) {
+	if len(rn.promotions) == 0 {
+		return
+	}
+	ids := make([]uint64, 0, len(rn.promotions))
+	for id := range rn.promotions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		rn.updatePromotion(rn.promotions[id], tick)
+	}
+}
+
+func (rn *RawNode) updatePromotion(p *LearnerPromotion, tick bool) {
+	r := rn.raft
+	if p.State == PromotionSucceeded || p.State == PromotionFailed {
+		return
+	}
+	if _, ok := r.prs.Voters[0][p.ID]; ok {
+		if len(r.prs.Voters[1]) == 0 {
+			p.State, p.Err = PromotionSucceeded, nil
+		}
+		return
+	}
+	if _, ok := r.prs.Learners[p.ID]; !ok {
+		if _, ok := r.prs.LearnersNext[p.ID]; !ok {
+			p.State, p.Err = PromotionFailed, ErrLearnerRemoved
+			return
+		}
+	}
+
+	if p.State == PromotionProposed {
+		if r.raftLog.applied < p.Index {
+			return
+		}
+		if t, err := r.raftLog.term(p.Index); err == nil && t == p.Term {
+			p.State, p.Err = PromotionFailed, ErrPromotionRejected
+			return
+		}
+		// The proposal was lost, for example in a leadership change. Start
+		// over.
+		p.State, p.Index, p.Term = PromotionWaiting, 0, 0
+	}
+
+	pr := r.prs.Progress[p.ID]
+	lastIndex := r.raftLog.lastIndex()
+	if r.state != StateLeader || pr == nil || !pr.RecentActive || pr.Match+p.Options.MaxLag < lastIndex {
+		p.CaughtUpTicks = 0
+		return
+	}
+	if !tick {
+		return
+	}
+	p.CaughtUpTicks++
+	if p.CaughtUpTicks < p.Options.CaughtUpTicks {
+		return
+	}
+	p.CaughtUpTicks = 0
+
+	cc := pb.ConfChangeV2{
+		Changes: []pb.ConfChangeSingle{{Type: pb.ConfChangeAddNode, NodeID: p.ID}},
+		Context: p.Options.Context,
+	}
+	if p.Options.Joint {
+		cc.Transition = pb.ConfChangeTransitionJointImplicit
+	}
+	m, err := confChangeToMsg(cc)
+	if err != nil {
+		p.State, p.Err = PromotionFailed, err
+		return
+	}
+	if err := r.Step(m); err != nil {
+		p.Err = err
+		return
+	}
+	if res := proposalResults([]pb.Entry{{Type: pb.EntryConfChangeV2}}, m.Entries)[0]; res.Err != nil {
+		p.Err = res.Err
+		return
+	}
+	p.State, p.Index, p.Term, p.Err = PromotionProposed, m.Entries[0].Index, m.Entries[0].Term, nil
+	r.logger.Infof("%x proposed promotion of learner %x at index %d", r.id, p.ID, p.Index)
+}
@@ -55,13 +55,31 @@ func (c JointConfig) CommittedIndex(l AckedIndexer) Index {
 	return idx1
 }
 
+// FaultTolerance returns the number of voters that may fail, in the worst
+// case, without the joint quorum being lost. This is the smaller fault
+// tolerance of the two majorities; an empty majority is ignored, like in
+// CommittedIndex.
+func (c JointConfig) FaultTolerance() int {
+	ft0, ft1 := c[0].FaultTolerance(), c[1].FaultTolerance()
+	switch {
+	case len(c[1]) == 0:
+		return ft0
+	case len(c[0]) == 0, ft1 < ft0:
+		return ft1
+	}
+	return ft0
+}
+
 // VoteResult takes a mapping of voters to yes/no (true/false) votes and returns
 // a result indicating whether the vote is pending, lost, or won. A joint quorum
 // requires both majority quorums to vote in favor.
 func (c JointConfig) VoteResult(votes map[uint64]bool) VoteResult {
-	r1 := c[0].VoteResult(votes)
-	r2 := c[1].VoteResult(votes)
+	return jointVoteResult(c[0].VoteResult(votes), c[1].VoteResult(votes))
+}
 
+// jointVoteResult combines the results of the votes in the two majority
+// configs of a joint config.
+func jointVoteResult(r1, r2 VoteResult) VoteResult {
 	if r1 == r2 {
 		// If they agree, return the agreed state.
 		return r1
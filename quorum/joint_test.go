@@ -0,0 +1,78 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quorum
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bruteForceFaultTolerance returns the largest k such that the voters win any
+// vote in which at most k of them don't vote.
+func bruteForceFaultTolerance(c JointConfig) int {
+	ids := MajorityConfig(c.IDs()).Slice()
+	ft := -1
+	for k := 0; k <= len(ids); k++ {
+		for mask := 0; mask < 1<<len(ids); mask++ {
+			votes := map[uint64]bool{}
+			var failed int
+			for i, id := range ids {
+				if mask&(1<<i) != 0 {
+					failed++
+				} else {
+					votes[id] = true
+				}
+			}
+			if failed == k && c.VoteResult(votes) != VoteWon {
+				return ft
+			}
+		}
+		ft = k
+	}
+	return ft
+}
+
+func TestFaultTolerance(t *testing.T) {
+	mc := func(ids ...uint64) MajorityConfig {
+		c := MajorityConfig{}
+		for _, id := range ids {
+			c[id] = struct{}{}
+		}
+		return c
+	}
+	for _, tt := range []struct {
+		cfg JointConfig
+		exp int
+	}{
+		{JointConfig{}, 0},
+		{JointConfig{mc(1)}, 0},
+		{JointConfig{mc(1, 2)}, 0},
+		{JointConfig{mc(1, 2, 3)}, 1},
+		{JointConfig{mc(1, 2, 3, 4)}, 1},
+		{JointConfig{mc(1, 2, 3, 4, 5)}, 2},
+		{JointConfig{nil, mc(1, 2, 3)}, 1},
+		{JointConfig{mc(1, 2, 3, 4, 5), mc(1, 2, 3)}, 1},
+		{JointConfig{mc(1, 2), mc(3, 4, 5)}, 0},
+		{JointConfig{mc(1, 2, 3), mc(4, 5, 6, 7, 8)}, 1},
+	} {
+		t.Run(tt.cfg.String(), func(t *testing.T) {
+			require.Equal(t, tt.exp, tt.cfg.FaultTolerance())
+			if len(tt.cfg.IDs()) > 0 {
+				require.Equal(t, tt.exp, bruteForceFaultTolerance(tt.cfg))
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quorum
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// LocalityGetter allows looking up the locality of a voter, for example the
+// availability zone it runs in. The empty string denotes an unknown locality.
+type LocalityGetter interface {
+	Locality(voterID uint64) string
+}
+
+type mapLocalityGetter map[uint64]string
+
+func (m mapLocalityGetter) Locality(id uint64) string {
+	return m[id]
+}
+
+// LocalityConfig is a JointConfig whose quorums must, in addition to being
+// majorities, span a minimum number of distinct localities. For example, with
+// voters spread over three availability zones and MinLocalities set to two, an
+// index is only committed once it has been acknowledged by a majority of the
+// voters, which includes voters of at least two zones.
+//
+// The constraint applies to both majority configs of a joint config
+// separately. Voters with an unknown locality count towards the majority, but
+// not towards the localities. If a majority config spans fewer than
+// MinLocalities known localities, all of them are required.
+type LocalityConfig struct {
+	Voters        JointConfig
+	Localities    LocalityGetter
+	MinLocalities int
+}
+
+func (c LocalityConfig) String() string {
+	if c.MinLocalities <= 0 {
+		return c.Voters.String()
+	}
+	return fmt.Sprintf("%s localities>=%d", c.Voters, c.MinLocalities)
+}
+
+// CommittedIndex returns the largest index that is committed in both majority
+// configs, taking into account the locality constraint.
+func (c LocalityConfig) CommittedIndex(l AckedIndexer) Index {
+	if c.MinLocalities <= 0 {
+		return c.Voters.CommittedIndex(l)
+	}
+	idx0 := c.committedIndex(c.Voters[0], l)
+	idx1 := c.committedIndex(c.Voters[1], l)
+	if idx0 < idx1 {
+		return idx0
+	}
+	return idx1
+}
+
+// committedIndex returns the committed index of the given majority config. An
+// index is committed if it is acknowledged by a majority and by voters of the
+// required number of localities. Both hold for all indexes up to a limit, so
+// the committed index is the smaller of the two limits.
+func (c LocalityConfig) committedIndex(mc MajorityConfig, l AckedIndexer) Index {
+	if len(mc) == 0 {
+		return math.MaxUint64
+	}
+	idx := mc.CommittedIndex(l)
+
+	// The largest acknowledged index for each locality.
+	acked := map[string]Index{}
+	for id := range mc {
+		loc := c.Localities.Locality(id)
+		if loc == "" {
+			continue
+		}
+		i, _ := l.AckedIndex(id)
+		if cur, ok := acked[loc]; !ok || i > cur {
+			acked[loc] = i
+		}
+	}
+	n := c.required(len(acked))
+	if n == 0 {
+		return idx
+	}
+	srt := make([]Index, 0, len(acked))
+	for _, i := range acked {
+		srt = append(srt, i)
+	}
+	sort.Slice(srt, func(i, j int) bool { return srt[i] > srt[j] })
+	if bound := srt[n-1]; bound < idx {
+		return bound
+	}
+	return idx
+}
+
+// VoteResult returns the result of the vote in both majority configs, taking
+// into account the locality constraint. A vote is won if it is won by a
+// majority spanning the required number of localities, and lost if that has
+// become impossible.
+func (c LocalityConfig) VoteResult(votes map[uint64]bool) VoteResult {
+	if c.MinLocalities <= 0 {
+		return c.Voters.VoteResult(votes)
+	}
+	return jointVoteResult(c.voteResult(c.Voters[0], votes), c.voteResult(c.Voters[1], votes))
+}
+
+func (c LocalityConfig) voteResult(mc MajorityConfig, votes map[uint64]bool) VoteResult {
+	res := mc.VoteResult(votes)
+	if len(mc) == 0 || res == VoteLost {
+		return res
+	}
+	// The localities of all voters, of those that voted yes, and of those that
+	// voted yes or have not voted yet.
+	known, won, possible := map[string]struct{}{}, map[string]struct{}{}, map[string]struct{}{}
+	for id := range mc {
+		loc := c.Localities.Locality(id)
+		if loc == "" {
+			continue
+		}
+		known[loc] = struct{}{}
+		v, voted := votes[id]
+		if !voted || v {
+			possible[loc] = struct{}{}
+		}
+		if voted && v {
+			won[loc] = struct{}{}
+		}
+	}
+	n := c.required(len(known))
+	if len(possible) < n {
+		return VoteLost
+	}
+	if res == VoteWon && len(won) < n {
+		return VotePending
+	}
+	return res
+}
+
+// required returns the number of localities a quorum must span, given the
+// number of known localities of the voters.
+func (c LocalityConfig) required(known int) int {
+	if c.MinLocalities < known {
+		return c.MinLocalities
+	}
+	return known
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quorum
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testLocalities places voter i in zone i%3, except for every fourth voter,
+// whose locality is unknown.
+type testLocalities struct{}
+
+func (testLocalities) Locality(id uint64) string {
+	if id%4 == 0 {
+		return ""
+	}
+	return fmt.Sprintf("z%d", id%3)
+}
+
+func TestLocalityCommittedIndex(t *testing.T) {
+	// Voters 1-3 are in zone a, 4-5 in zone b, 6 in zone c.
+	locs := mapLocalityGetter{1: "a", 2: "a", 3: "a", 4: "b", 5: "b", 6: "c"}
+	mc := func(ids ...uint64) MajorityConfig {
+		m := MajorityConfig{}
+		for _, id := range ids {
+			m[id] = struct{}{}
+		}
+		return m
+	}
+	for _, tt := range []struct {
+		voters JointConfig
+		min    int
+		acked  mapAckIndexer
+		exp    Index
+	}{
+		// A majority in a single zone is not enough.
+		{JointConfig{mc(1, 2, 3, 4, 5)}, 2, mapAckIndexer{1: 10, 2: 10, 3: 10, 4: 5}, 5},
+		{JointConfig{mc(1, 2, 3, 4, 5)}, 2, mapAckIndexer{1: 10, 2: 10, 3: 10, 4: 10}, 10},
+		{JointConfig{mc(1, 2, 3, 4, 5)}, 0, mapAckIndexer{1: 10, 2: 10, 3: 10, 4: 5}, 10},
+		// Only two zones are known, so requiring three means requiring both.
+		{JointConfig{mc(1, 2, 3, 4, 5)}, 3, mapAckIndexer{1: 10, 2: 10, 4: 7}, 7},
+		// Voters with unknown locality count towards the majority only.
+		{JointConfig{mc(1, 4, 7, 8, 9)}, 2, mapAckIndexer{7: 10, 8: 10, 9: 10, 1: 3}, 0},
+		{JointConfig{mc(1, 4, 7, 8, 9)}, 2, mapAckIndexer{7: 10, 8: 10, 1: 3, 4: 6}, 3},
+		{JointConfig{mc(7, 8, 9)}, 2, mapAckIndexer{7: 10, 8: 10}, 10},
+		// Both halves of a joint config are constrained.
+		{JointConfig{mc(1, 2, 6), mc(1, 2, 3)}, 2, mapAckIndexer{1: 10, 2: 10, 6: 4}, 4},
+		{JointConfig{mc(1, 2, 6), mc(1, 4, 5)}, 2, mapAckIndexer{1: 10, 2: 10, 4: 8, 6: 9}, 8},
+		{JointConfig{}, 2, mapAckIndexer{}, math.MaxUint64},
+	} {
+		t.Run("", func(t *testing.T) {
+			c := LocalityConfig{Voters: tt.voters, Localities: locs, MinLocalities: tt.min}
+			require.Equal(t, tt.exp, c.CommittedIndex(tt.acked), "%s", c)
+		})
+	}
+}
+
+// TestLocalityCommittedIndexQuick compares LocalityConfig.CommittedIndex
+// with a brute-force search for the largest index acknowledged by a
+// sufficiently diverse majority.
+func TestLocalityCommittedIndexQuick(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 5000}
+	for min := 0; min <= 3; min++ {
+		fn1 := func(c memberMap, l idxMap) uint64 {
+			lc := LocalityConfig{Voters: JointConfig{MajorityConfig(c)}, Localities: testLocalities{}, MinLocalities: min}
+			return uint64(lc.CommittedIndex(mapAckIndexer(l)))
+		}
+		fn2 := func(c memberMap, l idxMap) uint64 {
+			return uint64(alternativeLocalityCommittedIndex(MajorityConfig(c), mapAckIndexer(l), testLocalities{}, min))
+		}
+		if err := quick.CheckEqual(fn1, fn2, cfg); err != nil {
+			t.Fatal(min, err)
+		}
+	}
+}
+
+func alternativeLocalityCommittedIndex(c MajorityConfig, l AckedIndexer, locs LocalityGetter, min int) Index {
+	if len(c) == 0 {
+		return math.MaxUint64
+	}
+	known := map[string]bool{}
+	for id := range c {
+		if loc := locs.Locality(id); loc != "" {
+			known[loc] = true
+		}
+	}
+	if min > len(known) {
+		min = len(known)
+	}
+	var best Index
+	for cand := range c {
+		idx, _ := l.AckedIndex(cand)
+		n, zones := 0, map[string]bool{}
+		for id := range c {
+			if i, _ := l.AckedIndex(id); i >= idx {
+				n++
+				if loc := locs.Locality(id); loc != "" {
+					zones[loc] = true
+				}
+			}
+		}
+		if n >= len(c)/2+1 && len(zones) >= min && idx > best {
+			best = idx
+		}
+	}
+	return best
+}
+
+func TestLocalityVoteResult(t *testing.T) {
+	locs := mapLocalityGetter{1: "a", 2: "a", 3: "a", 4: "b", 5: "b"}
+	voters := JointConfig{MajorityConfig{1: {}, 2: {}, 3: {}, 4: {}, 5: {}}}
+	for _, tt := range []struct {
+		votes map[uint64]bool
+		exp   VoteResult
+	}{
+		{map[uint64]bool{1: true, 2: true, 3: true}, VotePending},
+		{map[uint64]bool{1: true, 2: true, 3: true, 4: true}, VoteWon},
+		{map[uint64]bool{1: true, 2: true, 4: true}, VoteWon},
+		{map[uint64]bool{1: true, 2: true, 3: true, 4: false, 5: false}, VoteLost},
+		{map[uint64]bool{1: false, 2: false, 3: false}, VoteLost},
+		{map[uint64]bool{4: true, 5: true}, VotePending},
+	} {
+		c := LocalityConfig{Voters: voters, Localities: locs, MinLocalities: 2}
+		require.Equal(t, tt.exp, c.VoteResult(tt.votes), "%v", tt.votes)
+		c.MinLocalities = 0
+		require.Equal(t, voters.VoteResult(tt.votes), c.VoteResult(tt.votes), "%v", tt.votes)
+	}
+}
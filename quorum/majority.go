@@ -112,6 +112,15 @@ func (c MajorityConfig) Slice() []uint64 {
 	return sl
 }
 
+// FaultTolerance returns the number of voters that may fail without the
+// majority losing quorum. The zero MajorityConfig tolerates no failures.
+func (c MajorityConfig) FaultTolerance() int {
+	if len(c) == 0 {
+		return 0
+	}
+	return (len(c) - 1) / 2
+}
+
 func insertionSort(sl []uint64) {
 	a, b := 0, len(sl)
 	for i := a + 1; i < b; i++ {
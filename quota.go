@@ -0,0 +1,96 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// ProposalQuota describes the capacity of the local node to accept further
+// proposals without dropping them. It allows the application to queue or shed
+// load before proposals are dropped with ProposalDropUncommittedSizeLimit.
+//
+// The quota is only meaningful on the leader, which tracks the uncommitted log
+// tail. On other nodes, proposals are forwarded to (and may be dropped by) the
+// leader identified by Lead, or dropped if there is none. There,
+// UncommittedSize is zero, Available is MaxUncommittedSize regardless of the
+// leader's quota, and Replication is nil.
+type ProposalQuota struct {
+	// Lead is the current leader, or None.
+	Lead uint64
+	// UncommittedSize is the leader's estimate of the byte size of the
+	// uncommitted tail of its log, as limited by
+	// Config.MaxUncommittedEntriesSize.
+	UncommittedSize uint64
+	// MaxUncommittedSize is the effective Config.MaxUncommittedEntriesSize,
+	// math.MaxUint64 if unlimited.
+	MaxUncommittedSize uint64
+	// Available is the number of bytes that can be proposed before proposals
+	// start being dropped. Note that a proposal is never dropped for its size
+	// while the uncommitted tail is empty. Only meaningful on the leader.
+	Available uint64
+	// Throttled is true if the leader has dropped a proposal because of the
+	// uncommitted size limit, and no committed entries have freed up quota
+	// since.
+	Throttled bool
+	// Replication maps each peer (including the leader itself) to its
+	// replication lag. Only populated on the leader.
+	Replication map[uint64]ReplicationLag
+}
+
+// ReplicationLag describes how far a peer trails the leader's log.
+type ReplicationLag struct {
+	// Match is the highest log index known to be replicated to the peer.
+	Match uint64
+	// Entries is the number of log entries that the peer is missing relative
+	// to the leader's last index.
+	Entries uint64
+	// State is the replication state of the peer.
+	State tracker.StateType
+	// RecentActive is tracker.Progress.RecentActive.
+	RecentActive bool
+	// IsLearner is true if the peer is a learner.
+	IsLearner bool
+}
+
+func getProposalQuota(r *raft) ProposalQuota {
+	q := ProposalQuota{
+		Lead:               r.lead,
+		UncommittedSize:    uint64(r.uncommittedSize),
+		MaxUncommittedSize: uint64(r.maxUncommittedSize),
+		Throttled:          r.proposalsThrottled,
+	}
+	if q.UncommittedSize < q.MaxUncommittedSize {
+		q.Available = q.MaxUncommittedSize - q.UncommittedSize
+	}
+	if r.state != StateLeader {
+		return q
+	}
+	lastIndex := r.raftLog.lastIndex()
+	q.Replication = make(map[uint64]ReplicationLag, len(r.prs.Progress))
+	r.prs.Visit(func(id uint64, pr *tracker.Progress) {
+		lag := ReplicationLag{
+			Match:        pr.Match,
+			State:        pr.State,
+			RecentActive: pr.RecentActive,
+			IsLearner:    pr.IsLearner,
+		}
+		if pr.Match < lastIndex {
+			lag.Entries = lastIndex - pr.Match
+		}
+		q.Replication[id] = lag
+	})
+	return q
+}
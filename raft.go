@@ -42,6 +42,14 @@ const (
 	// log entries to the local state machine. The identifier is used as a
 	// target for MsgStorageApply messages when AsyncStorageWrites is enabled.
 	LocalApplyThread uint64 = math.MaxUint64 - 1
+	// LocalFetchThread is a reference to a local thread that reads log entries
+	// from stable storage. It is used as the target for MsgStorageFetch
+	// messages when AsyncStorageReads is enabled.
+	LocalFetchThread uint64 = math.MaxUint64 - 2
+	// LocalSnapshotThread is a reference to a local thread that generates
+	// snapshots. It is used as the target for MsgStorageSnapshot messages when
+	// AsyncSnapshots is enabled.
+	LocalSnapshotThread uint64 = math.MaxUint64 - 3
 )
 
 // Possible values for StateType.
@@ -85,6 +93,93 @@ const noLimit = math.MaxUint64
 // so that the proposer can be notified and fail fast.
 var ErrProposalDropped = errors.New("raft proposal dropped")
 
+// ProposalDropReason describes why a proposal was dropped.
+type ProposalDropReason uint8
+
+// Possible values for ProposalDropReason.
+const (
+	// ProposalDropNoLeader means that the node does not know of a leader in
+	// the current term.
+	ProposalDropNoLeader ProposalDropReason = iota
+	// ProposalDropForwardingDisabled means that the node is a follower which
+	// knows the leader but Config.DisableProposalForwarding is set.
+	ProposalDropForwardingDisabled
+	// ProposalDropLeaderTransfer means that the leader is in the process of
+	// transferring leadership to another node.
+	ProposalDropLeaderTransfer
+	// ProposalDropUncommittedSizeLimit means that appending the proposal would
+	// exceed Config.MaxUncommittedEntriesSize.
+	ProposalDropUncommittedSizeLimit
+	// ProposalDropNotInConfig means that the leader has been removed from the
+	// configuration and no longer accepts proposals.
+	ProposalDropNotInConfig
+	// ProposalDropConfChangeRefused means that a configuration change failed
+	// the leader's propose-time validation (for example, because another one
+	// is still pending) and was replaced by an empty entry. It is only reported
+	// for individual entries of a batch, see ProposalResult.
+	ProposalDropConfChangeRefused
+)
+
+var proposalDropReasonStrings = [...]string{
+	"no leader",
+	"proposal forwarding disabled",
+	"leadership transfer in progress",
+	"uncommitted entry size limit exceeded",
+	"leader not in configuration",
+	"conf change refused",
+}
+
+func (r ProposalDropReason) String() string {
+	if int(r) < len(proposalDropReasonStrings) {
+		return proposalDropReasonStrings[r]
+	}
+	return fmt.Sprintf("ProposalDropReason(%d)", r)
+}
+
+// ProposalDroppedError is returned when a proposal is dropped. It carries the
+// reason for the drop and, if known, the ID of the current leader (or, during a
+// leadership transfer, of the transferee) so that clients can redirect the
+// proposal without consulting Status. It wraps ErrProposalDropped, so
+// errors.Is(err, ErrProposalDropped) holds for every instance.
+type ProposalDroppedError struct {
+	Reason ProposalDropReason
+	// Lead is the leader known to the dropping node, or None.
+	Lead uint64
+	// Transferee is the target of an in-progress leadership transfer. Only set
+	// with ProposalDropLeaderTransfer.
+	Transferee uint64
+}
+
+func (e *ProposalDroppedError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %s", ErrProposalDropped, e.Reason)
+	if e.Lead != None {
+		fmt.Fprintf(&buf, " (lead %x", e.Lead)
+		if e.Transferee != None {
+			fmt.Fprintf(&buf, ", transferee %x", e.Transferee)
+		}
+		buf.WriteString(")")
+	}
+	return buf.String()
+}
+
+// Unwrap returns ErrProposalDropped.
+func (e *ProposalDroppedError) Unwrap() error { return ErrProposalDropped }
+
+// errProposalDropped returns a *ProposalDroppedError for the given reason,
+// annotated with the leader known to r.
+func (r *raft) errProposalDropped(reason ProposalDropReason) error {
+	err := &ProposalDroppedError{Reason: reason, Lead: r.lead}
+	switch reason {
+	case ProposalDropLeaderTransfer:
+		err.Transferee = r.leadTransferee
+	case ProposalDropNotInConfig:
+		// The removed leader is of no use to the client.
+		err.Lead = None
+	}
+	return err
+}
+
 // lockedRand is a small wrapper around rand.Rand to provide
 // synchronization among multiple raft groups. Only the methods needed
 // by the code are exposed (e.g. Intn).
@@ -184,6 +279,38 @@ type Config struct {
 	// write.
 	AsyncStorageWrites bool
 
+	// AsyncStorageReads configures the leader to read the log entries that it
+	// sends to followers from Storage asynchronously, instead of calling
+	// Storage.Entries while stepping a message. It can be enabled with or
+	// without AsyncStorageWrites.
+	//
+	// When true, if a follower needs entries that are neither unstable nor
+	// cached (see MaxEntryCacheSize), the Ready.Message slice includes a
+	// MsgStorageFetch message targeting a LocalFetchThread instead of a MsgApp.
+	// The application reads the requested entries, typically with
+	// FetchEntries, and steps the resulting MsgStorageFetchResp back into the
+	// node, which then sends the MsgApp. Fetch messages can be processed in any
+	// order, but must not be dropped. Storage.Term and Storage.FirstIndex are
+	// still called synchronously, and so are the reads of committed entries to
+	// apply.
+	AsyncStorageReads bool
+
+	// AsyncSnapshots configures the leader to request the snapshots that it
+	// sends to followers from the application, instead of calling
+	// Storage.Snapshot and retrying while it returns
+	// ErrSnapshotTemporarilyUnavailable. It requires the use of RawNode;
+	// StartNode and RestartNode panic if it is set.
+	//
+	// When true, if a follower needs a snapshot, the Ready.Message slice
+	// includes a MsgStorageSnapshot message targeting a LocalSnapshotThread.
+	// Its Vote field is the follower, and its Index field the index that the
+	// snapshot must at least cover for the follower to catch up from the log
+	// afterwards. The application generates the snapshot in the background and
+	// delivers it with RawNode.SnapshotReady, which sends it to the follower.
+	// Until then, no other snapshot is requested for the follower. The
+	// requests count against MaxConcurrentSnapshots.
+	AsyncSnapshots bool
+
 	// MaxSizePerMsg limits the max byte size of each append message. Smaller
 	// value lowers the raft recovery cost(initial probing and message lost
 	// during normal operation). On the other side, it might affect the
@@ -197,10 +324,28 @@ type Config struct {
 	// Ready structs to encompass all outstanding entries in unacknowledged
 	// MsgStorageApply messages when AsyncStorageWrites is enabled.
 	MaxCommittedSizePerReady uint64
+	// MaxEntryCacheSize limits the total byte size of the most recent stable
+	// log entries that are cached in memory, so that they can be sent to
+	// followers or applied without reading them from Storage. Zero disables the
+	// cache. Hits and misses are reported in Status.EntryCache.
+	MaxEntryCacheSize uint64
+	// EntryChecksums makes the leader set a checksum on the entries that it
+	// appends to its log (see pb.Entry.SetChecksum), and the node verify the
+	// checksums of the entries that it receives in MsgApp messages and reads
+	// from Storage. Entries without a checksum are not verified.
+	//
+	// A MsgApp carrying a corrupted entry is rejected, and the leader sends
+	// the entries again. If an entry read from Storage is corrupted, it is
+	// neither sent nor applied, and the node becomes inoperable: Step returns
+	// an *EntryCorruptionError reporting the index of the entry, Tick has no
+	// effect, and BasicStatus.CorruptedIndex is set. The application should
+	// then stop the node and repair its log.
+	EntryChecksums bool
 	// MaxUncommittedEntriesSize limits the aggregate byte size of the
 	// uncommitted entries that may be appended to a leader's log. Once this
 	// limit is exceeded, proposals will begin to return ErrProposalDropped
-	// errors. Note: 0 for no limit.
+	// errors. The remaining quota can be observed via ProposalQuota. Note: 0
+	// for no limit.
 	MaxUncommittedEntriesSize uint64
 	// MaxInflightMsgs limits the max number of in-flight append messages during
 	// optimistic replication phase. The application transportation layer usually
@@ -218,6 +363,57 @@ type Config struct {
 	// throughput limit of 10 MB/s for this group. With RTT of 400ms, this drops
 	// to 2.5 MB/s. See Little's law to understand the maths behind.
 	MaxInflightBytes uint64
+	// AdaptiveInflights makes the leader size the in-flight window of each
+	// follower dynamically, between 1 and MaxInflightMsgs messages. The window
+	// grows while appends are acknowledged promptly, and shrinks when appends
+	// are rejected or their acknowledgement latency (measured in ticks) grows
+	// well beyond the lowest latency observed for that follower. This helps
+	// with heterogeneous links, where no single MaxInflightMsgs suits both
+	// fast and slow followers. MaxInflightBytes still applies as a hard limit.
+	//
+	// The current window of a follower is reported by
+	// tracker.Inflights.Window in Status().Progress.
+	AdaptiveInflights bool
+	// MaxConcurrentSnapshots limits the number of followers that the leader
+	// sends snapshots to at the same time, i.e. the number of followers in
+	// tracker.StateSnapshot. Followers needing a snapshot while the limit is
+	// reached are kept in tracker.StateProbe, and Storage.Snapshot is not
+	// consulted for them. They are queued and receive a snapshot, in the
+	// order in which they were queued, as soon as an in-flight snapshot
+	// completes or fails. Ignored if zero.
+	MaxConcurrentSnapshots int
+	// SnapshotProbeWindow, if non-zero, is the number of entries by which a
+	// follower in tracker.StateProbe may lag behind the leader's last index
+	// and still be caught up from the log. A follower lagging further is sent
+	// a snapshot instead, provided that one covering its Next index is
+	// available. While MaxConcurrentSnapshots is reached, the follower is kept
+	// in StateProbe and caught up from the log, since its entries can still be
+	// served from storage; only followers whose entries have been compacted
+	// are queued for a snapshot.
+	//
+	// A storage snapshot found not to cover a follower is only read again
+	// after the log has been compacted, so applications should compact the
+	// log when they create a snapshot.
+	SnapshotProbeWindow uint64
+	// ReplicationDelegate, if set, allows the leader to delegate the catch-up
+	// of a lagging follower to another follower, for example one in the same
+	// region. It is consulted when the leader is about to probe the follower
+	// identified by to (possibly with a snapshot), and is passed the
+	// followers eligible as delegates: recently active peers in
+	// tracker.StateReplicate whose log already contains the next entry the
+	// lagging follower needs. It returns the chosen delegate, or None to have
+	// the leader replicate directly.
+	//
+	// The delegate is sent a MsgDelegateApp and sends the entries up to its own
+	// acknowledged index (preceded by a snapshot if needed) on the leader's
+	// behalf, one message per MsgDelegateApp; the lagging follower
+	// acknowledges them to the leader directly, which then asks the delegate
+	// for the next one.
+	// The delegation is recorded in tracker.Progress.Delegate. If the delegate
+	// is unable to serve it, or the follower has not caught up to the delegated
+	// index within an election timeout, the leader falls back to direct
+	// replication.
+	ReplicationDelegate func(to uint64, candidates []uint64) uint64
 
 	// CheckQuorum specifies if the leader should check quorum activity. Leader
 	// steps down when quorum is not active for an electionTimeout.
@@ -277,6 +473,49 @@ type Config struct {
 	// See: https://github.com/etcd-io/raft/issues/80
 	DisableConfChangeValidation bool
 
+	// MaxPendingConfChanges limits the number of configuration changes that
+	// the leader lets be pending (in the log, but not yet applied) at a time.
+	// With the default of zero (or one), a configuration change is refused
+	// while another one is pending, which serializes configuration changes on
+	// log application.
+	//
+	// With larger values, the leader instead validates each proposed
+	// configuration change against the configuration that will be in effect
+	// when it is applied, that is, the active configuration with all pending
+	// configuration changes proposed by this leader applied on top. Since the
+	// leader does not know the details of configuration changes that were
+	// pending when it was elected, it accepts none until those have been
+	// applied. Note that raft only leaves a joint configuration automatically
+	// if no configuration change was queued after the one entering it.
+	//
+	// Applications setting this must apply every committed configuration
+	// change, as the validation of later changes relies on the earlier ones
+	// taking effect. If an invalid configuration change gets applied, a panic
+	// will result.
+	//
+	// MaxPendingConfChanges is ignored if DisableConfChangeValidation is set,
+	// since no configuration change is refused then.
+	MaxPendingConfChanges int
+
+	// QuorumLocalities is the number of distinct localities that the quorums
+	// for committing entries and winning elections must span in addition to
+	// being majorities, where the locality of a voter is taken from its
+	// metadata (see pb.NodeMetadata). For example, with voters spread over
+	// three availability zones, a value of two makes entries committed only
+	// once voters in at least two zones have acknowledged them. If the voters
+	// span fewer known localities, all of them are required. Zero disables the
+	// constraint.
+	//
+	// The constraint is not needed for safety, but trades availability for
+	// durability. All voters should use the same value.
+	QuorumLocalities int
+
+	// Observer marks this node as an observer: a peer outside the
+	// configuration to which a leader replicates committed entries only (see
+	// RawNode.AddObserver). Unlike other nodes, an observer accepts snapshots
+	// whose configuration does not include it.
+	Observer bool
+
 	// StepDownOnRemoval makes the leader step down when it is removed from the
 	// group or demoted to a learner.
 	//
@@ -324,6 +563,18 @@ func (c *Config) validate() error {
 		return errors.New("max inflight bytes must be >= max message size")
 	}
 
+	if c.MaxConcurrentSnapshots < 0 {
+		return errors.New("max concurrent snapshots must not be negative")
+	}
+
+	if c.MaxPendingConfChanges < 0 {
+		return errors.New("max pending conf changes must not be negative")
+	}
+
+	if c.QuorumLocalities < 0 {
+		return errors.New("quorum localities must not be negative")
+	}
+
 	if c.Logger == nil {
 		c.Logger = getLogger()
 	}
@@ -348,6 +599,22 @@ type raft struct {
 
 	maxMsgSize         entryEncodingSize
 	maxUncommittedSize entryPayloadSize
+	// maxConcurrentSnapshots is Config.MaxConcurrentSnapshots, see there.
+	maxConcurrentSnapshots int
+	// snapshotProbeWindow is Config.SnapshotProbeWindow, see there.
+	snapshotProbeWindow uint64
+	// lagSnapshotIndex is the index of the snapshot that maybeSendLagSnapshot
+	// last found not to cover a follower's Next index, and
+	// lagSnapshotFirstIndex the first index of the log at the time. Until the
+	// log is compacted, the snapshot is not read again for followers it does
+	// not cover either.
+	lagSnapshotIndex, lagSnapshotFirstIndex uint64
+	// snapshotQueue holds, in FIFO order, the followers that need a snapshot
+	// but could not be sent one because of maxConcurrentSnapshots. Only
+	// maintained by the leader.
+	snapshotQueue []uint64
+	// replicationDelegate is Config.ReplicationDelegate, see there.
+	replicationDelegate func(to uint64, candidates []uint64) uint64
 	// TODO(tbg): rename to trk.
 	prs tracker.ProgressTracker
 
@@ -378,20 +645,43 @@ type raft struct {
 	// leadTransferee is id of the leader transfer target when its value is not zero.
 	// Follow the procedure defined in raft thesis 3.10.
 	leadTransferee uint64
+	// leadTransfer is the last leadership transfer handled by this node. It
+	// stays in progress after stepping down until the new leader is known.
+	// leadTransferSeq is incremented whenever a transfer is started.
+	leadTransfer    LeaderTransfer
+	leadTransferSeq uint64
 	// Only one conf change may be pending (in the log, but not yet
 	// applied) at a time. This is enforced via pendingConfIndex, which
 	// is set to a value >= the log index of the latest pending
 	// configuration change (if any). Config changes are only allowed to
 	// be proposed if the leader's applied index is greater than this
-	// value.
+	// value, unless maxPendingConfChanges allows more to be queued.
 	pendingConfIndex uint64
 	// disableConfChangeValidation is Config.DisableConfChangeValidation,
 	// see there for details.
 	disableConfChangeValidation bool
+	// maxPendingConfChanges is Config.MaxPendingConfChanges. If it is larger
+	// than one and conf change validation is enabled, pendingConfChanges holds
+	// the indexes of the conf changes this leader proposed that may not yet be
+	// applied, and pendingConfig and pendingProgress are the configuration
+	// that results from applying all of them.
+	maxPendingConfChanges int
+	pendingConfChanges    []uint64
+	pendingConfig         tracker.Config
+	pendingProgress       tracker.ProgressMap
+	// observers tracks the replication of committed entries to the observers
+	// attached to this node, see RawNode.AddObserver. Only used on the leader.
+	observers tracker.ProgressMap
+	// observer is Config.Observer.
+	observer bool
 	// an estimate of the size of the uncommitted tail of the Raft log. Used to
 	// prevent unbounded log growth. Only maintained by the leader. Reset on
 	// term changes.
 	uncommittedSize entryPayloadSize
+	// proposalsThrottled is true if a proposal was dropped because it would
+	// have exceeded maxUncommittedSize, and uncommittedSize has not decreased
+	// since. Only maintained by the leader. See ProposalQuota.
+	proposalsThrottled bool
 
 	readOnly *readOnly
 
@@ -417,6 +707,18 @@ type raft struct {
 	disableProposalForwarding bool
 	stepDownOnRemoval         bool
 
+	asyncStorageReads bool
+	// fetches maps the followers waiting for a MsgStorageFetchResp to the
+	// index of the first entry they need. Only maintained by the leader.
+	// Reset on term changes.
+	fetches map[uint64]uint64
+
+	asyncSnapshots bool
+	// snapshotRequests contains the followers for which a snapshot was
+	// requested with a MsgStorageSnapshot, and not delivered yet. Only
+	// maintained by the leader. Reset on term changes.
+	snapshotRequests map[uint64]struct{}
+
 	tick func()
 	step stepFunc
 
@@ -434,11 +736,20 @@ func newRaft(c *Config) *raft {
 		panic(err.Error())
 	}
 	raftlog := newLogWithSize(c.Storage, c.Logger, entryEncodingSize(c.MaxCommittedSizePerReady))
+	raftlog.cache.maxSize = entryEncodingSize(c.MaxEntryCacheSize)
+	raftlog.fetched.maxSize = noLimit
+	raftlog.checksums = c.EntryChecksums
 	hs, cs, err := c.Storage.InitialState()
 	if err != nil {
 		panic(err) // TODO(bdarnell)
 	}
 
+	settings := tracker.Settings{
+		MaxInflight:       c.MaxInflightMsgs,
+		MaxInflightBytes:  c.MaxInflightBytes,
+		AdaptiveInflights: c.AdaptiveInflights,
+		MinLocalities:     c.QuorumLocalities,
+	}
 	r := &raft{
 		id:                          c.ID,
 		lead:                        None,
@@ -446,7 +757,10 @@ func newRaft(c *Config) *raft {
 		raftLog:                     raftlog,
 		maxMsgSize:                  entryEncodingSize(c.MaxSizePerMsg),
 		maxUncommittedSize:          entryPayloadSize(c.MaxUncommittedEntriesSize),
-		prs:                         tracker.MakeProgressTracker(c.MaxInflightMsgs, c.MaxInflightBytes),
+		maxConcurrentSnapshots:      c.MaxConcurrentSnapshots,
+		snapshotProbeWindow:         c.SnapshotProbeWindow,
+		replicationDelegate:         c.ReplicationDelegate,
+		prs:                         tracker.MakeProgressTrackerWithSettings(settings),
 		electionTimeout:             c.ElectionTick,
 		heartbeatTimeout:            c.HeartbeatTick,
 		logger:                      c.Logger,
@@ -455,7 +769,11 @@ func newRaft(c *Config) *raft {
 		readOnly:                    newReadOnly(c.ReadOnlyOption),
 		disableProposalForwarding:   c.DisableProposalForwarding,
 		disableConfChangeValidation: c.DisableConfChangeValidation,
+		maxPendingConfChanges:       c.MaxPendingConfChanges,
+		observer:                    c.Observer,
 		stepDownOnRemoval:           c.StepDownOnRemoval,
+		asyncStorageReads:           c.AsyncStorageReads,
+		asyncSnapshots:              c.AsyncSnapshots,
 	}
 
 	cfg, prs, err := confchange.Restore(confchange.Changer{
@@ -589,15 +907,23 @@ func (r *raft) send(m pb.Message) {
 // sendAppend sends an append RPC with new entries (if any) and the
 // current commit index to the given peer.
 func (r *raft) sendAppend(to uint64) {
-	r.maybeSendAppend(to, true)
+	r.maybeSendAppend(to, true, true /* mayDelegate */)
+}
+
+// sendAppendDirect is like sendAppend, but does not delegate the catch-up of
+// the given peer.
+func (r *raft) sendAppendDirect(to uint64) {
+	r.maybeSendAppend(to, true, false /* mayDelegate */)
 }
 
 // maybeSendAppend sends an append RPC with new entries to the given peer,
 // if necessary. Returns true if a message was sent. The sendIfEmpty
 // argument controls whether messages with no entries will be sent
 // ("empty" messages are useful to convey updated Commit indexes, but
-// are undesirable when we're sending multiple messages in a batch).
-func (r *raft) maybeSendAppend(to uint64, sendIfEmpty bool) bool {
+// are undesirable when we're sending multiple messages in a batch). The
+// mayDelegate argument controls whether the catch-up of a peer in StateProbe
+// may be delegated (see Config.ReplicationDelegate).
+func (r *raft) maybeSendAppend(to uint64, sendIfEmpty, mayDelegate bool) bool {
 	pr := r.prs.Progress[to]
 	if pr.IsPaused() {
 		return false
@@ -606,6 +932,10 @@ func (r *raft) maybeSendAppend(to uint64, sendIfEmpty bool) bool {
 	lastIndex, nextIndex := pr.Next-1, pr.Next
 	lastTerm, errt := r.raftLog.term(lastIndex)
 
+	if mayDelegate && pr.State == tracker.StateProbe && r.maybeDelegate(to, lastTerm, errt) {
+		return true
+	}
+
 	var ents []pb.Entry
 	var erre error
 	// In a throttled StateReplicate only send empty MsgApp, to ensure progress.
@@ -615,7 +945,18 @@ func (r *raft) maybeSendAppend(to uint64, sendIfEmpty bool) bool {
 	// leader to send an append), allowing it to be acked or rejected, both of
 	// which will clear out Inflights.
 	if pr.State != tracker.StateReplicate || !pr.Inflights.Full() {
-		ents, erre = r.raftLog.entries(nextIndex, r.maxMsgSize)
+		if r.asyncStorageReads {
+			ents, erre = r.raftLog.entriesOrFetch(nextIndex, r.maxMsgSize)
+		} else {
+			ents, erre = r.raftLog.entries(nextIndex, r.maxMsgSize)
+		}
+	}
+	if erre == errEntriesNotFetched {
+		r.fetchEntries(to, nextIndex)
+		return false
+	}
+	if errt == nil && erre == nil && r.maybeSendLagSnapshot(to) {
+		return true
 	}
 
 	if len(ents) == 0 && !sendIfEmpty {
@@ -627,7 +968,20 @@ func (r *raft) maybeSendAppend(to uint64, sendIfEmpty bool) bool {
 			r.logger.Debugf("ignore sending snapshot to %x since it is not recently active", to)
 			return false
 		}
+		if _, ok := r.snapshotRequests[to]; ok {
+			return false
+		}
+		if !r.snapshotSlotAvailable() {
+			r.logger.Debugf("%x deferring snapshot to %x since %d snapshots are in flight",
+				r.id, to, r.maxConcurrentSnapshots)
+			r.queueSnapshot(to)
+			return false
+		}
 
+		if r.asyncSnapshots && r.raftLog.unstable.snapshot == nil {
+			r.requestSnapshot(to, r.raftLog.firstIndex()-1)
+			return false
+		}
 		snapshot, err := r.raftLog.snapshot()
 		if err != nil {
 			if err == ErrSnapshotTemporarilyUnavailable {
@@ -636,18 +990,11 @@ func (r *raft) maybeSendAppend(to uint64, sendIfEmpty bool) bool {
 			}
 			panic(err) // TODO(bdarnell)
 		}
-		if IsEmptySnap(snapshot) {
-			panic("need non-empty snapshot")
-		}
-		sindex, sterm := snapshot.Metadata.Index, snapshot.Metadata.Term
-		r.logger.Debugf("%x [firstindex: %d, commit: %d] sent snapshot[index: %d, term: %d] to %x [%s]",
-			r.id, r.raftLog.firstIndex(), r.raftLog.committed, sindex, sterm, to, pr)
-		pr.BecomeSnapshot(sindex)
-		r.logger.Debugf("%x paused sending replication messages to %x [%s]", r.id, to, pr)
-
-		r.send(pb.Message{To: to, Type: pb.MsgSnap, Snapshot: &snapshot})
+		r.sendSnapshot(to, snapshot)
 		return true
 	}
+	// The follower may have been queued for a snapshot it no longer needs.
+	r.dequeueSnapshot(to)
 
 	// Send the actual MsgApp otherwise, and update the progress accordingly.
 	if err := pr.UpdateOnEntriesSend(len(ents), uint64(payloadsSize(ents)), nextIndex); err != nil {
@@ -665,6 +1012,260 @@ func (r *raft) maybeSendAppend(to uint64, sendIfEmpty bool) bool {
 	return true
 }
 
+// lagsBeyondProbeWindow returns whether the given follower is in StateProbe
+// and lags behind the last index by more than snapshotProbeWindow entries.
+func (r *raft) lagsBeyondProbeWindow(pr *tracker.Progress) bool {
+	return r.snapshotProbeWindow > 0 && pr.State == tracker.StateProbe &&
+		r.raftLog.lastIndex() >= pr.Next+r.snapshotProbeWindow
+}
+
+// maybeSendLagSnapshot sends a snapshot to the given follower instead of
+// catching it up from the log, if it lags beyond snapshotProbeWindow and a
+// snapshot slot is available, see Config.SnapshotProbeWindow. With
+// asyncSnapshots, the snapshot is requested and the follower is caught up from
+// the log until it is ready. Returns true if a snapshot was sent.
+func (r *raft) maybeSendLagSnapshot(to uint64) bool {
+	pr := r.prs.Progress[to]
+	if !r.lagsBeyondProbeWindow(pr) || !pr.RecentActive || !r.snapshotSlotAvailable() {
+		return false
+	}
+	if r.asyncSnapshots && r.raftLog.unstable.snapshot == nil {
+		if _, ok := r.snapshotRequests[to]; !ok {
+			r.requestSnapshot(to, pr.Next)
+		}
+		return false
+	}
+	firstIndex := r.raftLog.firstIndex()
+	if r.lagSnapshotFirstIndex == firstIndex && r.lagSnapshotIndex < pr.Next {
+		// Reading the snapshot can be expensive, and it is unlikely to have
+		// changed since the last time it did not help.
+		return false
+	}
+	snapshot, err := r.raftLog.snapshot()
+	if err == ErrSnapshotTemporarilyUnavailable {
+		return false
+	} else if err != nil {
+		panic(err) // TODO(bdarnell)
+	}
+	if snapshot.Metadata.Index < pr.Next {
+		// The snapshot would not help the follower catch up.
+		r.lagSnapshotIndex, r.lagSnapshotFirstIndex = snapshot.Metadata.Index, firstIndex
+		return false
+	}
+	r.logger.Debugf("%x sending snapshot to %x lagging beyond the probe window [next: %d, lastindex: %d]",
+		r.id, to, pr.Next, r.raftLog.lastIndex())
+	r.sendSnapshot(to, snapshot)
+	return true
+}
+
+// maybeDelegate attempts to delegate the catch-up of the given follower, which
+// is in StateProbe, to another follower chosen by replicationDelegate. The
+// arguments are the term of the entry preceding the follower's Next and the
+// error obtained looking it up; if the latter is non-nil, the follower needs a
+// snapshot. Returns true if the catch-up was delegated.
+func (r *raft) maybeDelegate(to uint64, prevTerm uint64, errt error) bool {
+	if r.replicationDelegate == nil {
+		return false
+	}
+	pr := r.prs.Progress[to]
+	// A delegated snapshot takes a slot like one sent directly, see
+	// snapshotSlotAvailable.
+	if errt != nil && (!pr.RecentActive || !r.snapshotSlotAvailable()) {
+		return false
+	}
+	var candidates []uint64
+	r.prs.Visit(func(id uint64, _ *tracker.Progress) {
+		if r.isDelegateCandidate(id, to) {
+			candidates = append(candidates, id)
+		}
+	})
+	if len(candidates) == 0 {
+		return false
+	}
+	delegate := r.replicationDelegate(to, candidates)
+	if delegate == None {
+		return false
+	}
+	if !r.isDelegateCandidate(delegate, to) {
+		r.logger.Warningf("%x ignoring ineligible delegate %x for %x", r.id, delegate, to)
+		return false
+	}
+
+	index := r.prs.Progress[delegate].Match
+	pr.SetDelegate(delegate, index)
+	r.dequeueSnapshot(to)
+	r.logger.Debugf("%x delegated catch-up of %x [%s] to %x", r.id, to, pr, delegate)
+	r.sendDelegateApp(to, pr.Next-1, prevTerm, errt != nil)
+	return true
+}
+
+// continueDelegation asks the delegate of the given follower, which has
+// acknowledged a batch sent by the delegate but has not caught up to the
+// delegated index yet, for the next batch.
+func (r *raft) continueDelegation(to uint64) {
+	pr := r.prs.Progress[to]
+	prevTerm, err := r.raftLog.term(pr.Match)
+	if err != nil {
+		r.logger.Debugf("%x returning %x to direct replication: %v", r.id, to, err)
+		pr.ClearDelegate()
+		return
+	}
+	pr.DelegateElapsed = 0
+	r.sendDelegateApp(to, pr.Match, prevTerm, false /* snap */)
+}
+
+// sendDelegateApp sends a MsgDelegateApp to the delegate of the given
+// follower, asking it to send the next batch of entries following the given
+// index and term, or a snapshot if snap is true.
+func (r *raft) sendDelegateApp(to, prev, prevTerm uint64, snap bool) {
+	pr := r.prs.Progress[to]
+	// The delegate sends the entries in (prev, pr.DelegateIndex], which it has
+	// acknowledged and which thus match our log.
+	app := pb.Message{
+		Type:    pb.MsgApp,
+		To:      to,
+		From:    r.id,
+		Term:    r.Term,
+		Index:   prev,
+		LogTerm: prevTerm,
+		Commit:  r.raftLog.committed,
+	}
+	if snap {
+		app = pb.Message{Type: pb.MsgSnap, To: to, From: r.id, Term: r.Term, Commit: r.raftLog.committed}
+	}
+	pr.DelegateSnapshot = snap
+	r.send(pb.Message{To: pr.Delegate, Type: pb.MsgDelegateApp, Index: pr.DelegateIndex, Responses: []pb.Message{app}})
+}
+
+// isDelegateCandidate returns whether the given peer can be delegated the
+// catch-up of follower to.
+func (r *raft) isDelegateCandidate(id, to uint64) bool {
+	if id == r.id || id == to {
+		return false
+	}
+	pr := r.prs.Progress[id]
+	return pr != nil && pr.State == tracker.StateReplicate && pr.RecentActive &&
+		pr.Delegate == None && pr.Match >= r.prs.Progress[to].Next
+}
+
+// abortDelegations returns all followers whose catch-up was delegated to the
+// given delegate (or to any removed peer, if delegate is None) to direct
+// replication.
+func (r *raft) abortDelegations(delegate uint64) {
+	r.prs.Visit(func(id uint64, pr *tracker.Progress) {
+		if pr.Delegate == None {
+			return
+		}
+		if pr.Delegate == delegate || (delegate == None && r.prs.Progress[pr.Delegate] == nil) {
+			r.logger.Debugf("%x aborted delegated catch-up of %x via %x", r.id, id, pr.Delegate)
+			r.undelegate(id)
+		}
+	})
+}
+
+// tickDelegations falls back to direct replication for followers that were
+// not caught up by their delegate within an election timeout.
+func (r *raft) tickDelegations() {
+	r.prs.Visit(func(id uint64, pr *tracker.Progress) {
+		if pr.Delegate == None {
+			return
+		}
+		pr.DelegateElapsed++
+		if pr.DelegateElapsed >= r.electionTimeout {
+			r.logger.Debugf("%x delegated catch-up of %x via %x timed out", r.id, id, pr.Delegate)
+			r.undelegate(id)
+		}
+	})
+}
+
+// undelegate returns the given follower to direct replication. If its delegate
+// was asked to send a snapshot, the snapshot no longer counts as in flight, and
+// queued snapshots may be sent.
+func (r *raft) undelegate(id uint64) {
+	pr := r.prs.Progress[id]
+	snap := pr.DelegateSnapshot
+	pr.ClearDelegate()
+	r.sendAppendDirect(id)
+	if snap {
+		r.sendQueuedSnapshots()
+	}
+}
+
+// sendSnapshot sends the given snapshot to the given follower, and moves it to
+// StateSnapshot.
+func (r *raft) sendSnapshot(to uint64, snapshot pb.Snapshot) {
+	if IsEmptySnap(snapshot) {
+		panic("need non-empty snapshot")
+	}
+	pr := r.prs.Progress[to]
+	sindex, sterm := snapshot.Metadata.Index, snapshot.Metadata.Term
+	r.logger.Debugf("%x [firstindex: %d, commit: %d] sent snapshot[index: %d, term: %d] to %x [%s]",
+		r.id, r.raftLog.firstIndex(), r.raftLog.committed, sindex, sterm, to, pr)
+	pr.BecomeSnapshot(sindex)
+	r.logger.Debugf("%x paused sending replication messages to %x [%s]", r.id, to, pr)
+	r.dequeueSnapshot(to)
+
+	r.send(pb.Message{To: to, Type: pb.MsgSnap, Snapshot: &snapshot})
+}
+
+// snapshotSlotAvailable returns whether maxConcurrentSnapshots permits sending
+// one more snapshot.
+func (r *raft) snapshotSlotAvailable() bool {
+	if r.maxConcurrentSnapshots == 0 {
+		return true
+	}
+	// Snapshots that are being generated or were delegated count as in flight
+	// too.
+	n := len(r.snapshotRequests)
+	for _, pr := range r.prs.Progress {
+		if pr.State == tracker.StateSnapshot || pr.DelegateSnapshot {
+			n++
+		}
+	}
+	return n < r.maxConcurrentSnapshots
+}
+
+// queueSnapshot appends the given follower to the snapshot queue, unless it is
+// already queued.
+func (r *raft) queueSnapshot(id uint64) {
+	for _, qid := range r.snapshotQueue {
+		if qid == id {
+			return
+		}
+	}
+	r.snapshotQueue = append(r.snapshotQueue, id)
+}
+
+// dequeueSnapshot removes the given follower from the snapshot queue.
+func (r *raft) dequeueSnapshot(id uint64) {
+	for i, qid := range r.snapshotQueue {
+		if qid == id {
+			r.snapshotQueue = append(r.snapshotQueue[:i], r.snapshotQueue[i+1:]...)
+			return
+		}
+	}
+}
+
+// sendQueuedSnapshots attempts to send snapshots to queued followers, in queue
+// order, while maxConcurrentSnapshots permits. It must be called whenever a
+// follower leaves StateSnapshot or is removed.
+func (r *raft) sendQueuedSnapshots() {
+	if len(r.snapshotQueue) == 0 {
+		return
+	}
+	queue := append([]uint64(nil), r.snapshotQueue...)
+	for _, id := range queue {
+		if !r.snapshotSlotAvailable() {
+			return
+		}
+		if _, ok := r.prs.Progress[id]; !ok {
+			r.dequeueSnapshot(id)
+			continue
+		}
+		r.sendAppend(id)
+	}
+}
+
 // sendHeartbeat sends a heartbeat RPC to the given peer.
 func (r *raft) sendHeartbeat(to uint64, ctx []byte) {
 	// Attach the commit as min(to.matched, r.committed).
@@ -693,6 +1294,9 @@ func (r *raft) bcastAppend() {
 		}
 		r.sendAppend(id)
 	})
+	r.visitObservers(func(id uint64, _ *tracker.Progress) {
+		r.maybeSendObserverAppend(id, false /* sendIfEmpty */)
+	})
 }
 
 // bcastHeartbeat sends RPC, without entries to all the peers.
@@ -712,6 +1316,14 @@ func (r *raft) bcastHeartbeatWithCtx(ctx []byte) {
 		}
 		r.sendHeartbeat(id, ctx)
 	})
+	r.visitObservers(func(id uint64, pr *tracker.Progress) {
+		r.send(pb.Message{
+			To:      id,
+			Type:    pb.MsgHeartbeat,
+			Commit:  min(pr.Match, r.raftLog.committed),
+			Context: ctx,
+		})
+	})
 }
 
 func (r *raft) appliedTo(index uint64, size entryEncodingSize) {
@@ -768,6 +1380,8 @@ func (r *raft) reset(term uint64) {
 	r.heartbeatElapsed = 0
 	r.resetRandomizedElectionTimeout()
 
+	// A transfer that is in progress is resolved once the new leader is
+	// known, see maybeResolveLeaderTransfer.
 	r.abortLeaderTransfer()
 
 	r.prs.ResetVotes()
@@ -775,7 +1389,7 @@ func (r *raft) reset(term uint64) {
 		*pr = tracker.Progress{
 			Match:     0,
 			Next:      r.raftLog.lastIndex() + 1,
-			Inflights: tracker.NewInflights(r.prs.MaxInflight, r.prs.MaxInflightBytes),
+			Inflights: r.prs.NewInflights(),
 			IsLearner: pr.IsLearner,
 		}
 		if id == r.id {
@@ -784,7 +1398,15 @@ func (r *raft) reset(term uint64) {
 	})
 
 	r.pendingConfIndex = 0
+	r.pendingConfChanges = nil
+	for id := range r.observers {
+		r.observers[id] = r.newObserverProgress()
+	}
 	r.uncommittedSize = 0
+	r.proposalsThrottled = false
+	r.snapshotQueue = nil
+	r.fetches = nil
+	r.snapshotRequests = nil
 	r.readOnly = newReadOnly(r.readOnly.option)
 }
 
@@ -793,6 +1415,9 @@ func (r *raft) appendEntry(es ...pb.Entry) (accepted bool) {
 	for i := range es {
 		es[i].Term = r.Term
 		es[i].Index = li + 1 + uint64(i)
+		if r.raftLog.checksums {
+			es[i].SetChecksum()
+		}
 	}
 	// Track the size of this uncommitted proposal.
 	if !r.increaseUncommittedSize(es) {
@@ -835,6 +1460,7 @@ func (r *raft) tickElection() {
 func (r *raft) tickHeartbeat() {
 	r.heartbeatElapsed++
 	r.electionElapsed++
+	r.prs.TickInflights()
 
 	if r.electionElapsed >= r.electionTimeout {
 		r.electionElapsed = 0
@@ -845,6 +1471,11 @@ func (r *raft) tickHeartbeat() {
 		}
 		// If current leader cannot transfer leadership in electionTimeout, it becomes leader again.
 		if r.state == StateLeader && r.leadTransferee != None {
+			if pr := r.prs.Progress[r.leadTransferee]; pr != nil && pr.Match < r.raftLog.lastIndex() {
+				r.finishLeaderTransfer(LeaderTransferNotCaughtUp)
+			} else {
+				r.finishLeaderTransfer(LeaderTransferTimedOut)
+			}
 			r.abortLeaderTransfer()
 		}
 	}
@@ -852,6 +1483,7 @@ func (r *raft) tickHeartbeat() {
 	if r.state != StateLeader {
 		return
 	}
+	r.tickDelegations()
 
 	if r.heartbeatElapsed >= r.heartbeatTimeout {
 		r.heartbeatElapsed = 0
@@ -868,6 +1500,7 @@ func (r *raft) becomeFollower(term uint64, lead uint64) {
 	r.lead = lead
 	r.state = StateFollower
 	r.logger.Infof("%x became follower at term %d", r.id, r.Term)
+	r.maybeResolveLeaderTransfer()
 }
 
 func (r *raft) becomeCandidate() {
@@ -881,6 +1514,7 @@ func (r *raft) becomeCandidate() {
 	r.Vote = r.id
 	r.state = StateCandidate
 	r.logger.Infof("%x became candidate at term %d", r.id, r.Term)
+	r.maybeResolveLeaderTransfer()
 }
 
 func (r *raft) becomePreCandidate() {
@@ -897,6 +1531,7 @@ func (r *raft) becomePreCandidate() {
 	r.lead = None
 	r.state = StatePreCandidate
 	r.logger.Infof("%x became pre-candidate at term %d", r.id, r.Term)
+	r.maybeResolveLeaderTransfer()
 }
 
 func (r *raft) becomeLeader() {
@@ -936,6 +1571,7 @@ func (r *raft) becomeLeader() {
 	// quota of the new leader. In other words, after the call to appendEntry,
 	// r.uncommittedSize is still 0.
 	r.logger.Infof("%x became leader at term %d", r.id, r.Term)
+	r.maybeResolveLeaderTransfer()
 }
 
 func (r *raft) hup(t CampaignType) {
@@ -1049,6 +1685,9 @@ func (r *raft) poll(id uint64, t pb.MessageType, v bool) (granted int, rejected
 }
 
 func (r *raft) Step(m pb.Message) error {
+	if r.raftLog.corruption != nil {
+		return r.raftLog.corruption
+	}
 	// Handle the message term, which may result in our stepping down to a follower.
 	switch {
 	case m.Term == 0:
@@ -1077,7 +1716,7 @@ func (r *raft) Step(m pb.Message) error {
 		default:
 			r.logger.Infof("%x [term: %d] received a %s message with higher term from %x [term: %d]",
 				r.id, r.Term, m.Type, m.From, m.Term)
-			if m.Type == pb.MsgApp || m.Type == pb.MsgHeartbeat || m.Type == pb.MsgSnap {
+			if m.Type == pb.MsgApp || m.Type == pb.MsgHeartbeat || m.Type == pb.MsgSnap || m.Type == pb.MsgDelegateApp {
 				r.becomeFollower(m.Term, m.From)
 			} else {
 				r.becomeFollower(m.Term, None)
@@ -1161,6 +1800,9 @@ func (r *raft) Step(m pb.Message) error {
 			r.reduceUncommittedSize(payloadsSize(m.Entries))
 		}
 
+	case pb.MsgStorageFetchResp:
+		r.handleStorageFetchResp(m)
+
 	case pb.MsgVote, pb.MsgPreVote:
 		// We can vote if this is a repeat of a vote we've already cast...
 		canVote := r.Vote == m.From ||
@@ -1240,6 +1882,9 @@ func stepLeader(r *raft, m pb.Message) error {
 				pr.RecentActive = false
 			}
 		})
+		for _, pr := range r.observers {
+			pr.RecentActive = false
+		}
 		return nil
 	case pb.MsgProp:
 		if len(m.Entries) == 0 {
@@ -1249,11 +1894,11 @@ func stepLeader(r *raft, m pb.Message) error {
 			// If we are not currently a member of the range (i.e. this node
 			// was removed from the configuration while serving as leader),
 			// drop any new proposals.
-			return ErrProposalDropped
+			return r.errProposalDropped(ProposalDropNotInConfig)
 		}
 		if r.leadTransferee != None {
 			r.logger.Debugf("%x [term %d] transfer leadership to %x is in progress; dropping proposal", r.id, r.Term, r.leadTransferee)
-			return ErrProposalDropped
+			return r.errProposalDropped(ProposalDropLeaderTransfer)
 		}
 
 		for i := range m.Entries {
@@ -1273,12 +1918,15 @@ func stepLeader(r *raft, m pb.Message) error {
 				cc = ccc
 			}
 			if cc != nil {
+				index := r.raftLog.lastIndex() + uint64(i) + 1
 				alreadyPending := r.pendingConfIndex > r.raftLog.applied
 				alreadyJoint := len(r.prs.Config.Voters[1]) > 0
 				wantsLeaveJoint := len(cc.AsV2().Changes) == 0
 
 				var failedCheck string
-				if alreadyPending {
+				if r.maxPendingConfChanges > 1 && !r.disableConfChangeValidation {
+					failedCheck = r.queueConfChange(cc.AsV2(), index)
+				} else if alreadyPending {
 					failedCheck = fmt.Sprintf("possible unapplied conf change at index %d (applied to %d)", r.pendingConfIndex, r.raftLog.applied)
 				} else if alreadyJoint && !wantsLeaveJoint {
 					failedCheck = "must transition out of joint config first"
@@ -1290,13 +1938,13 @@ func stepLeader(r *raft, m pb.Message) error {
 					r.logger.Infof("%x ignoring conf change %v at config %s: %s", r.id, cc, r.prs.Config, failedCheck)
 					m.Entries[i] = pb.Entry{Type: pb.EntryNormal}
 				} else {
-					r.pendingConfIndex = r.raftLog.lastIndex() + uint64(i) + 1
+					r.pendingConfIndex = index
 				}
 			}
 		}
 
 		if !r.appendEntry(m.Entries...) {
-			return ErrProposalDropped
+			return r.errProposalDropped(ProposalDropUncommittedSizeLimit)
 		}
 		r.bcastAppend()
 		return nil
@@ -1326,6 +1974,18 @@ func stepLeader(r *raft, m pb.Message) error {
 	// All other message types require a progress for m.From (pr).
 	pr := r.prs.Progress[m.From]
 	if pr == nil {
+		if m.Type == pb.MsgTransferLeader {
+			r.logger.Debugf("%x ignored transferring leadership to %x, which is not in the configuration", r.id, m.From)
+			if r.leadTransferee == None {
+				r.startLeaderTransfer(m.From)
+				r.finishLeaderTransfer(LeaderTransferNotVoter)
+			}
+			return nil
+		}
+		if opr := r.observers[m.From]; opr != nil {
+			r.stepObserver(m, opr)
+			return nil
+		}
 		r.logger.Debugf("%x no progress available for %x", r.id, m.From)
 		return nil
 	}
@@ -1459,6 +2119,9 @@ func stepLeader(r *raft, m pb.Message) error {
 			}
 			if pr.MaybeDecrTo(m.Index, nextProbeIdx) {
 				r.logger.Debugf("%x decreased progress of %x to [%s]", r.id, m.From, pr)
+				// A delegate only sends entries that match the follower's log
+				// at the probed index; let the leader take over again.
+				pr.ClearDelegate()
 				if pr.State == tracker.StateReplicate {
 					pr.BecomeProbe()
 				}
@@ -1475,6 +2138,19 @@ func stepLeader(r *raft, m pb.Message) error {
 			// back to replicating state is not useful; besides pr.PendingSnapshot
 			// would prevent it.
 			if pr.MaybeUpdate(m.Index) || (pr.Match == m.Index && pr.State == tracker.StateProbe) {
+				if pr.Delegate != None {
+					// A delegated snapshot has been applied, if there was one.
+					snap := pr.DelegateSnapshot
+					if pr.Match >= pr.DelegateIndex {
+						r.logger.Debugf("%x delegated catch-up of %x via %x completed", r.id, m.From, pr.Delegate)
+						pr.ClearDelegate()
+					} else {
+						r.continueDelegation(m.From)
+					}
+					if snap {
+						r.sendQueuedSnapshots()
+					}
+				}
 				switch {
 				case pr.State == tracker.StateProbe:
 					pr.BecomeReplicate()
@@ -1490,6 +2166,7 @@ func stepLeader(r *raft, m pb.Message) error {
 					// round for a while, exposing an inconsistent RaftStatus).
 					pr.BecomeProbe()
 					pr.BecomeReplicate()
+					r.sendQueuedSnapshots()
 				case pr.State == tracker.StateReplicate:
 					pr.Inflights.FreeLE(m.Index)
 				}
@@ -1511,7 +2188,7 @@ func stepLeader(r *raft, m pb.Message) error {
 				// we have more entries to send, send as many messages as we
 				// can (without sending empty messages for the commit index)
 				if r.id != m.From {
-					for r.maybeSendAppend(m.From, false /* sendIfEmpty */) {
+					for r.maybeSendAppend(m.From, false /* sendIfEmpty */, true /* mayDelegate */) {
 					}
 				}
 				// Transfer leadership is in progress.
@@ -1578,6 +2255,7 @@ func stepLeader(r *raft, m pb.Message) error {
 		// out the next MsgApp.
 		// If snapshot failure, wait for a heartbeat interval before next try
 		pr.MsgAppFlowPaused = true
+		r.sendQueuedSnapshots()
 	case pb.MsgUnreachable:
 		// During optimistic replication, if the remote becomes unreachable,
 		// there is huge probability that a MsgApp is lost.
@@ -1585,9 +2263,24 @@ func stepLeader(r *raft, m pb.Message) error {
 			pr.BecomeProbe()
 		}
 		r.logger.Debugf("%x failed to send message to %x because it is unreachable [%s]", r.id, m.From, pr)
+		r.abortDelegations(m.From)
+	case pb.MsgDelegateAppResp:
+		if len(m.Responses) != 1 {
+			r.logger.Errorf("%x invalid format of MsgDelegateAppResp from %x", r.id, m.From)
+			return nil
+		}
+		to := m.Responses[0].To
+		if tpr := r.prs.Progress[to]; tpr != nil && tpr.Delegate == m.From {
+			r.logger.Debugf("%x delegate %x refused catch-up of %x", r.id, m.From, to)
+			r.undelegate(to)
+		}
 	case pb.MsgTransferLeader:
 		if pr.IsLearner {
 			r.logger.Debugf("%x is learner. Ignored transferring leadership", r.id)
+			if r.leadTransferee == None {
+				r.startLeaderTransfer(m.From)
+				r.finishLeaderTransfer(LeaderTransferNotVoter)
+			}
 			return nil
 		}
 		leadTransferee := m.From
@@ -1598,11 +2291,14 @@ func stepLeader(r *raft, m pb.Message) error {
 					r.id, r.Term, leadTransferee, leadTransferee)
 				return nil
 			}
+			r.finishLeaderTransfer(LeaderTransferAborted)
 			r.abortLeaderTransfer()
 			r.logger.Infof("%x [term %d] abort previous transferring leadership to %x", r.id, r.Term, lastLeadTransferee)
 		}
+		r.startLeaderTransfer(leadTransferee)
 		if leadTransferee == r.id {
 			r.logger.Debugf("%x is already leader. Ignored transferring leadership to self", r.id)
+			r.finishLeaderTransfer(LeaderTransferSucceeded)
 			return nil
 		}
 		// Transfer leadership to third party.
@@ -1635,7 +2331,7 @@ func stepCandidate(r *raft, m pb.Message) error {
 	switch m.Type {
 	case pb.MsgProp:
 		r.logger.Infof("%x no leader at term %d; dropping proposal", r.id, r.Term)
-		return ErrProposalDropped
+		return r.errProposalDropped(ProposalDropNoLeader)
 	case pb.MsgApp:
 		r.becomeFollower(m.Term, m.From) // always m.Term == r.Term
 		r.handleAppendEntries(m)
@@ -1645,6 +2341,9 @@ func stepCandidate(r *raft, m pb.Message) error {
 	case pb.MsgSnap:
 		r.becomeFollower(m.Term, m.From) // always m.Term == r.Term
 		r.handleSnapshot(m)
+	case pb.MsgDelegateApp:
+		r.becomeFollower(m.Term, m.From) // always m.Term == r.Term
+		r.handleDelegateApp(m)
 	case myVoteRespType:
 		gr, rj, res := r.poll(m.From, m.Type, !m.Reject)
 		r.logger.Infof("%x has received %d %s votes and %d vote rejections", r.id, gr, m.Type, rj)
@@ -1672,10 +2371,10 @@ func stepFollower(r *raft, m pb.Message) error {
 	case pb.MsgProp:
 		if r.lead == None {
 			r.logger.Infof("%x no leader at term %d; dropping proposal", r.id, r.Term)
-			return ErrProposalDropped
+			return r.errProposalDropped(ProposalDropNoLeader)
 		} else if r.disableProposalForwarding {
 			r.logger.Infof("%x not forwarding to leader %x at term %d; dropping proposal", r.id, r.lead, r.Term)
-			return ErrProposalDropped
+			return r.errProposalDropped(ProposalDropForwardingDisabled)
 		}
 		m.To = r.lead
 		r.send(m)
@@ -1691,6 +2390,10 @@ func stepFollower(r *raft, m pb.Message) error {
 		r.electionElapsed = 0
 		r.lead = m.From
 		r.handleSnapshot(m)
+	case pb.MsgDelegateApp:
+		r.electionElapsed = 0
+		r.lead = m.From
+		r.handleDelegateApp(m)
 	case pb.MsgTransferLeader:
 		if r.lead == None {
 			r.logger.Infof("%x no leader at term %d; dropping leader transfer msg", r.id, r.Term)
@@ -1727,6 +2430,7 @@ func stepFollower(r *raft, m pb.Message) error {
 		}
 		r.readStates = append(r.readStates, ReadState{Index: m.Index, RequestCtx: m.Entries[0].Data})
 	}
+	r.maybeResolveLeaderTransfer()
 	return nil
 }
 
@@ -1735,12 +2439,18 @@ func (r *raft) handleAppendEntries(m pb.Message) {
 		r.send(pb.Message{To: m.From, Type: pb.MsgAppResp, Index: r.raftLog.committed})
 		return
 	}
-	if mlastIndex, ok := r.raftLog.maybeAppend(m.Index, m.LogTerm, m.Commit, m.Entries...); ok {
+	if ents := r.raftLog.verify(m.Entries); len(ents) < len(m.Entries) {
+		// The entries were corrupted in transit. Reject the message so that
+		// the leader sends them again.
+		r.logger.Warningf("%x rejected MsgApp [logterm: %d, index: %d] from %x with corrupted entry %d",
+			r.id, m.LogTerm, m.Index, m.From, m.Entries[len(ents)].Index)
+	} else if mlastIndex, ok := r.raftLog.maybeAppend(m.Index, m.LogTerm, m.Commit, m.Entries...); ok {
 		r.send(pb.Message{To: m.From, Type: pb.MsgAppResp, Index: mlastIndex})
 		return
+	} else {
+		r.logger.Debugf("%x [logterm: %d, index: %d] rejected MsgApp [logterm: %d, index: %d] from %x",
+			r.id, r.raftLog.zeroTermOnOutOfBounds(r.raftLog.term(m.Index)), m.Index, m.LogTerm, m.Index, m.From)
 	}
-	r.logger.Debugf("%x [logterm: %d, index: %d] rejected MsgApp [logterm: %d, index: %d] from %x",
-		r.id, r.raftLog.zeroTermOnOutOfBounds(r.raftLog.term(m.Index)), m.Index, m.LogTerm, m.Index, m.From)
 
 	// Our log does not match the leader's at index m.Index. Return a hint to the
 	// leader - a guess on the maximal (index, term) at which the logs match. Do
@@ -1837,7 +2547,7 @@ func (r *raft) restore(s pb.Snapshot) bool {
 			break
 		}
 	}
-	if !found {
+	if !found && !r.observer {
 		r.logger.Warningf(
 			"%x attempted to restore snapshot but it is not in the ConfState %v; should never happen",
 			r.id, cs,
@@ -1857,7 +2567,7 @@ func (r *raft) restore(s pb.Snapshot) bool {
 	r.raftLog.restore(s)
 
 	// Reset the configuration and add the (potentially updated) peers in anew.
-	r.prs = tracker.MakeProgressTracker(r.prs.MaxInflight, r.prs.MaxInflightBytes)
+	r.prs = tracker.MakeProgressTrackerWithSettings(r.prs.Settings)
 	cfg, prs, err := confchange.Restore(confchange.Changer{
 		Tracker:   r.prs,
 		LastIndex: r.raftLog.lastIndex(),
@@ -1871,14 +2581,90 @@ func (r *raft) restore(s pb.Snapshot) bool {
 
 	assertConfStatesEquivalent(r.logger, cs, r.switchToConfig(cfg, prs))
 
-	pr := r.prs.Progress[r.id]
-	pr.MaybeUpdate(pr.Next - 1) // TODO(tbg): this is untested and likely unneeded
+	// An observer is not part of the configuration.
+	if pr := r.prs.Progress[r.id]; pr != nil {
+		pr.MaybeUpdate(pr.Next - 1) // TODO(tbg): this is untested and likely unneeded
+	}
 
 	r.logger.Infof("%x [commit: %d, lastindex: %d, lastterm: %d] restored snapshot [index: %d, term: %d]",
 		r.id, r.raftLog.committed, r.raftLog.lastIndex(), r.raftLog.lastTerm(), s.Metadata.Index, s.Metadata.Term)
 	return true
 }
 
+// handleDelegateApp sends, on behalf of the leader, the next batch of the
+// catch-up described by a MsgDelegateApp to the follower being caught up. The
+// single message in m.Responses is a MsgApp (or a MsgSnap, if the follower
+// needs a snapshot) addressed to that follower, and m.Index is the last index
+// to send. Only one message is sent per request: a snapshot, or entries up to
+// maxMsgSize. The leader asks for the next batch once the follower has
+// acknowledged this one. If the local log cannot serve the request, a
+// rejecting MsgDelegateAppResp is returned to the leader.
+func (r *raft) handleDelegateApp(m pb.Message) {
+	if len(m.Responses) != 1 {
+		r.logger.Errorf("%x invalid format of MsgDelegateApp from %x", r.id, m.From)
+		return
+	}
+	app := m.Responses[0]
+	reject := func(reason string) {
+		r.logger.Debugf("%x refusing to catch up %x on behalf of %x: %s", r.id, app.To, m.From, reason)
+		r.send(pb.Message{To: m.From, Type: pb.MsgDelegateAppResp, Reject: true, Responses: []pb.Message{app}})
+	}
+	if app.To == r.id || app.Term != m.Term {
+		reject("invalid request")
+		return
+	}
+	last := min(m.Index, r.raftLog.lastIndex())
+	if last < m.Index {
+		reject("log too short")
+		return
+	}
+
+	prev, prevTerm := app.Index, app.LogTerm
+	needSnap := app.Type == pb.MsgSnap
+	if !needSnap {
+		t, err := r.raftLog.term(prev)
+		if err == ErrCompacted {
+			needSnap = true
+		} else if err != nil || t != prevTerm {
+			reject(fmt.Sprintf("no entry (index %d, term %d)", prev, prevTerm))
+			return
+		}
+	}
+	// The messages are authored by the leader, so they are appended to r.msgs
+	// directly instead of going through r.send. Entries up to m.Index are
+	// stable since they were acknowledged.
+	if needSnap {
+		snap, err := r.raftLog.snapshot()
+		if err != nil || IsEmptySnap(snap) {
+			reject("snapshot unavailable")
+			return
+		}
+		prev, prevTerm = snap.Metadata.Index, snap.Metadata.Term
+		r.msgs = append(r.msgs, pb.Message{
+			Type: pb.MsgSnap, To: app.To, From: app.From, Term: app.Term, Snapshot: &snap,
+		})
+		return
+	}
+	if prev >= last {
+		return
+	}
+	ents, err := r.raftLog.slice(prev+1, last+1, r.maxMsgSize)
+	if err != nil {
+		r.logger.Errorf("%x failed to read entries (%d, %d] for %x: %v", r.id, prev, last, app.To, err)
+		return
+	}
+	r.msgs = append(r.msgs, pb.Message{
+		Type:    pb.MsgApp,
+		To:      app.To,
+		From:    app.From,
+		Term:    app.Term,
+		Index:   prev,
+		LogTerm: prevTerm,
+		Entries: ents,
+		Commit:  app.Commit,
+	})
+}
+
 // promotable indicates whether state machine can be promoted to leader,
 // which is true when its own id is in progress list.
 func (r *raft) promotable() bool {
@@ -1887,18 +2673,10 @@ func (r *raft) promotable() bool {
 }
 
 func (r *raft) applyConfChange(cc pb.ConfChangeV2) pb.ConfState {
-	cfg, prs, err := func() (tracker.Config, tracker.ProgressMap, error) {
-		changer := confchange.Changer{
-			Tracker:   r.prs,
-			LastIndex: r.raftLog.lastIndex(),
-		}
-		if cc.LeaveJoint() {
-			return changer.LeaveJoint()
-		} else if autoLeave, ok := cc.EnterJoint(); ok {
-			return changer.EnterJoint(autoLeave, cc.Changes...)
-		}
-		return changer.Simple(cc.Changes...)
-	}()
+	cfg, prs, err := changeConfig(confchange.Changer{
+		Tracker:   r.prs,
+		LastIndex: r.raftLog.lastIndex(),
+	}, cc)
 
 	if err != nil {
 		// TODO(tbg): return the error to the caller.
@@ -1908,6 +2686,53 @@ func (r *raft) applyConfChange(cc pb.ConfChangeV2) pb.ConfState {
 	return r.switchToConfig(cfg, prs)
 }
 
+func changeConfig(changer confchange.Changer, cc pb.ConfChangeV2) (tracker.Config, tracker.ProgressMap, error) {
+	if cc.LeaveJoint() {
+		return changer.LeaveJoint()
+	} else if autoLeave, ok := cc.EnterJoint(); ok {
+		return changer.EnterJoint(autoLeave, cc.Changes...)
+	}
+	return changer.Simple(cc.Changes...)
+}
+
+// queueConfChange validates a conf change about to be appended to the log at
+// the given index against the configuration that will be in effect when it is
+// applied, and records it as pending. It returns the reason for refusing the
+// conf change, if any. Only used if maxPendingConfChanges is larger than one
+// and conf change validation is enabled.
+func (r *raft) queueConfChange(cc pb.ConfChangeV2, index uint64) string {
+	applied := r.raftLog.applied
+	n := 0
+	for _, idx := range r.pendingConfChanges {
+		if idx > applied {
+			r.pendingConfChanges[n] = idx
+			n++
+		}
+	}
+	r.pendingConfChanges = r.pendingConfChanges[:n]
+	if n == 0 && r.pendingConfIndex > applied {
+		return fmt.Sprintf("possible unapplied conf change at index %d (applied to %d)", r.pendingConfIndex, applied)
+	}
+	if n >= r.maxPendingConfChanges {
+		return fmt.Sprintf("%d conf changes pending (applied to %d)", n, applied)
+	}
+
+	trk := r.prs
+	if n > 0 {
+		trk.Config, trk.Progress = r.pendingConfig, r.pendingProgress
+	}
+	cfg, prs, err := changeConfig(confchange.Changer{
+		Tracker:   trk,
+		LastIndex: r.raftLog.lastIndex(),
+	}, cc)
+	if err != nil {
+		return err.Error()
+	}
+	r.pendingConfig, r.pendingProgress = cfg, prs
+	r.pendingConfChanges = append(r.pendingConfChanges, index)
+	return ""
+}
+
 // switchToConfig reconfigures this node to use the provided configuration. It
 // updates the in-memory state and, when necessary, carries out additional
 // actions such as reacting to the removal of nodes or changed quorum
@@ -1919,6 +2744,12 @@ func (r *raft) switchToConfig(cfg tracker.Config, prs tracker.ProgressMap) pb.Co
 	r.prs.Progress = prs
 
 	r.logger.Infof("%x switched to configuration %s", r.id, r.prs.Config)
+	for id := range r.observers {
+		if _, ok := r.prs.Progress[id]; ok {
+			r.logger.Infof("%x detached observer %x, which joined the configuration", r.id, id)
+			delete(r.observers, id)
+		}
+	}
 	cs := r.prs.ConfState()
 	pr, ok := r.prs.Progress[r.id]
 
@@ -1959,11 +2790,20 @@ func (r *raft) switchToConfig(cfg tracker.Config, prs tracker.ProgressMap) pb.Co
 			if id == r.id {
 				return
 			}
-			r.maybeSendAppend(id, false /* sendIfEmpty */)
+			r.maybeSendAppend(id, false /* sendIfEmpty */, true /* mayDelegate */)
 		})
 	}
+	// Removed followers may have held a snapshot slot or been queued for one.
+	for id := range r.snapshotRequests {
+		if _, ok := r.prs.Progress[id]; !ok {
+			delete(r.snapshotRequests, id)
+		}
+	}
+	r.sendQueuedSnapshots()
+	r.abortDelegations(None)
 	// If the leadTransferee was removed or demoted, abort the leadership transfer.
 	if _, tOK := r.prs.Config.Voters.IDs()[r.leadTransferee]; !tOK && r.leadTransferee != 0 {
+		r.finishLeaderTransfer(LeaderTransferNotVoter)
 		r.abortLeaderTransfer()
 	}
 
@@ -2041,6 +2881,7 @@ func (r *raft) increaseUncommittedSize(ents []pb.Entry) bool {
 		// appending single empty entries to the log always succeeds, used both
 		// for replicating a new leader's initial empty entry, and for
 		// auto-leaving joint configurations.
+		r.proposalsThrottled = true
 		return false
 	}
 	r.uncommittedSize += s
@@ -2050,6 +2891,9 @@ func (r *raft) increaseUncommittedSize(ents []pb.Entry) bool {
 // reduceUncommittedSize accounts for the newly committed entries by decreasing
 // the uncommitted entry size limit.
 func (r *raft) reduceUncommittedSize(s entryPayloadSize) {
+	if s > 0 {
+		r.proposalsThrottled = false
+	}
 	if s > r.uncommittedSize {
 		// uncommittedSize may underestimate the size of the uncommitted Raft
 		// log tail but will never overestimate it. Saturate at 0 instead of
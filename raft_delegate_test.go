@@ -0,0 +1,273 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// sentMsg is a message along with the peer that actually sent it, which for
+// delegated replication differs from m.From.
+type sentMsg struct {
+	by uint64
+	m  pb.Message
+}
+
+// delegateCluster is a three-node group in which the leader delegates the
+// catch-up of node 3 to node 2.
+type delegateCluster struct {
+	peers map[uint64]*raft
+	down  map[uint64]bool
+	sent  []sentMsg
+}
+
+func newDelegateCluster() *delegateCluster {
+	c := &delegateCluster{peers: map[uint64]*raft{}, down: map[uint64]bool{}}
+	for id := uint64(1); id <= 3; id++ {
+		cfg := newTestConfig(id, 10, 1, newTestMemoryStorage(withPeers(1, 2, 3)))
+		cfg.ReplicationDelegate = func(to uint64, candidates []uint64) uint64 {
+			for _, id := range candidates {
+				if to == 3 && id == 2 {
+					return id
+				}
+			}
+			return None
+		}
+		c.peers[id] = newRaft(cfg)
+	}
+	return c
+}
+
+// deliver delivers messages until the cluster is quiescent, dropping those
+// from or to nodes that are down.
+func (c *delegateCluster) deliver() {
+	for {
+		var msgs []sentMsg
+		for id := uint64(1); id <= 3; id++ {
+			for _, m := range c.peers[id].readMessages() {
+				msgs = append(msgs, sentMsg{by: id, m: m})
+			}
+		}
+		if len(msgs) == 0 {
+			return
+		}
+		for _, sm := range msgs {
+			if c.down[sm.by] || c.down[sm.m.To] {
+				continue
+			}
+			c.sent = append(c.sent, sm)
+			_ = c.peers[sm.m.To].Step(sm.m)
+		}
+	}
+}
+
+// catchUpSenders returns the senders of the non-empty MsgApps sent to node 3.
+func (c *delegateCluster) catchUpSenders() []uint64 {
+	var by []uint64
+	for _, sm := range c.sent {
+		if sm.m.To == 3 && sm.m.Type == pb.MsgApp && len(sm.m.Entries) > 0 {
+			by = append(by, sm.by)
+		}
+	}
+	return by
+}
+
+// setup elects node 1 while node 3 is down, appends a few entries, and brings
+// node 3 back.
+func (c *delegateCluster) setup(t *testing.T) {
+	c.down[3] = true
+	require.NoError(t, c.peers[1].Step(pb.Message{From: 1, To: 1, Type: pb.MsgHup}))
+	c.deliver()
+	require.Equal(t, StateLeader, c.peers[1].state)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.peers[1].Step(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{Data: []byte("x")}}}))
+	}
+	c.deliver()
+	c.down[3] = false
+	c.sent = nil
+}
+
+// TestDelegateReplication verifies that the leader delegates the catch-up of a
+// lagging follower to the follower chosen by Config.ReplicationDelegate, and
+// that the lagging follower is caught up by the delegate.
+func TestDelegateReplication(t *testing.T) {
+	c := newDelegateCluster()
+	c.setup(t)
+	lead := c.peers[1]
+
+	require.NoError(t, lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgBeat}))
+	c.deliver()
+
+	var delegated bool
+	for _, sm := range c.sent {
+		if sm.m.Type == pb.MsgDelegateApp {
+			require.Equal(t, uint64(2), sm.m.To)
+			require.Equal(t, lead.raftLog.lastIndex(), sm.m.Index)
+			delegated = true
+		}
+	}
+	require.True(t, delegated)
+	require.Equal(t, []uint64{2}, c.catchUpSenders())
+
+	pr := lead.prs.Progress[3]
+	require.Equal(t, uint64(None), pr.Delegate)
+	require.Equal(t, tracker.StateReplicate, pr.State)
+	require.Equal(t, lead.raftLog.lastIndex(), pr.Match)
+	require.Equal(t, lead.raftLog.lastIndex(), c.peers[3].raftLog.lastIndex())
+	require.Equal(t, uint64(1), c.peers[3].lead)
+}
+
+// TestDelegateReplicationTimeout verifies that the leader falls back to direct
+// replication if the delegate does not catch up the follower within an
+// election timeout.
+func TestDelegateReplicationTimeout(t *testing.T) {
+	c := newDelegateCluster()
+	c.setup(t)
+	lead := c.peers[1]
+
+	c.down[2] = true
+	require.NoError(t, lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgBeat}))
+	c.deliver()
+	pr := lead.prs.Progress[3]
+	require.Equal(t, uint64(2), pr.Delegate)
+	require.Empty(t, c.catchUpSenders())
+
+	for i := 0; i < lead.electionTimeout-1; i++ {
+		lead.tick()
+		c.deliver()
+	}
+	require.Equal(t, uint64(2), pr.Delegate)
+	require.Empty(t, c.catchUpSenders())
+
+	lead.tick()
+	c.deliver()
+	require.Equal(t, uint64(None), pr.Delegate)
+	require.Equal(t, []uint64{1}, c.catchUpSenders())
+	require.Equal(t, lead.raftLog.lastIndex(), pr.Match)
+}
+
+// TestDelegateReplicationRefused verifies that the leader replicates directly
+// if the delegate cannot serve the catch-up.
+func TestDelegateReplicationRefused(t *testing.T) {
+	c := newDelegateCluster()
+	c.setup(t)
+	lead := c.peers[1]
+
+	// Ask for a probe at an index the delegate has a different term for.
+	pr := lead.prs.Progress[3]
+	require.NoError(t, lead.Step(pb.Message{From: 3, To: 1, Type: pb.MsgHeartbeatResp}))
+	msgs := lead.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgDelegateApp, msgs[0].Type)
+	msgs[0].Responses[0].LogTerm++
+	require.NoError(t, c.peers[2].Step(msgs[0]))
+	c.deliver()
+
+	require.Equal(t, uint64(None), pr.Delegate)
+	require.Equal(t, []uint64{1}, c.catchUpSenders())
+	require.Equal(t, lead.raftLog.lastIndex(), pr.Match)
+}
+
+// TestDelegateReplicationBatches verifies that a delegate sends a single
+// message per MsgDelegateApp, and that the leader asks it for the next batch
+// once the lagging follower has acknowledged the previous one.
+func TestDelegateReplicationBatches(t *testing.T) {
+	c := newDelegateCluster()
+	c.setup(t)
+	lead := c.peers[1]
+	// Limit the delegate to one entry per message.
+	c.peers[2].maxMsgSize = 1
+
+	require.NoError(t, lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgBeat}))
+	c.deliver()
+
+	var requests int
+	for _, sm := range c.sent {
+		if sm.m.Type == pb.MsgDelegateApp {
+			requests++
+		}
+	}
+	senders := c.catchUpSenders()
+	require.Greater(t, len(senders), 1)
+	require.Equal(t, len(senders), requests)
+	for _, by := range senders {
+		require.Equal(t, uint64(2), by)
+	}
+
+	pr := lead.prs.Progress[3]
+	require.Equal(t, uint64(None), pr.Delegate)
+	require.Equal(t, lead.raftLog.lastIndex(), pr.Match)
+	require.Equal(t, lead.raftLog.lastIndex(), c.peers[3].raftLog.lastIndex())
+}
+
+// TestDelegateReplicationSnapshotLimit verifies that a snapshot sent by a
+// delegate counts towards MaxConcurrentSnapshots, and that no snapshot is
+// delegated while the limit is reached.
+func TestDelegateReplicationSnapshotLimit(t *testing.T) {
+	storage := newTestMemoryStorage(withPeers(1, 2, 3, 4))
+	for i := uint64(1); i <= 10; i++ {
+		require.NoError(t, storage.Append([]pb.Entry{{Index: i, Term: 1}}))
+	}
+	cs := pb.ConfState{Voters: []uint64{1, 2, 3, 4}}
+	_, err := storage.CreateSnapshot(5, &cs, nil)
+	require.NoError(t, err)
+	require.NoError(t, storage.Compact(5))
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.MaxConcurrentSnapshots = 1
+	cfg.ReplicationDelegate = func(to uint64, candidates []uint64) uint64 { return 2 }
+	sm := newRaft(cfg)
+	sm.becomeCandidate()
+	sm.becomeLeader()
+	sm.readMessages()
+
+	pr2 := sm.prs.Progress[2]
+	pr2.BecomeReplicate()
+	pr2.MaybeUpdate(sm.raftLog.lastIndex())
+	pr2.RecentActive = true
+	for _, id := range []uint64{3, 4} {
+		sm.prs.Progress[id].Next = 2
+		sm.prs.Progress[id].RecentActive = true
+	}
+
+	// The snapshot for 3 is delegated and takes the only slot.
+	sm.sendAppend(3)
+	msgs := sm.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgDelegateApp, msgs[0].Type)
+	require.Equal(t, pb.MsgSnap, msgs[0].Responses[0].Type)
+	require.True(t, sm.prs.Progress[3].DelegateSnapshot)
+
+	// 4 is queued rather than delegated.
+	sm.sendAppend(4)
+	require.Empty(t, sm.readMessages())
+	require.Equal(t, []uint64{4}, sm.snapshotQueue)
+	require.Equal(t, uint64(None), sm.prs.Progress[4].Delegate)
+
+	// Once 3 has applied the snapshot, its delegate is asked for entries, and
+	// the snapshot for 4 is delegated.
+	require.NoError(t, sm.Step(pb.Message{From: 3, To: 1, Term: sm.Term, Type: pb.MsgAppResp, Index: 5}))
+	msgs = sm.readMessages()
+	require.Len(t, msgs, 2)
+	require.Equal(t, pb.MsgApp, msgs[0].Responses[0].Type)
+	require.Equal(t, uint64(3), msgs[0].Responses[0].To)
+	require.Equal(t, pb.MsgSnap, msgs[1].Responses[0].Type)
+	require.Equal(t, uint64(4), msgs[1].Responses[0].To)
+	require.Empty(t, sm.snapshotQueue)
+}
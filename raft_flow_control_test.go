@@ -15,6 +15,7 @@
 package raft
 
 import (
+	"strings"
 	"testing"
 
 	pb "go.etcd.io/raft/v3/raftpb"
@@ -150,3 +151,54 @@ func TestMsgAppFlowControlRecvHeartbeat(t *testing.T) {
 		r.readMessages()
 	}
 }
+
+// TestMsgAppFlowControlAdaptive ensures that with Config.AdaptiveInflights the
+// inflight window of a follower starts small, grows as appends are acked,
+// shrinks on rejections, and is reported in Status.
+func TestMsgAppFlowControlAdaptive(t *testing.T) {
+	cfg := newTestConfig(1, 5, 1, newTestMemoryStorage(withPeers(1, 2)))
+	cfg.AdaptiveInflights = true
+	r := newRaft(cfg)
+	r.becomeCandidate()
+	r.becomeLeader()
+
+	pr2 := r.prs.Progress[2]
+	pr2.BecomeReplicate()
+	propose := func() int {
+		r.Step(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{Data: []byte("somedata")}}})
+		return len(r.readMessages())
+	}
+
+	// The window starts out at 4 messages.
+	for i := 0; i < 4; i++ {
+		if n := propose(); n != 1 {
+			t.Fatalf("#%d: len(ms) = %d, want 1", i, n)
+		}
+	}
+	if !pr2.IsPaused() {
+		t.Fatal("paused = false, want true")
+	}
+	if w := getStatus(r).Progress[2].Inflights.Window(); w != 4 {
+		t.Fatalf("window = %d, want 4", w)
+	}
+
+	// Acking everything grows the window.
+	r.Step(pb.Message{From: 2, To: 1, Type: pb.MsgAppResp, Index: r.raftLog.lastIndex()})
+	r.readMessages()
+	if w := pr2.Inflights.Window(); w != 8 {
+		t.Fatalf("window = %d, want 8", w)
+	}
+
+	// A rejection halves it.
+	for i := 0; i < 2; i++ {
+		propose()
+	}
+	r.Step(pb.Message{From: 2, To: 1, Type: pb.MsgAppResp, Index: r.raftLog.lastIndex(), Reject: true, RejectHint: pr2.Match})
+	r.readMessages()
+	if w := pr2.Inflights.Window(); w != 4 {
+		t.Fatalf("window = %d, want 4", w)
+	}
+	if s := getStatus(r).String(); !strings.Contains(s, `"window":4`) {
+		t.Fatalf("status %s does not report window", s)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// TestObserver verifies that an observer only receives committed entries,
+// does not count towards the quorum, and never campaigns.
+func TestObserver(t *testing.T) {
+	peers := map[uint64]*raft{}
+	for id := uint64(1); id <= 3; id++ {
+		peers[id] = newTestRaft(id, 10, 1, newTestMemoryStorage(withPeers(1, 2, 3)))
+	}
+	cfg := newTestConfig(4, 10, 1, newTestMemoryStorage(withPeers(1, 2, 3)))
+	cfg.Observer = true
+	peers[4] = newRaft(cfg)
+
+	down := map[uint64]bool{}
+	var sent []pb.Message
+	deliver := func() {
+		for {
+			var msgs []pb.Message
+			for id := uint64(1); id <= 4; id++ {
+				msgs = append(msgs, peers[id].readMessages()...)
+			}
+			if len(msgs) == 0 {
+				return
+			}
+			for _, m := range msgs {
+				if down[m.From] || down[m.To] {
+					continue
+				}
+				sent = append(sent, m)
+				_ = peers[m.To].Step(m)
+			}
+		}
+	}
+
+	lead, obs := peers[1], peers[4]
+	require.NoError(t, lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgHup}))
+	deliver()
+	require.Equal(t, StateLeader, lead.state)
+	require.Equal(t, ErrObserverInConfig, lead.addObserver(2))
+	require.Equal(t, ErrInvalidObserver, lead.addObserver(None))
+	require.Equal(t, ErrInvalidObserver, lead.addObserver(1))
+	require.NoError(t, lead.addObserver(4))
+	deliver()
+	require.Equal(t, lead.raftLog.committed, obs.raftLog.committed)
+
+	// Without a quorum of voters, nothing is committed, and the observer
+	// receives nothing.
+	down[2], down[3] = true, true
+	committed := lead.raftLog.committed
+	for i := 0; i < 3; i++ {
+		require.NoError(t, lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{Data: []byte("x")}}}))
+	}
+	deliver()
+	require.Equal(t, committed, lead.raftLog.committed)
+	require.Equal(t, committed, obs.raftLog.lastIndex())
+
+	// Once the entries are committed, they are replicated to the observer.
+	down[2] = false
+	require.NoError(t, lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgBeat}))
+	deliver()
+	require.Equal(t, lead.raftLog.lastIndex(), lead.raftLog.committed)
+	require.Equal(t, lead.raftLog.lastIndex(), obs.raftLog.lastIndex())
+	require.Equal(t, lead.raftLog.committed, obs.raftLog.committed)
+	for _, m := range sent {
+		if m.To == 4 && m.Type == pb.MsgApp && len(m.Entries) > 0 {
+			require.LessOrEqual(t, m.Entries[len(m.Entries)-1].Index, m.Commit)
+		}
+	}
+
+	// The observer's progress is reported separately.
+	st := getStatus(lead)
+	require.NotContains(t, st.Progress, uint64(4))
+	require.Equal(t, lead.raftLog.committed, st.Observers[4].Match)
+	require.Contains(t, st.String(), fmt.Sprintf(`"observers":{"4":{"match":%d,`, lead.raftLog.committed))
+
+	// The observer never campaigns.
+	sent = nil
+	for i := 0; i < 10*obs.randomizedElectionTimeout; i++ {
+		obs.tick()
+	}
+	deliver()
+	require.Empty(t, sent)
+	require.Equal(t, StateFollower, obs.state)
+}
+
+// TestObserverSnapshot verifies that an observer is caught up with a snapshot
+// if the leader's log has been compacted.
+func TestObserverSnapshot(t *testing.T) {
+	lead := newTestRaft(1, 10, 1, newTestMemoryStorage(withPeers(1)))
+	lead.restore(testingSnap)
+	lead.becomeCandidate()
+	lead.becomeLeader()
+
+	cfg := newTestConfig(3, 10, 1, newTestMemoryStorage())
+	cfg.Observer = true
+	obs := newRaft(cfg)
+
+	require.NoError(t, lead.addObserver(3))
+	for msgs := lead.readMessages(); len(msgs) > 0; msgs = lead.readMessages() {
+		for _, m := range msgs {
+			require.NoError(t, obs.Step(m))
+		}
+		for _, m := range obs.readMessages() {
+			require.NoError(t, lead.Step(m))
+		}
+	}
+
+	require.Equal(t, testingSnap.Metadata.Index, obs.raftLog.committed)
+	pr := lead.observers[3]
+	require.Equal(t, tracker.StateReplicate, pr.State)
+	require.Equal(t, testingSnap.Metadata.Index, pr.Match)
+}
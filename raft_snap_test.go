@@ -17,7 +17,10 @@ package raft
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
 )
 
 var (
@@ -139,3 +142,126 @@ func TestSnapshotAbort(t *testing.T) {
 		t.Fatalf("expected an inflight message, got %d", n)
 	}
 }
+
+// TestSnapshotConcurrencyLimit ensures that with MaxConcurrentSnapshots, the
+// leader queues followers needing a snapshot while the limit is reached, keeps
+// them in StateProbe, and sends them snapshots in order as slots free up.
+func TestSnapshotConcurrencyLimit(t *testing.T) {
+	snap := testingSnap
+	snap.Metadata.ConfState = pb.ConfState{Voters: []uint64{1, 2, 3, 4}}
+	storage := newTestMemoryStorage(withPeers(1, 2, 3, 4))
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.MaxConcurrentSnapshots = 1
+	sm := newRaft(cfg)
+	sm.restore(snap)
+
+	sm.becomeCandidate()
+	sm.becomeLeader()
+	sm.readMessages()
+
+	needSnapshot := func(id uint64) {
+		t.Helper()
+		sm.prs.Progress[id].Next = sm.raftLog.firstIndex()
+		sm.Step(pb.Message{From: id, To: 1, Type: pb.MsgAppResp, Index: sm.prs.Progress[id].Next - 1, Reject: true})
+	}
+	snapshotsTo := func() []uint64 {
+		var to []uint64
+		for _, m := range sm.readMessages() {
+			if m.Type == pb.MsgSnap {
+				to = append(to, m.To)
+			}
+		}
+		return to
+	}
+
+	needSnapshot(3)
+	needSnapshot(2)
+	needSnapshot(4)
+	require.Equal(t, []uint64{3}, snapshotsTo())
+	require.Equal(t, tracker.StateSnapshot, sm.prs.Progress[3].State)
+	require.Equal(t, tracker.StateProbe, sm.prs.Progress[2].State)
+	require.Equal(t, tracker.StateProbe, sm.prs.Progress[4].State)
+	require.Equal(t, []uint64{2, 4}, sm.snapshotQueue)
+
+	// Heartbeat responses of queued followers don't bypass the queue.
+	sm.Step(pb.Message{From: 4, To: 1, Type: pb.MsgHeartbeatResp})
+	require.Empty(t, snapshotsTo())
+
+	// Once the snapshot to 3 fails, 2 is next in line.
+	sm.Step(pb.Message{From: 3, To: 1, Type: pb.MsgSnapStatus, Reject: true})
+	require.Equal(t, []uint64{2}, snapshotsTo())
+	require.Equal(t, []uint64{4}, sm.snapshotQueue)
+
+	// Once 2 has applied its snapshot, 4 gets one.
+	sm.Step(pb.Message{From: 2, To: 1, Type: pb.MsgAppResp, Index: snap.Metadata.Index})
+	require.Equal(t, []uint64{4}, snapshotsTo())
+	require.Empty(t, sm.snapshotQueue)
+}
+
+// snapshotCountingStorage counts the calls to Snapshot.
+type snapshotCountingStorage struct {
+	*MemoryStorage
+	snapshots int
+}
+
+func (s *snapshotCountingStorage) Snapshot() (pb.Snapshot, error) {
+	s.snapshots++
+	return s.MemoryStorage.Snapshot()
+}
+
+// TestSnapshotProbeWindow ensures that with SnapshotProbeWindow, the leader
+// sends a snapshot to a follower lagging beyond the window if the snapshot
+// helps it catch up, and otherwise, or while MaxConcurrentSnapshots is
+// reached, keeps it in StateProbe and catches it up from the log.
+func TestSnapshotProbeWindow(t *testing.T) {
+	storage := newTestMemoryStorage(withPeers(1, 2, 3))
+	for i := uint64(1); i <= 30; i++ {
+		require.NoError(t, storage.Append([]pb.Entry{{Index: i, Term: 1}}))
+	}
+	cs := pb.ConfState{Voters: []uint64{1, 2, 3}}
+	_, err := storage.CreateSnapshot(20, &cs, nil)
+	require.NoError(t, err)
+	counting := &snapshotCountingStorage{MemoryStorage: storage}
+	cfg := newTestConfig(1, 10, 1, counting)
+	cfg.MaxConcurrentSnapshots = 1
+	cfg.SnapshotProbeWindow = 10
+	sm := newRaft(cfg)
+
+	sm.becomeCandidate()
+	sm.becomeLeader()
+	sm.readMessages()
+	require.Equal(t, uint64(31), sm.raftLog.lastIndex())
+
+	probe := func(id, next uint64) pb.Message {
+		t.Helper()
+		sm.prs.Progress[id].Next = next
+		sm.prs.Progress[id].RecentActive = true
+		sm.sendAppend(id)
+		msgs := sm.readMessages()
+		require.Len(t, msgs, 1)
+		return msgs[0]
+	}
+
+	// Within the window, the follower is caught up from the log.
+	require.Equal(t, pb.MsgApp, probe(2, 25).Type)
+	sm.prs.Progress[2].BecomeProbe()
+	// Beyond the window, a snapshot that doesn't cover Next does not help.
+	require.Equal(t, pb.MsgApp, probe(2, 21).Type)
+	sm.prs.Progress[2].BecomeProbe()
+	require.Equal(t, 1, counting.snapshots)
+	// The snapshot is not read again until the log is compacted.
+	require.Equal(t, pb.MsgApp, probe(2, 21).Type)
+	sm.prs.Progress[2].BecomeProbe()
+	require.Equal(t, 1, counting.snapshots)
+	// A snapshot that covers Next is sent instead of entries.
+	m := probe(2, 5)
+	require.Equal(t, pb.MsgSnap, m.Type)
+	require.Equal(t, uint64(20), m.Snapshot.Metadata.Index)
+	require.Equal(t, tracker.StateSnapshot, sm.prs.Progress[2].State)
+
+	// While the limit is reached, the follower stays in StateProbe and is
+	// caught up from the log rather than being queued.
+	require.Equal(t, pb.MsgApp, probe(3, 5).Type)
+	require.Equal(t, tracker.StateProbe, sm.prs.Progress[3].State)
+	require.Empty(t, sm.snapshotQueue)
+}
@@ -16,6 +16,7 @@ package raft
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -275,9 +276,13 @@ func TestUncommittedEntryLimit(t *testing.T) {
 	}
 
 	// Send one more proposal to r1. It should be rejected.
-	if err := r.Step(propMsg); err != ErrProposalDropped {
+	err := r.Step(propMsg)
+	var dropErr *ProposalDroppedError
+	if !errors.As(err, &dropErr) || !errors.Is(err, ErrProposalDropped) {
 		t.Fatalf("proposal not dropped: %v", err)
 	}
+	require.Equal(t, ProposalDropUncommittedSizeLimit, dropErr.Reason)
+	require.Equal(t, r.id, dropErr.Lead)
 
 	// Read messages and reduce the uncommitted size as if we had committed
 	// these entries.
@@ -302,7 +307,7 @@ func TestUncommittedEntryLimit(t *testing.T) {
 	}
 
 	// Send one more proposal to r1. It should be rejected, again.
-	if err := r.Step(propMsg); err != ErrProposalDropped {
+	if err := r.Step(propMsg); !errors.Is(err, ErrProposalDropped) {
 		t.Fatalf("proposal not dropped: %v", err)
 	}
 
@@ -1175,6 +1180,37 @@ func TestProposalByProxy(t *testing.T) {
 	}
 }
 
+// TestLocalityQuorum tests that with Config.QuorumLocalities, elections and
+// commits require the support of voters in the configured number of
+// localities.
+func TestLocalityQuorum(t *testing.T) {
+	zones := map[uint64]string{1: "a", 2: "a", 3: "a", 4: "b", 5: "b"}
+	storage := newTestMemoryStorage(withPeers(1, 2, 3, 4, 5))
+	for id := uint64(1); id <= 5; id++ {
+		cs := &storage.snapshot.Metadata.ConfState
+		cs.Metadata = append(cs.Metadata, pb.NodeMetadata{NodeID: id, Locality: zones[id]})
+	}
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.QuorumLocalities = 2
+	r := newRaft(cfg)
+
+	r.becomeCandidate()
+	for _, id := range []uint64{2, 3} {
+		require.NoError(t, r.Step(pb.Message{From: id, To: 1, Term: r.Term, Type: pb.MsgVoteResp}))
+	}
+	require.Equal(t, StateCandidate, r.state)
+	require.NoError(t, r.Step(pb.Message{From: 4, To: 1, Term: r.Term, Type: pb.MsgVoteResp}))
+	require.Equal(t, StateLeader, r.state)
+
+	index := r.raftLog.lastIndex()
+	for _, id := range []uint64{2, 3} {
+		require.NoError(t, r.Step(pb.Message{From: id, To: 1, Term: r.Term, Type: pb.MsgAppResp, Index: index}))
+	}
+	require.Zero(t, r.raftLog.committed)
+	require.NoError(t, r.Step(pb.Message{From: 5, To: 1, Term: r.Term, Type: pb.MsgAppResp, Index: index}))
+	require.Equal(t, index, r.raftLog.committed)
+}
+
 func TestCommit(t *testing.T) {
 	tests := []struct {
 		matches []uint64
@@ -3315,6 +3351,66 @@ func TestStepIgnoreConfig(t *testing.T) {
 	}
 }
 
+// TestStepQueueConfig tests that with MaxPendingConfChanges, the leader accepts
+// several conf changes at once, validating each against the configuration
+// resulting from its predecessors.
+func TestStepQueueConfig(t *testing.T) {
+	cfg := newTestConfig(1, 10, 1, newTestMemoryStorage(withPeers(1, 2)))
+	cfg.MaxPendingConfChanges = 3
+	r := newRaft(cfg)
+	r.becomeCandidate()
+	r.becomeLeader()
+
+	propose := func(cc pb.ConfChangeV2) pb.EntryType {
+		data, err := cc.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, r.Step(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{Type: pb.EntryConfChangeV2, Data: data}}}))
+		ents, err := r.raftLog.entries(r.raftLog.lastIndex(), noLimit)
+		require.NoError(t, err)
+		return ents[0].Type
+	}
+	joint := pb.ConfChangeV2{
+		Transition: pb.ConfChangeTransitionJointExplicit,
+		Changes: []pb.ConfChangeSingle{
+			{Type: pb.ConfChangeAddNode, NodeID: 3},
+			{Type: pb.ConfChangeAddNode, NodeID: 4},
+		},
+	}
+	addLearner := pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{{Type: pb.ConfChangeAddLearnerNode, NodeID: 5}}}
+	var removeVoters pb.ConfChangeV2
+	for id := uint64(1); id <= 4; id++ {
+		removeVoters.Changes = append(removeVoters.Changes, pb.ConfChangeSingle{Type: pb.ConfChangeRemoveNode, NodeID: id})
+	}
+	leaveJoint := pb.ConfChangeV2{}
+	// Leaving the joint config is only valid once it has been entered, and
+	// nothing else is valid in it.
+	require.Equal(t, pb.EntryNormal, propose(leaveJoint))
+	require.Equal(t, pb.EntryConfChangeV2, propose(joint))
+	require.Equal(t, pb.EntryNormal, propose(addLearner))
+	require.Equal(t, pb.EntryConfChangeV2, propose(leaveJoint))
+	require.Equal(t, r.raftLog.lastIndex(), r.pendingConfIndex)
+	// Removes all voters of the config resulting from the above.
+	require.Equal(t, pb.EntryNormal, propose(removeVoters))
+	require.Equal(t, pb.EntryConfChangeV2, propose(addLearner))
+	// Too many pending conf changes.
+	require.Equal(t, pb.EntryNormal, propose(pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{{Type: pb.ConfChangeAddNode, NodeID: 5}}}))
+	require.Equal(t, []uint64{1, 2}, r.prs.VoterNodes())
+
+	// A new leader does not know the pending conf changes.
+	r.becomeFollower(r.Term+1, None)
+	r.becomeCandidate()
+	r.becomeLeader()
+	require.Equal(t, pb.EntryNormal, propose(addLearner))
+
+	// Without validation, conf changes are not queued.
+	r.disableConfChangeValidation = true
+	r.pendingConfChanges = nil
+	require.Equal(t, pb.EntryConfChangeV2, propose(leaveJoint))
+	require.Equal(t, pb.EntryConfChangeV2, propose(addLearner))
+	require.Empty(t, r.pendingConfChanges)
+	require.Equal(t, r.raftLog.lastIndex(), r.pendingConfIndex)
+}
+
 // TestNewLeaderPendingConfig tests that new leader sets its pendingConfigIndex
 // based on uncommitted entries.
 func TestNewLeaderPendingConfig(t *testing.T) {
@@ -3350,6 +3446,23 @@ func TestAddNode(t *testing.T) {
 	}
 }
 
+// TestUpdateNodeMetadata tests that ConfChangeUpdateNode updates the metadata
+// in the configuration, which is reflected in the ConfState and Status.
+func TestUpdateNodeMetadata(t *testing.T) {
+	r := newTestRaft(1, 10, 1, newTestMemoryStorage(withPeers(1, 2)))
+	md := pb.NodeMetadata{Address: "localhost:2380", Locality: "zone-a"}
+	cs := r.applyConfChange(pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{
+		{Type: pb.ConfChangeUpdateNode, NodeID: 2, Metadata: &md},
+	}})
+	md.NodeID = 2
+	require.Equal(t, []pb.NodeMetadata{md}, cs.Metadata)
+	require.Equal(t, map[uint64]pb.NodeMetadata{2: md}, getStatus(r).Config.Metadata)
+
+	cs = r.applyConfChange(pb.ConfChange{NodeID: 2, Type: pb.ConfChangeRemoveNode}.AsV2())
+	require.Empty(t, cs.Metadata)
+	require.Empty(t, getStatus(r).Config.Metadata)
+}
+
 // TestAddLearner tests that addLearner could update nodes correctly.
 func TestAddLearner(t *testing.T) {
 	r := newTestRaft(1, 10, 1, newTestMemoryStorage(withPeers(1)))
@@ -3832,9 +3945,13 @@ func TestLeaderTransferIgnoreProposal(t *testing.T) {
 
 	nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{}}})
 	err := lead.Step(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{}}})
-	if err != ErrProposalDropped {
+	var dropErr *ProposalDroppedError
+	if !errors.As(err, &dropErr) || !errors.Is(err, ErrProposalDropped) {
 		t.Fatalf("should return drop proposal error while transferring")
 	}
+	require.Equal(t, ProposalDropLeaderTransfer, dropErr.Reason)
+	require.Equal(t, uint64(1), dropErr.Lead)
+	require.Equal(t, uint64(3), dropErr.Transferee)
 
 	if lead.prs.Progress[1].Match != 1 {
 		t.Fatalf("node 1 has match %x, want %x", lead.prs.Progress[1].Match, 1)
@@ -3980,6 +4097,170 @@ func TestLeaderTransferSecondTransferToSameNode(t *testing.T) {
 	checkLeaderTransferState(t, lead, StateLeader, 1)
 }
 
+// TestLeaderTransferResult verifies that the outcome of a leadership transfer
+// is recorded on the old leader.
+func TestLeaderTransferResult(t *testing.T) {
+	t.Run("succeeded", func(t *testing.T) {
+		nt := newNetwork(nil, nil, nil)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+		lead := nt.peers[1].(*raft)
+		seq := lead.leadTransferSeq
+
+		nt.send(pb.Message{From: 2, To: 1, Type: pb.MsgTransferLeader})
+		checkLeaderTransferState(t, lead, StateFollower, 2)
+		require.Equal(t, LeaderTransfer{Transferee: 2, Result: LeaderTransferSucceeded}, lead.leadTransfer)
+		require.Equal(t, LeaderTransferSucceeded, lead.leaderTransferResult(seq+1))
+	})
+
+	t.Run("self", func(t *testing.T) {
+		nt := newNetwork(nil, nil, nil)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+		lead := nt.peers[1].(*raft)
+
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgTransferLeader})
+		require.Equal(t, LeaderTransfer{Transferee: 1, Result: LeaderTransferSucceeded}, lead.leadTransfer)
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		nt := newNetwork(nil, nil, nil)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+		nt.isolate(3)
+		lead := nt.peers[1].(*raft)
+
+		nt.send(pb.Message{From: 3, To: 1, Type: pb.MsgTransferLeader})
+		for i := 0; i < lead.electionTimeout-1; i++ {
+			lead.tick()
+		}
+		st := getBasicStatus(lead)
+		require.Equal(t, uint64(3), st.LeadTransferee)
+		require.Equal(t, lead.electionTimeout-1, st.LeadTransferElapsed)
+		require.Equal(t, LeaderTransferInProgress, lead.leadTransfer.Result)
+
+		lead.tick()
+		checkLeaderTransferState(t, lead, StateLeader, 1)
+		require.Equal(t, LeaderTransfer{Transferee: 3, Result: LeaderTransferTimedOut}, lead.leadTransfer)
+		require.Zero(t, getBasicStatus(lead).LeadTransferElapsed)
+	})
+
+	t.Run("not caught up", func(t *testing.T) {
+		nt := newNetwork(nil, nil, nil)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+		nt.isolate(3)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{}}})
+		lead := nt.peers[1].(*raft)
+
+		nt.send(pb.Message{From: 3, To: 1, Type: pb.MsgTransferLeader})
+		for i := 0; i < lead.electionTimeout; i++ {
+			lead.tick()
+		}
+		checkLeaderTransferState(t, lead, StateLeader, 1)
+		require.Equal(t, LeaderTransfer{Transferee: 3, Result: LeaderTransferNotCaughtUp}, lead.leadTransfer)
+	})
+
+	t.Run("superseded", func(t *testing.T) {
+		nt := newNetwork(nil, nil, nil)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+		nt.isolate(3)
+		lead := nt.peers[1].(*raft)
+
+		nt.send(pb.Message{From: 3, To: 1, Type: pb.MsgTransferLeader})
+		seq := lead.leadTransferSeq
+		nt.send(pb.Message{From: 2, To: 1, Type: pb.MsgTransferLeader})
+		require.Equal(t, LeaderTransferAborted, lead.leaderTransferResult(seq))
+		require.Equal(t, LeaderTransfer{Transferee: 2, Result: LeaderTransferSucceeded}, lead.leadTransfer)
+	})
+
+	t.Run("not voter", func(t *testing.T) {
+		r := newTestRaft(1, 10, 1, newTestMemoryStorage(withPeers(1, 2), withLearners(3)))
+		r.becomeCandidate()
+		r.becomeLeader()
+
+		require.NoError(t, r.Step(pb.Message{From: 3, To: 1, Type: pb.MsgTransferLeader}))
+		require.Equal(t, LeaderTransfer{Transferee: 3, Result: LeaderTransferNotVoter}, r.leadTransfer)
+		require.NoError(t, r.Step(pb.Message{From: 4, To: 1, Type: pb.MsgTransferLeader}))
+		require.Equal(t, LeaderTransfer{Transferee: 4, Result: LeaderTransferNotVoter}, r.leadTransfer)
+
+		// Requests for non-voters don't affect a transfer in progress.
+		require.NoError(t, r.Step(pb.Message{From: 2, To: 1, Type: pb.MsgTransferLeader}))
+		seq := r.leadTransferSeq
+		require.NoError(t, r.Step(pb.Message{From: 3, To: 1, Type: pb.MsgTransferLeader}))
+		require.NoError(t, r.Step(pb.Message{From: 4, To: 1, Type: pb.MsgTransferLeader}))
+		require.Equal(t, LeaderTransfer{Transferee: 2, Result: LeaderTransferInProgress}, r.leadTransfer)
+		require.Equal(t, seq, r.leadTransferSeq)
+
+		// Removing the transferee fails the transfer.
+		r.applyConfChange(pb.ConfChange{Type: pb.ConfChangeRemoveNode, NodeID: 2}.AsV2())
+		require.Equal(t, LeaderTransfer{Transferee: 2, Result: LeaderTransferNotVoter}, r.leadTransfer)
+	})
+
+	t.Run("other leader", func(t *testing.T) {
+		nt := newNetwork(nil, nil, nil)
+		nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+		lead := nt.peers[1].(*raft)
+
+		// Node 3 wins an election before node 2 takes over.
+		nt.isolate(2)
+		nt.send(pb.Message{From: 2, To: 1, Type: pb.MsgTransferLeader})
+		require.Equal(t, LeaderTransferInProgress, lead.leadTransfer.Result)
+		nt.send(pb.Message{From: 3, To: 3, Type: pb.MsgHup})
+		require.Equal(t, uint64(3), lead.lead)
+		require.Equal(t, LeaderTransfer{Transferee: 2, Result: LeaderTransferAborted}, lead.leadTransfer)
+	})
+}
+
+// TestStepDown verifies that StepDown transfers the leadership to the best
+// suited voter.
+func TestStepDown(t *testing.T) {
+	nt := newNetwork(nil, nil, nil, nil)
+	nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgHup})
+	nt.isolate(3)
+	nt.send(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{}}})
+	nt.recover()
+	lead := nt.peers[1].(*raft)
+	// Node 3 lags behind the other followers.
+	lead.prs.Progress[3].RecentActive = true
+	require.Less(t, lead.prs.Progress[3].Match, lead.prs.Progress[2].Match)
+
+	require.Equal(t, uint64(2), lead.stepDownCandidate(StepDownOptions{}))
+	require.Equal(t, uint64(4), lead.stepDownCandidate(StepDownOptions{
+		Priority: func(id uint64) int {
+			if id == 4 {
+				return 1
+			}
+			return 0
+		},
+	}))
+	require.Equal(t, uint64(3), lead.stepDownCandidate(StepDownOptions{
+		Priority: func(id uint64) int {
+			if id == 3 {
+				return 0
+			}
+			return -1
+		},
+	}))
+	lead.prs.Metadata = map[uint64]pb.NodeMetadata{3: {NodeID: 3, Locality: "b"}}
+	require.Equal(t, uint64(3), lead.stepDownCandidate(StepDownOptions{Locality: "b"}))
+	require.Equal(t, uint64(2), lead.stepDownCandidate(StepDownOptions{Locality: "c"}))
+	lead.prs.Progress[2].RecentActive = false
+	require.Equal(t, uint64(4), lead.stepDownCandidate(StepDownOptions{}))
+	require.Equal(t, uint64(None), lead.stepDownCandidate(StepDownOptions{
+		Priority: func(uint64) int { return -1 },
+	}))
+
+	rn := &RawNode{raft: lead}
+	_, err := rn.StepDown(StepDownOptions{Priority: func(uint64) int { return -1 }})
+	require.Equal(t, ErrNoTransferCandidate, err)
+	id, err := rn.StepDown(StepDownOptions{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), id)
+	nt.send(lead.readMessages()...)
+	checkLeaderTransferState(t, lead, StateFollower, 4)
+	require.Equal(t, LeaderTransfer{Transferee: 4, Result: LeaderTransferSucceeded}, rn.LeaderTransfer())
+
+	_, err = rn.StepDown(StepDownOptions{})
+	require.Equal(t, ErrNotLeader, err)
+}
+
 func checkLeaderTransferState(t *testing.T, r *raft, state StateType, lead uint64) {
 	if r.state != state || r.lead != lead {
 		t.Fatalf("after transferring, node has state %v lead %v, want state %v lead %v", r.state, r.lead, state, lead)
@@ -5058,3 +5339,26 @@ func newTestRawNode(id uint64, election, heartbeat int, storage Storage) *RawNod
 	}
 	return rn
 }
+
+// TestProposalDroppedNoLeader verifies that followers and candidates without a
+// known leader drop proposals with ProposalDropNoLeader.
+func TestProposalDroppedNoLeader(t *testing.T) {
+	for _, st := range []StateType{StateFollower, StateCandidate, StatePreCandidate} {
+		t.Run(st.String(), func(t *testing.T) {
+			r := newTestRaft(1, 10, 1, newTestMemoryStorage(withPeers(1, 2, 3)))
+			switch st {
+			case StateCandidate:
+				r.becomeCandidate()
+			case StatePreCandidate:
+				r.becomePreCandidate()
+			}
+			err := r.Step(pb.Message{From: 1, To: 1, Type: pb.MsgProp, Entries: []pb.Entry{{Data: []byte("x")}}})
+			var dropErr *ProposalDroppedError
+			require.ErrorAs(t, err, &dropErr)
+			require.ErrorIs(t, err, ErrProposalDropped)
+			require.Equal(t, ProposalDropNoLeader, dropErr.Reason)
+			require.Equal(t, None, dropErr.Lead)
+			require.Equal(t, "raft proposal dropped: no leader", err.Error())
+		})
+	}
+}
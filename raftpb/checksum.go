@@ -0,0 +1,46 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftpb
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ComputeChecksum returns the CRC32C of the entry's Type, Term, Index and
+// Data.
+func (e *Entry) ComputeChecksum() uint32 {
+	var hdr [20]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(e.Type))
+	binary.LittleEndian.PutUint64(hdr[4:], e.Term)
+	binary.LittleEndian.PutUint64(hdr[12:], e.Index)
+	crc := crc32.Update(0, castagnoli, hdr[:])
+	return crc32.Update(crc, castagnoli, e.Data)
+}
+
+// SetChecksum sets the entry's Checksum. It must be called again whenever the
+// entry is modified.
+func (e *Entry) SetChecksum() {
+	e.Checksum = e.ComputeChecksum()
+}
+
+// VerifyChecksum returns false if the entry carries a Checksum that does not
+// match its contents. Entries without a Checksum are not verified, which
+// includes the rare entries whose checksum is zero.
+func (e *Entry) VerifyChecksum() bool {
+	return e.Checksum == 0 || e.Checksum == e.ComputeChecksum()
+}
@@ -0,0 +1,1124 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftpb
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// This file implements the protobuf wire format of the messages defined in
+// raft.proto by hand. The encoding is byte for byte the one of the code that
+// gogo/protobuf used to generate for them, which TestWireFormat pins down:
+//
+//   - fields are written in field number order;
+//   - scalar fields and non-pointer nested messages are always written, even
+//     if they are zero, while bytes fields and pointer fields are only written
+//     if they are non-nil, and Entry.Checksum, for which zero means that it
+//     is absent, only if it is non-zero;
+//   - repeated scalars are written unpacked, and map entries in key order.
+//
+// The decoder also accepts packed repeated scalars, and skips unknown fields.
+//
+// Entry.Data, Snapshot.Data and Message.Context, which make up the bulk of
+// most messages, can be decoded without copying them out of the input by
+// UnmarshalNoCopy.
+//
+// When changing raft.proto, update this file and TestWireFormat accordingly.
+
+var (
+	ErrInvalidLengthRaft        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowRaft          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupRaft = fmt.Errorf("proto: unexpected end of group")
+)
+
+// The protobuf wire types.
+const (
+	wireVarint     = 0
+	wireFixed64    = 1
+	wireBytes      = 2
+	wireStartGroup = 3
+	wireEndGroup   = 4
+	wireFixed32    = 5
+)
+
+// key returns the key of a field. All field numbers in raft.proto are below
+// 16, so keys take a single byte.
+func key(field, wireType int) byte {
+	return byte(field<<3 | wireType)
+}
+
+// sov returns the size of the varint encoding of v.
+func sov(v uint64) int {
+	return (bits.Len64(v|1) + 6) / 7
+}
+
+// sizeVarint returns the size of a varint field with the given value.
+func sizeVarint(v uint64) int {
+	return 1 + sov(v)
+}
+
+// sizeBytes returns the size of a length-delimited field with the given
+// length.
+func sizeBytes(n int) int {
+	return 1 + sov(uint64(n)) + n
+}
+
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// encoder is implemented by all messages. encode writes the encoding of the
+// message so that it ends at dAtA[i], and returns the index at which it
+// starts. Messages are encoded back to front, so that the length of a nested
+// message is known by the time its length prefix is written.
+type encoder interface {
+	Size() int
+	encode(dAtA []byte, i int) int
+}
+
+func marshal(m encoder) ([]byte, error) {
+	dAtA := make([]byte, m.Size())
+	m.encode(dAtA, len(dAtA))
+	return dAtA, nil
+}
+
+func marshalTo(m encoder, dAtA []byte) (int, error) {
+	size := m.Size()
+	m.encode(dAtA[:size], size)
+	return size, nil
+}
+
+func marshalToSizedBuffer(m encoder, dAtA []byte) (int, error) {
+	return len(dAtA) - m.encode(dAtA, len(dAtA)), nil
+}
+
+// putVarint writes the varint encoding of v so that it ends at dAtA[i], and
+// returns the index at which it starts.
+func putVarint(dAtA []byte, i int, v uint64) int {
+	i -= sov(v)
+	j := i
+	for v >= 0x80 {
+		dAtA[j] = byte(v) | 0x80
+		v >>= 7
+		j++
+	}
+	dAtA[j] = byte(v)
+	return i
+}
+
+// putVarintField is like putVarint, but writes a varint field with the given
+// key.
+func putVarintField(dAtA []byte, i int, k byte, v uint64) int {
+	i = putVarint(dAtA, i, v)
+	i--
+	dAtA[i] = k
+	return i
+}
+
+// putBytesField is like putVarint, but writes a length-delimited field with
+// the given key.
+func putBytesField(dAtA []byte, i int, k byte, b []byte) int {
+	i -= len(b)
+	copy(dAtA[i:], b)
+	return putVarintField(dAtA, i, k, uint64(len(b)))
+}
+
+// putStringField is like putBytesField, for strings.
+func putStringField(dAtA []byte, i int, k byte, s string) int {
+	i -= len(s)
+	copy(dAtA[i:], s)
+	return putVarintField(dAtA, i, k, uint64(len(s)))
+}
+
+// putMessageField is like putVarint, but writes a nested message field with
+// the given key.
+func putMessageField(dAtA []byte, i int, k byte, m encoder) int {
+	end := i
+	i = m.encode(dAtA, i)
+	return putVarintField(dAtA, i, k, uint64(end-i))
+}
+
+// putUint64sField is like putVarint, but writes a repeated varint field with
+// the given key, unpacked.
+func putUint64sField(dAtA []byte, i int, k byte, vs []uint64) int {
+	for j := len(vs) - 1; j >= 0; j-- {
+		i = putVarintField(dAtA, i, k, vs[j])
+	}
+	return i
+}
+
+func sizeUint64s(vs []uint64) (n int) {
+	for _, v := range vs {
+		n += sizeVarint(v)
+	}
+	return n
+}
+
+// decoder decodes the fields of an encoded message from buf, starting at i.
+// If alias is set, decoded bytes fields alias buf rather than being copied.
+type decoder struct {
+	buf   []byte
+	i     int
+	alias bool
+}
+
+// varint decodes a varint.
+func (d *decoder) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= 64 {
+			return 0, ErrIntOverflowRaft
+		}
+		if d.i >= len(d.buf) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		b := d.buf[d.i]
+		d.i++
+		v |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+}
+
+// raw decodes a length-delimited field, and returns its contents without
+// copying them. Their capacity is limited to their length, so that appending
+// to them does not overwrite the input.
+func (d *decoder) raw() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if int(n) < 0 {
+		return nil, ErrInvalidLengthRaft
+	}
+	end := d.i + int(n)
+	if end < 0 {
+		return nil, ErrInvalidLengthRaft
+	}
+	if end > len(d.buf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.buf[d.i:end:end]
+	d.i = end
+	return b, nil
+}
+
+// bytes decodes a bytes field into dst, unless d aliases its input. The
+// result is never nil.
+func (d *decoder) bytes(dst []byte) ([]byte, error) {
+	b, err := d.raw()
+	if err != nil || d.alias {
+		return b, err
+	}
+	dst = append(dst[:0], b...)
+	if dst == nil {
+		dst = []byte{}
+	}
+	return dst, nil
+}
+
+// string decodes a string field.
+func (d *decoder) string() (string, error) {
+	b, err := d.raw()
+	return string(b), err
+}
+
+// sub returns a decoder for the nested message at the current position.
+func (d *decoder) sub() (decoder, error) {
+	b, err := d.raw()
+	return decoder{buf: b, alias: d.alias}, err
+}
+
+// uint64s decodes a repeated varint field, packed or unpacked, and appends it
+// to vs.
+func (d *decoder) uint64s(vs []uint64, wireType int, name string) ([]uint64, error) {
+	switch wireType {
+	case wireVarint:
+		v, err := d.varint()
+		return append(vs, v), err
+	case wireBytes:
+		packed, err := d.sub()
+		if err != nil {
+			return vs, err
+		}
+		if vs == nil {
+			n := 0
+			for _, b := range packed.buf {
+				if b < 0x80 {
+					n++
+				}
+			}
+			vs = make([]uint64, 0, n)
+		}
+		for packed.i < len(packed.buf) {
+			v, err := packed.varint()
+			if err != nil {
+				return vs, err
+			}
+			vs = append(vs, v)
+		}
+		return vs, nil
+	}
+	return vs, wrongWireType(wireType, name)
+}
+
+// next decodes the key of the next field, and returns its field number and
+// wire type, and whether there is a next field. msg is the name of the
+// message, for errors.
+func (d *decoder) next(msg string) (field int32, wireType int, ok bool, err error) {
+	if d.i >= len(d.buf) {
+		return 0, 0, false, nil
+	}
+	k, err := d.varint()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	field, wireType = int32(k>>3), int(k&0x7)
+	if wireType == wireEndGroup {
+		return 0, 0, false, fmt.Errorf("proto: %s: wiretype end group for non-group", msg)
+	}
+	if field <= 0 {
+		return 0, 0, false, fmt.Errorf("proto: %s: illegal tag %d (wire type %d)", msg, field, k)
+	}
+	return field, wireType, true, nil
+}
+
+// skip skips the unknown field whose key starts at the given index.
+func (d *decoder) skip(start int) error {
+	d.i = start
+	depth := 0
+	for {
+		k, err := d.varint()
+		if err != nil {
+			return err
+		}
+		switch wireType := int(k & 0x7); wireType {
+		case wireVarint:
+			_, err = d.varint()
+		case wireFixed64:
+			err = d.advance(8)
+		case wireBytes:
+			_, err = d.raw()
+		case wireStartGroup:
+			depth++
+		case wireEndGroup:
+			if depth == 0 {
+				return ErrUnexpectedEndOfGroupRaft
+			}
+			depth--
+		case wireFixed32:
+			err = d.advance(4)
+		default:
+			return fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if err != nil || depth == 0 {
+			return err
+		}
+	}
+}
+
+func (d *decoder) advance(n int) error {
+	if len(d.buf)-d.i < n {
+		return io.ErrUnexpectedEOF
+	}
+	d.i += n
+	return nil
+}
+
+func wrongWireType(wireType int, name string) error {
+	return fmt.Errorf("proto: wrong wireType = %d for field %s", wireType, name)
+}
+
+func checkWireType(wireType, want int, name string) error {
+	if wireType != want {
+		return wrongWireType(wireType, name)
+	}
+	return nil
+}
+
+func (m *Entry) Size() (n int) {
+	n = sizeVarint(uint64(m.Type)) + sizeVarint(m.Term) + sizeVarint(m.Index)
+	if m.Data != nil {
+		n += sizeBytes(len(m.Data))
+	}
+	if m.Checksum != 0 {
+		n += sizeVarint(uint64(m.Checksum))
+	}
+	return n
+}
+
+func (m *Entry) Marshal() ([]byte, error)                      { return marshal(m) }
+func (m *Entry) MarshalTo(dAtA []byte) (int, error)            { return marshalTo(m, dAtA) }
+func (m *Entry) MarshalToSizedBuffer(dAtA []byte) (int, error) { return marshalToSizedBuffer(m, dAtA) }
+
+func (m *Entry) encode(dAtA []byte, i int) int {
+	if m.Checksum != 0 {
+		i = putVarintField(dAtA, i, key(5, wireVarint), uint64(m.Checksum))
+	}
+	if m.Data != nil {
+		i = putBytesField(dAtA, i, key(4, wireBytes), m.Data)
+	}
+	i = putVarintField(dAtA, i, key(3, wireVarint), m.Index)
+	i = putVarintField(dAtA, i, key(2, wireVarint), m.Term)
+	return putVarintField(dAtA, i, key(1, wireVarint), uint64(m.Type))
+}
+
+func (m *Entry) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+// UnmarshalNoCopy is like Unmarshal, but Data aliases dAtA rather than being
+// copied, so dAtA must not be modified while the entry is in use.
+func (m *Entry) UnmarshalNoCopy(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA, alias: true})
+}
+
+func (m *Entry) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("Entry")
+		if err != nil || !ok {
+			return err
+		}
+		var v uint64
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "Type"); err == nil {
+				v, err = d.varint()
+				m.Type = EntryType(v)
+			}
+		case 2:
+			if err = checkWireType(wireType, wireVarint, "Term"); err == nil {
+				m.Term, err = d.varint()
+			}
+		case 3:
+			if err = checkWireType(wireType, wireVarint, "Index"); err == nil {
+				m.Index, err = d.varint()
+			}
+		case 4:
+			if err = checkWireType(wireType, wireBytes, "Data"); err == nil {
+				m.Data, err = d.bytes(m.Data)
+			}
+		case 5:
+			if err = checkWireType(wireType, wireVarint, "Checksum"); err == nil {
+				v, err = d.varint()
+				m.Checksum = uint32(v)
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *SnapshotMetadata) Size() (n int) {
+	return sizeBytes(m.ConfState.Size()) + sizeVarint(m.Index) + sizeVarint(m.Term)
+}
+
+func (m *SnapshotMetadata) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *SnapshotMetadata) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *SnapshotMetadata) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *SnapshotMetadata) encode(dAtA []byte, i int) int {
+	i = putVarintField(dAtA, i, key(3, wireVarint), m.Term)
+	i = putVarintField(dAtA, i, key(2, wireVarint), m.Index)
+	return putMessageField(dAtA, i, key(1, wireBytes), &m.ConfState)
+}
+
+func (m *SnapshotMetadata) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *SnapshotMetadata) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("SnapshotMetadata")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireBytes, "ConfState"); err == nil {
+				var sub decoder
+				if sub, err = d.sub(); err == nil {
+					err = m.ConfState.decode(&sub)
+				}
+			}
+		case 2:
+			if err = checkWireType(wireType, wireVarint, "Index"); err == nil {
+				m.Index, err = d.varint()
+			}
+		case 3:
+			if err = checkWireType(wireType, wireVarint, "Term"); err == nil {
+				m.Term, err = d.varint()
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Snapshot) Size() (n int) {
+	if m.Data != nil {
+		n += sizeBytes(len(m.Data))
+	}
+	return n + sizeBytes(m.Metadata.Size())
+}
+
+func (m *Snapshot) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *Snapshot) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *Snapshot) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *Snapshot) encode(dAtA []byte, i int) int {
+	i = putMessageField(dAtA, i, key(2, wireBytes), &m.Metadata)
+	if m.Data != nil {
+		i = putBytesField(dAtA, i, key(1, wireBytes), m.Data)
+	}
+	return i
+}
+
+func (m *Snapshot) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+// UnmarshalNoCopy is like Unmarshal, but Data aliases dAtA rather than being
+// copied, so dAtA must not be modified while the snapshot is in use.
+func (m *Snapshot) UnmarshalNoCopy(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA, alias: true})
+}
+
+func (m *Snapshot) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("Snapshot")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireBytes, "Data"); err == nil {
+				m.Data, err = d.bytes(m.Data)
+			}
+		case 2:
+			if err = checkWireType(wireType, wireBytes, "Metadata"); err == nil {
+				var sub decoder
+				if sub, err = d.sub(); err == nil {
+					err = m.Metadata.decode(&sub)
+				}
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Message) Size() (n int) {
+	n = sizeVarint(uint64(m.Type)) + sizeVarint(m.To) + sizeVarint(m.From) + sizeVarint(m.Term) +
+		sizeVarint(m.LogTerm) + sizeVarint(m.Index) + sizeVarint(m.Commit) +
+		sizeVarint(boolToUint64(m.Reject)) + sizeVarint(m.RejectHint) + sizeVarint(m.Vote)
+	for i := range m.Entries {
+		n += sizeBytes(m.Entries[i].Size())
+	}
+	if m.Snapshot != nil {
+		n += sizeBytes(m.Snapshot.Size())
+	}
+	if m.Context != nil {
+		n += sizeBytes(len(m.Context))
+	}
+	for i := range m.Responses {
+		n += sizeBytes(m.Responses[i].Size())
+	}
+	return n
+}
+
+func (m *Message) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *Message) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *Message) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *Message) encode(dAtA []byte, i int) int {
+	for j := len(m.Responses) - 1; j >= 0; j-- {
+		i = putMessageField(dAtA, i, key(14, wireBytes), &m.Responses[j])
+	}
+	i = putVarintField(dAtA, i, key(13, wireVarint), m.Vote)
+	if m.Context != nil {
+		i = putBytesField(dAtA, i, key(12, wireBytes), m.Context)
+	}
+	i = putVarintField(dAtA, i, key(11, wireVarint), m.RejectHint)
+	i = putVarintField(dAtA, i, key(10, wireVarint), boolToUint64(m.Reject))
+	if m.Snapshot != nil {
+		i = putMessageField(dAtA, i, key(9, wireBytes), m.Snapshot)
+	}
+	i = putVarintField(dAtA, i, key(8, wireVarint), m.Commit)
+	for j := len(m.Entries) - 1; j >= 0; j-- {
+		i = putMessageField(dAtA, i, key(7, wireBytes), &m.Entries[j])
+	}
+	i = putVarintField(dAtA, i, key(6, wireVarint), m.Index)
+	i = putVarintField(dAtA, i, key(5, wireVarint), m.LogTerm)
+	i = putVarintField(dAtA, i, key(4, wireVarint), m.Term)
+	i = putVarintField(dAtA, i, key(3, wireVarint), m.From)
+	i = putVarintField(dAtA, i, key(2, wireVarint), m.To)
+	return putVarintField(dAtA, i, key(1, wireVarint), uint64(m.Type))
+}
+
+func (m *Message) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+// UnmarshalNoCopy is like Unmarshal, but the Data of the entries and the
+// snapshot, and the Context, alias dAtA rather than being copied, and so do
+// those of the responses. dAtA must not be modified while the message is in
+// use.
+func (m *Message) UnmarshalNoCopy(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA, alias: true})
+}
+
+func (m *Message) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("Message")
+		if err != nil || !ok {
+			return err
+		}
+		var v uint64
+		var sub decoder
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "Type"); err == nil {
+				v, err = d.varint()
+				m.Type = MessageType(v)
+			}
+		case 2:
+			if err = checkWireType(wireType, wireVarint, "To"); err == nil {
+				m.To, err = d.varint()
+			}
+		case 3:
+			if err = checkWireType(wireType, wireVarint, "From"); err == nil {
+				m.From, err = d.varint()
+			}
+		case 4:
+			if err = checkWireType(wireType, wireVarint, "Term"); err == nil {
+				m.Term, err = d.varint()
+			}
+		case 5:
+			if err = checkWireType(wireType, wireVarint, "LogTerm"); err == nil {
+				m.LogTerm, err = d.varint()
+			}
+		case 6:
+			if err = checkWireType(wireType, wireVarint, "Index"); err == nil {
+				m.Index, err = d.varint()
+			}
+		case 7:
+			if err = checkWireType(wireType, wireBytes, "Entries"); err == nil {
+				if sub, err = d.sub(); err == nil {
+					m.Entries = append(m.Entries, Entry{})
+					err = m.Entries[len(m.Entries)-1].decode(&sub)
+				}
+			}
+		case 8:
+			if err = checkWireType(wireType, wireVarint, "Commit"); err == nil {
+				m.Commit, err = d.varint()
+			}
+		case 9:
+			if err = checkWireType(wireType, wireBytes, "Snapshot"); err == nil {
+				if sub, err = d.sub(); err == nil {
+					if m.Snapshot == nil {
+						m.Snapshot = &Snapshot{}
+					}
+					err = m.Snapshot.decode(&sub)
+				}
+			}
+		case 10:
+			if err = checkWireType(wireType, wireVarint, "Reject"); err == nil {
+				v, err = d.varint()
+				m.Reject = v != 0
+			}
+		case 11:
+			if err = checkWireType(wireType, wireVarint, "RejectHint"); err == nil {
+				m.RejectHint, err = d.varint()
+			}
+		case 12:
+			if err = checkWireType(wireType, wireBytes, "Context"); err == nil {
+				m.Context, err = d.bytes(m.Context)
+			}
+		case 13:
+			if err = checkWireType(wireType, wireVarint, "Vote"); err == nil {
+				m.Vote, err = d.varint()
+			}
+		case 14:
+			if err = checkWireType(wireType, wireBytes, "Responses"); err == nil {
+				if sub, err = d.sub(); err == nil {
+					m.Responses = append(m.Responses, Message{})
+					err = m.Responses[len(m.Responses)-1].decode(&sub)
+				}
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *HardState) Size() (n int) {
+	return sizeVarint(m.Term) + sizeVarint(m.Vote) + sizeVarint(m.Commit)
+}
+
+func (m *HardState) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *HardState) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *HardState) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *HardState) encode(dAtA []byte, i int) int {
+	i = putVarintField(dAtA, i, key(3, wireVarint), m.Commit)
+	i = putVarintField(dAtA, i, key(2, wireVarint), m.Vote)
+	return putVarintField(dAtA, i, key(1, wireVarint), m.Term)
+}
+
+func (m *HardState) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *HardState) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("HardState")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "Term"); err == nil {
+				m.Term, err = d.varint()
+			}
+		case 2:
+			if err = checkWireType(wireType, wireVarint, "Vote"); err == nil {
+				m.Vote, err = d.varint()
+			}
+		case 3:
+			if err = checkWireType(wireType, wireVarint, "Commit"); err == nil {
+				m.Commit, err = d.varint()
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sizeLabel returns the size of the encoding of a Labels map entry, without
+// its key and length.
+func sizeLabel(k, v string) int {
+	return sizeBytes(len(k)) + sizeBytes(len(v))
+}
+
+func (m *NodeMetadata) Size() (n int) {
+	n = sizeVarint(m.NodeID) + sizeBytes(len(m.Address)) + sizeBytes(len(m.Locality)) + sizeVarint(m.Flags)
+	for k, v := range m.Labels {
+		n += sizeBytes(sizeLabel(k, v))
+	}
+	return n
+}
+
+func (m *NodeMetadata) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *NodeMetadata) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *NodeMetadata) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *NodeMetadata) encode(dAtA []byte, i int) int {
+	i = putVarintField(dAtA, i, key(5, wireVarint), m.Flags)
+	if len(m.Labels) > 0 {
+		keys := make([]string, 0, len(m.Labels))
+		for k := range m.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for j := len(keys) - 1; j >= 0; j-- {
+			k, v := keys[j], m.Labels[keys[j]]
+			end := i
+			i = putStringField(dAtA, i, key(2, wireBytes), v)
+			i = putStringField(dAtA, i, key(1, wireBytes), k)
+			i = putVarintField(dAtA, i, key(4, wireBytes), uint64(end-i))
+		}
+	}
+	i = putStringField(dAtA, i, key(3, wireBytes), m.Locality)
+	i = putStringField(dAtA, i, key(2, wireBytes), m.Address)
+	return putVarintField(dAtA, i, key(1, wireVarint), m.NodeID)
+}
+
+func (m *NodeMetadata) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *NodeMetadata) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("NodeMetadata")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "NodeID"); err == nil {
+				m.NodeID, err = d.varint()
+			}
+		case 2:
+			if err = checkWireType(wireType, wireBytes, "Address"); err == nil {
+				m.Address, err = d.string()
+			}
+		case 3:
+			if err = checkWireType(wireType, wireBytes, "Locality"); err == nil {
+				m.Locality, err = d.string()
+			}
+		case 4:
+			if err = checkWireType(wireType, wireBytes, "Labels"); err == nil {
+				err = m.decodeLabel(d)
+			}
+		case 5:
+			if err = checkWireType(wireType, wireVarint, "Flags"); err == nil {
+				m.Flags, err = d.varint()
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decodeLabel decodes an entry of the Labels map.
+func (m *NodeMetadata) decodeLabel(d *decoder) error {
+	sub, err := d.sub()
+	if err != nil {
+		return err
+	}
+	var k, v string
+	for {
+		start := sub.i
+		field, wireType, ok, err := sub.next("NodeMetadata.Labels")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireBytes, "Labels.key"); err == nil {
+				k, err = sub.string()
+			}
+		case 2:
+			if err = checkWireType(wireType, wireBytes, "Labels.value"); err == nil {
+				v, err = sub.string()
+			}
+		default:
+			err = sub.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if m.Labels == nil {
+		m.Labels = make(map[string]string)
+	}
+	m.Labels[k] = v
+	return nil
+}
+
+func (m *ConfState) Size() (n int) {
+	n = sizeUint64s(m.Voters) + sizeUint64s(m.Learners) + sizeUint64s(m.VotersOutgoing) +
+		sizeUint64s(m.LearnersNext) + sizeVarint(boolToUint64(m.AutoLeave))
+	for i := range m.Metadata {
+		n += sizeBytes(m.Metadata[i].Size())
+	}
+	return n
+}
+
+func (m *ConfState) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *ConfState) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *ConfState) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *ConfState) encode(dAtA []byte, i int) int {
+	for j := len(m.Metadata) - 1; j >= 0; j-- {
+		i = putMessageField(dAtA, i, key(6, wireBytes), &m.Metadata[j])
+	}
+	i = putVarintField(dAtA, i, key(5, wireVarint), boolToUint64(m.AutoLeave))
+	i = putUint64sField(dAtA, i, key(4, wireVarint), m.LearnersNext)
+	i = putUint64sField(dAtA, i, key(3, wireVarint), m.VotersOutgoing)
+	i = putUint64sField(dAtA, i, key(2, wireVarint), m.Learners)
+	return putUint64sField(dAtA, i, key(1, wireVarint), m.Voters)
+}
+
+func (m *ConfState) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *ConfState) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("ConfState")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			m.Voters, err = d.uint64s(m.Voters, wireType, "Voters")
+		case 2:
+			m.Learners, err = d.uint64s(m.Learners, wireType, "Learners")
+		case 3:
+			m.VotersOutgoing, err = d.uint64s(m.VotersOutgoing, wireType, "VotersOutgoing")
+		case 4:
+			m.LearnersNext, err = d.uint64s(m.LearnersNext, wireType, "LearnersNext")
+		case 5:
+			if err = checkWireType(wireType, wireVarint, "AutoLeave"); err == nil {
+				var v uint64
+				v, err = d.varint()
+				m.AutoLeave = v != 0
+			}
+		case 6:
+			if err = checkWireType(wireType, wireBytes, "Metadata"); err == nil {
+				var sub decoder
+				if sub, err = d.sub(); err == nil {
+					m.Metadata = append(m.Metadata, NodeMetadata{})
+					err = m.Metadata[len(m.Metadata)-1].decode(&sub)
+				}
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *ConfChange) Size() (n int) {
+	n = sizeVarint(m.ID) + sizeVarint(uint64(m.Type)) + sizeVarint(m.NodeID)
+	if m.Context != nil {
+		n += sizeBytes(len(m.Context))
+	}
+	return n
+}
+
+func (m *ConfChange) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *ConfChange) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *ConfChange) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *ConfChange) encode(dAtA []byte, i int) int {
+	if m.Context != nil {
+		i = putBytesField(dAtA, i, key(4, wireBytes), m.Context)
+	}
+	i = putVarintField(dAtA, i, key(3, wireVarint), m.NodeID)
+	i = putVarintField(dAtA, i, key(2, wireVarint), uint64(m.Type))
+	return putVarintField(dAtA, i, key(1, wireVarint), m.ID)
+}
+
+func (m *ConfChange) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *ConfChange) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("ConfChange")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "ID"); err == nil {
+				m.ID, err = d.varint()
+			}
+		case 2:
+			if err = checkWireType(wireType, wireVarint, "Type"); err == nil {
+				var v uint64
+				v, err = d.varint()
+				m.Type = ConfChangeType(v)
+			}
+		case 3:
+			if err = checkWireType(wireType, wireVarint, "NodeID"); err == nil {
+				m.NodeID, err = d.varint()
+			}
+		case 4:
+			if err = checkWireType(wireType, wireBytes, "Context"); err == nil {
+				m.Context, err = d.bytes(m.Context)
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *ConfChangeSingle) Size() (n int) {
+	n = sizeVarint(uint64(m.Type)) + sizeVarint(m.NodeID)
+	if m.Metadata != nil {
+		n += sizeBytes(m.Metadata.Size())
+	}
+	return n
+}
+
+func (m *ConfChangeSingle) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *ConfChangeSingle) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *ConfChangeSingle) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *ConfChangeSingle) encode(dAtA []byte, i int) int {
+	if m.Metadata != nil {
+		i = putMessageField(dAtA, i, key(3, wireBytes), m.Metadata)
+	}
+	i = putVarintField(dAtA, i, key(2, wireVarint), m.NodeID)
+	return putVarintField(dAtA, i, key(1, wireVarint), uint64(m.Type))
+}
+
+func (m *ConfChangeSingle) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *ConfChangeSingle) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("ConfChangeSingle")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "Type"); err == nil {
+				var v uint64
+				v, err = d.varint()
+				m.Type = ConfChangeType(v)
+			}
+		case 2:
+			if err = checkWireType(wireType, wireVarint, "NodeID"); err == nil {
+				m.NodeID, err = d.varint()
+			}
+		case 3:
+			if err = checkWireType(wireType, wireBytes, "Metadata"); err == nil {
+				var sub decoder
+				if sub, err = d.sub(); err == nil {
+					if m.Metadata == nil {
+						m.Metadata = &NodeMetadata{}
+					}
+					err = m.Metadata.decode(&sub)
+				}
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *ConfChangeV2) Size() (n int) {
+	n = sizeVarint(uint64(m.Transition))
+	for i := range m.Changes {
+		n += sizeBytes(m.Changes[i].Size())
+	}
+	if m.Context != nil {
+		n += sizeBytes(len(m.Context))
+	}
+	return n
+}
+
+func (m *ConfChangeV2) Marshal() ([]byte, error)           { return marshal(m) }
+func (m *ConfChangeV2) MarshalTo(dAtA []byte) (int, error) { return marshalTo(m, dAtA) }
+func (m *ConfChangeV2) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	return marshalToSizedBuffer(m, dAtA)
+}
+
+func (m *ConfChangeV2) encode(dAtA []byte, i int) int {
+	if m.Context != nil {
+		i = putBytesField(dAtA, i, key(3, wireBytes), m.Context)
+	}
+	for j := len(m.Changes) - 1; j >= 0; j-- {
+		i = putMessageField(dAtA, i, key(2, wireBytes), &m.Changes[j])
+	}
+	return putVarintField(dAtA, i, key(1, wireVarint), uint64(m.Transition))
+}
+
+func (m *ConfChangeV2) Unmarshal(dAtA []byte) error {
+	return m.decode(&decoder{buf: dAtA})
+}
+
+func (m *ConfChangeV2) decode(d *decoder) error {
+	for {
+		start := d.i
+		field, wireType, ok, err := d.next("ConfChangeV2")
+		if err != nil || !ok {
+			return err
+		}
+		switch field {
+		case 1:
+			if err = checkWireType(wireType, wireVarint, "Transition"); err == nil {
+				var v uint64
+				v, err = d.varint()
+				m.Transition = ConfChangeTransition(v)
+			}
+		case 2:
+			if err = checkWireType(wireType, wireBytes, "Changes"); err == nil {
+				var sub decoder
+				if sub, err = d.sub(); err == nil {
+					m.Changes = append(m.Changes, ConfChangeSingle{})
+					err = m.Changes[len(m.Changes)-1].decode(&sub)
+				}
+			}
+		case 3:
+			if err = checkWireType(wireType, wireBytes, "Context"); err == nil {
+				m.Context, err = d.bytes(m.Context)
+			}
+		default:
+			err = d.skip(start)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
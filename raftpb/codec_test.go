@@ -0,0 +1,253 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftpb
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type wireMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+	Size() int
+}
+
+// TestWireFormat tests that the messages are encoded as the code that
+// gogo/protobuf generated from raft.proto encoded them, and decoded back.
+func TestWireFormat(t *testing.T) {
+	checksum := uint32(0xdeadbeef)
+	md := NodeMetadata{NodeID: 3, Address: "10.0.0.3:2380", Locality: "us-east1", Flags: 7,
+		Labels: map[string]string{"rack": "r1"}}
+	cs := ConfState{Voters: []uint64{1, 2, 300}, Learners: []uint64{4}, VotersOutgoing: []uint64{1},
+		LearnersNext: []uint64{5}, AutoLeave: true, Metadata: []NodeMetadata{md, {NodeID: 4}}}
+	ents := []Entry{
+		{Term: 1, Index: 2, Type: EntryNormal, Data: []byte("foo"), Checksum: checksum},
+		{Term: 1 << 40, Index: 1 << 50, Type: EntryConfChangeV2, Data: []byte{}},
+		{},
+	}
+	snap := Snapshot{Data: []byte("snapshot"), Metadata: SnapshotMetadata{ConfState: cs, Index: 10, Term: 3}}
+
+	for i, tt := range []struct {
+		m   wireMessage
+		hex string
+	}{
+		{&Entry{}, "080010001800"},
+		{&ents[0], "0800100118022203666f6f28effdb6f50d"},
+		{&ents[1], "0802108080808080201880808080808080022200"},
+		{&SnapshotMetadata{}, "0a02280010001800"},
+		{&snap.Metadata, "0a440801080208ac02100418012005280132290803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b1202723128073208080412001a002800100a1803"},
+		{&Snapshot{}, "12080a02280010001800"},
+		{&snap, "0a08736e617073686f74124a0a440801080208ac02100418012005280132290803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b1202723128073208080412001a002800100a1803"},
+		{&Message{}, "0800100018002000280030004000500058006800"},
+		{&Message{Type: MsgApp, To: 2, From: 1, Term: 3, LogTerm: 2, Index: 9, Entries: ents, Commit: 8,
+			Vote: 1, Snapshot: &snap, Reject: true, RejectHint: 5, Context: []byte("ctx"),
+			Responses: []Message{{Type: MsgAppResp, To: 1}, {Type: MsgStorageApply, Entries: ents[:1],
+				Responses: []Message{{Type: MsgStorageApplyResp, Context: []byte{}}}}}}, "0803100218012003280230093a110800100118022203666f6f28effdb6f50d3a1408021080808080802018808080808080800222003a0608001000180040084a560a08736e617073686f74124a0a440801080208ac02100418012005280132290803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b1202723128073208080412001a002800100a1803500158056203637478680172140804100118002000280030004000500058006800723f0815100018002000280030003a110800100118022203666f6f28effdb6f50d4000500058006800721608161000180020002800300040005000580062006800"},
+		{&Message{Type: MsgSnap, Snapshot: &Snapshot{}}, "08071000180020002800300040004a0a12080a02280010001800500058006800"},
+		{&HardState{}, "080010001800"},
+		{&HardState{Term: 1, Vote: 2, Commit: 1 << 63}, "080110021880808080808080808001"},
+		{&NodeMetadata{}, "080012001a002800"},
+		{&md, "0803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b120272312807"},
+		{&ConfState{}, "2800"},
+		{&cs, "0801080208ac02100418012005280132290803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b1202723128073208080412001a002800"},
+		{&ConfChange{}, "080010001800"},
+		{&ConfChange{ID: 9, Type: ConfChangeRemoveNode, NodeID: 3, Context: []byte("c")}, "080910011803220163"},
+		{&ConfChangeSingle{}, "08001000"},
+		{&ConfChangeSingle{Type: ConfChangeUpdateNode, NodeID: 3, Metadata: &md}, "080210031a290803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b120272312807"},
+		{&ConfChangeV2{}, "0800"},
+		{&ConfChangeV2{Transition: ConfChangeTransitionJointExplicit, Changes: []ConfChangeSingle{
+			{Type: ConfChangeAddNode, NodeID: 1}, {Type: ConfChangeAddLearnerNode, NodeID: 2, Metadata: &md},
+		}, Context: []byte{}}, "0802120408001001122f080310021a290803120d31302e302e302e333a323338301a0875732d6561737431220a0a047261636b1202723128071a00"},
+	} {
+		b, err := tt.m.Marshal()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := hex.EncodeToString(b); got != tt.hex {
+			t.Errorf("#%d: expected %s, got %s", i, tt.hex, got)
+		}
+		if tt.m.Size() != len(b) {
+			t.Errorf("#%d: expected size %d, got %d", i, len(b), tt.m.Size())
+		}
+		buf := make([]byte, len(b)+3)
+		if n, err := tt.m.(interface {
+			MarshalToSizedBuffer([]byte) (int, error)
+		}).MarshalToSizedBuffer(buf); err != nil || n != len(b) || string(buf[3:]) != string(b) {
+			t.Errorf("#%d: MarshalToSizedBuffer returned %d, %v, %x", i, n, err, buf)
+		}
+
+		decoded := reflect.New(reflect.TypeOf(tt.m).Elem()).Interface().(wireMessage)
+		if err := decoded.Unmarshal(b); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tt.m, decoded) {
+			t.Errorf("#%d: expected %+v, got %+v", i, tt.m, decoded)
+		}
+	}
+}
+
+// TestUnmarshalCompat tests decoding encodings that the messages are not
+// encoded to, but that other protobuf implementations may produce.
+func TestUnmarshalCompat(t *testing.T) {
+	for i, tt := range []struct {
+		hex  string
+		m    wireMessage
+		want wireMessage
+	}{
+		// Packed repeated fields, mixed with unpacked ones.
+		{"0a03010203080408ac02", &ConfState{}, &ConfState{Voters: []uint64{1, 2, 3, 4, 300}}},
+		// Fields out of order, and repeated scalar fields, of which the last one
+		// wins.
+		{"180310011802", &Entry{}, &Entry{Term: 1, Index: 2}},
+		// Unknown fields of all wire types, including groups.
+		{"7801" + "790102030405060708" + "7a0161" + "7b7801c001017c" + "7d01020304" + "0801",
+			&HardState{}, &HardState{Term: 1}},
+	} {
+		b, err := hex.DecodeString(tt.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.m.Unmarshal(b); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tt.want, tt.m) {
+			t.Errorf("#%d: expected %+v, got %+v", i, tt.want, tt.m)
+		}
+	}
+
+	for i, s := range []string{
+		"0a",                     // truncated key
+		"0d01020304",             // wrong wire type
+		"1a05",                   // truncated bytes field
+		"0880808080808080808080", // varint overflow
+		"7c",                     // unmatched end group
+		"0a0201",                 // packed field with a truncated varint
+	} {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e Entry
+		var cs ConfState
+		if e.Unmarshal(b) == nil && cs.Unmarshal(b) == nil {
+			t.Errorf("#%d: expected an error decoding %s", i, s)
+		}
+	}
+}
+
+func TestUnmarshalNoCopy(t *testing.T) {
+	checksum := uint32(1 << 31)
+	ents := []Entry{
+		{Term: 1, Index: 2, Type: EntryNormal, Data: []byte("foo"), Checksum: checksum},
+		{Term: 1, Index: 3, Type: EntryConfChangeV2, Data: []byte{}},
+		{Term: 1 << 40, Index: 1 << 50},
+	}
+	snap := &Snapshot{Data: []byte("data"), Metadata: SnapshotMetadata{
+		ConfState: ConfState{Voters: []uint64{1, 2}, Learners: []uint64{3}}, Index: 3, Term: 1,
+	}}
+	msgs := []Message{
+		{},
+		{Type: MsgApp, To: 2, From: 1, Term: 1, LogTerm: 1, Index: 1, Entries: ents, Commit: 1},
+		{Type: MsgSnap, To: 2, From: 1, Term: 1, Snapshot: snap},
+		{Type: MsgAppResp, Reject: true, RejectHint: 5, Context: []byte("ctx"), Vote: 3},
+		{Type: MsgStorageAppend, Entries: ents[:1], Responses: []Message{
+			{Type: MsgStorageAppendResp, Index: 2},
+			{Type: MsgStorageApply, Entries: ents[1:], Responses: []Message{{Type: MsgStorageApplyResp}}},
+		}},
+	}
+
+	for i, m := range msgs {
+		b, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// An unknown field is skipped.
+		b = append(b, 15<<3, 1)
+
+		var want, got Message
+		if err := want.Unmarshal(b); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if err := got.UnmarshalNoCopy(b); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("#%d: expected %+v, got %+v", i, want, got)
+		}
+
+		// Both methods agree on whether truncated encodings are valid.
+		for n := 0; n < len(b); n++ {
+			var want, got Message
+			wantErr := want.Unmarshal(b[:n])
+			gotErr := got.UnmarshalNoCopy(b[:n])
+			if (wantErr == nil) != (gotErr == nil) {
+				t.Fatalf("#%d: prefix of length %d: expected error %v, got %v", i, n, wantErr, gotErr)
+			}
+		}
+	}
+
+	// The entry data and the context alias the input.
+	m := Message{Type: MsgApp, Entries: ents[:1], Context: []byte("ctx")}
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Message
+	if err := got.UnmarshalNoCopy(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := range b {
+		b[i] = 'x'
+	}
+	if string(got.Entries[0].Data) != "xxx" || string(got.Context) != "xxx" {
+		t.Errorf("expected the data to alias the input, got %q and %q", got.Entries[0].Data, got.Context)
+	}
+	if cap(got.Entries[0].Data) != len(got.Entries[0].Data) {
+		t.Errorf("expected the capacity of the data to be limited")
+	}
+}
+
+func TestCompactText(t *testing.T) {
+	m := Message{Type: MsgApp, To: 2, Entries: []Entry{{Term: 1, Index: 2, Data: []byte("a")}, {Data: []byte{}}},
+		Snapshot: &Snapshot{Metadata: SnapshotMetadata{ConfState: ConfState{Voters: []uint64{1, 2}}}}}
+	exp := `type:MsgApp to:2 entries:<Term:1 Index:2 Data:"a" > entries:<Data:"" > ` +
+		`snapshot:<metadata:<conf_state:<voters:1 voters:2 > > > `
+	if s := m.String(); s != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, s)
+	}
+	m = Message{Snapshot: &Snapshot{}, Responses: []Message{{}}}
+	exp = `snapshot:<> responses:<> `
+	if s := m.String(); s != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, s)
+	}
+	md := NodeMetadata{NodeID: 1, Labels: map[string]string{"b": "2", "a": "1", "c": ""}}
+	exp = `node_id:1 labels:<key:"a" value:"1" > labels:<key:"b" value:"2" > labels:<key:"c" value:"" > `
+	if s := md.String(); s != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, s)
+	}
+	cc := ConfChangeV2{Changes: []ConfChangeSingle{
+		{Type: ConfChangeAddNode, NodeID: 3},
+		{Type: ConfChangeUpdateNode, NodeID: 4, Metadata: &NodeMetadata{NodeID: 4}},
+	}}
+	exp = `changes:<node_id:3 > changes:<type:ConfChangeUpdateNode node_id:4 metadata:<node_id:4 > > `
+	if s := cc.String(); s != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, s)
+	}
+	if s, exp := (&Entry{Checksum: 5}).String(), `Checksum:5 `; s != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, s)
+	}
+}
@@ -18,10 +18,19 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-
-	"github.com/gogo/protobuf/proto"
 )
 
+// String formats the conf change like %v formats the struct, without the
+// metadata if it is nil, e.g. "{ConfChangeAddNode 3}". Unlike the String
+// methods of the other messages, it has a value receiver so that it also
+// applies to the changes of a formatted ConfChangeV2.
+func (m ConfChangeSingle) String() string {
+	if m.Metadata == nil {
+		return fmt.Sprintf("{%v %v}", m.Type, m.NodeID)
+	}
+	return fmt.Sprintf("{%v %v %v}", m.Type, m.NodeID, m.Metadata)
+}
+
 // ConfChangeI abstracts over ConfChangeV2 and (legacy) ConfChange to allow
 // treating them in a unified manner.
 type ConfChangeI interface {
@@ -107,9 +116,7 @@ func (c ConfChangeV2) EnterJoint() (autoLeave bool, ok bool) {
 // This is the case if the ConfChangeV2 is zero, with the possible exception of
 // the Context field.
 func (c ConfChangeV2) LeaveJoint() bool {
-	// NB: c is already a copy.
-	c.Context = nil
-	return proto.Equal(&c, &ConfChangeV2{})
+	return c.Transition == ConfChangeTransitionAuto && len(c.Changes) == 0
 }
 
 // ConfChangesFromString parses a Space-delimited sequence of operations into a
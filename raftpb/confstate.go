@@ -35,6 +35,9 @@ func (cs ConfState) Equivalent(cs2 ConfState) error {
 		s(&cs.Learners)
 		s(&cs.VotersOutgoing)
 		s(&cs.LearnersNext)
+		md := append([]NodeMetadata(nil), cs.Metadata...)
+		sort.Slice(md, func(i, j int) bool { return md[i].NodeID < md[j].NodeID })
+		cs.Metadata = md
 	}
 
 	if !reflect.DeepEqual(cs1, cs2) {
@@ -0,0 +1,76 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftpb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The messages are encoded to JSON by encoding/json, using the field names in
+// their json struct tags, and base64 for bytes fields. The field names are
+// part of the API and must not change, even where they are inconsistent (e.g.
+// "Term" in Entry, but "logTerm" in Message); TestJSONEncoding pins them. The
+// enums below are encoded by name, and decoded by name or number by their
+// UnmarshalJSON methods.
+
+// marshalJSONEnum encodes an enum value by its name, or by its number if it
+// has none.
+func marshalJSONEnum(names map[int32]string, v int32) ([]byte, error) {
+	if name, ok := names[v]; ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(v)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (x EntryType) MarshalJSON() ([]byte, error) {
+	return marshalJSONEnum(EntryType_name, int32(x))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (x MessageType) MarshalJSON() ([]byte, error) {
+	return marshalJSONEnum(MessageType_name, int32(x))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (x ConfChangeTransition) MarshalJSON() ([]byte, error) {
+	return marshalJSONEnum(ConfChangeTransition_name, int32(x))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (x ConfChangeType) MarshalJSON() ([]byte, error) {
+	return marshalJSONEnum(ConfChangeType_name, int32(x))
+}
+
+// unmarshalJSONEnum decodes an enum value from its name or its number.
+func unmarshalJSONEnum(values map[string]int32, data []byte, enum string) (int32, error) {
+	if len(data) > 0 && data[0] == '"' {
+		var name string
+		if err := json.Unmarshal(data, &name); err != nil {
+			return 0, err
+		}
+		v, ok := values[name]
+		if !ok {
+			return 0, fmt.Errorf("unrecognized enum %s value %q", enum, name)
+		}
+		return v, nil
+	}
+	var v int32
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, fmt.Errorf("cannot unmarshal %#q into enum %s", data, enum)
+	}
+	return v, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftpb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONEncoding(t *testing.T) {
+	ents := []Entry{
+		{Term: 1, Index: 2, Type: EntryNormal, Data: []byte("foo"), Checksum: 7},
+		{Term: 1, Index: 3, Type: EntryConfChangeV2},
+	}
+	cs := ConfState{Voters: []uint64{1, 2}, Learners: []uint64{3}}
+	snap := Snapshot{Data: []byte("data"), Metadata: SnapshotMetadata{ConfState: cs, Index: 3, Term: 1}}
+
+	// The keys must match those of earlier releases, which encoded the messages
+	// with the same json struct tags.
+	for i, tt := range []struct {
+		v    interface{}
+		json string
+	}{{
+		v:    &ents[0],
+		json: `{"Term":1,"Index":2,"Type":"EntryNormal","Checksum":7,"Data":"Zm9v"}`,
+	}, {
+		v:    &HardState{Term: 2, Vote: 1, Commit: 3},
+		json: `{"term":2,"vote":1,"commit":3}`,
+	}, {
+		v:    &cs,
+		json: `{"voters":[1,2],"learners":[3],"auto_leave":false,"metadata":null}`,
+	}, {
+		v: &snap,
+		json: `{"data":"ZGF0YQ==","metadata":{"conf_state":{"voters":[1,2],"learners":[3],` +
+			`"auto_leave":false,"metadata":null},"index":3,"term":1}}`,
+	}, {
+		v:    &ConfChange{Type: ConfChangeRemoveNode, NodeID: 2, Context: []byte("ctx"), ID: 5},
+		json: `{"type":"ConfChangeRemoveNode","node_id":2,"context":"Y3R4","id":5}`,
+	}, {
+		v: &ConfChangeV2{Transition: ConfChangeTransitionJointExplicit, Changes: []ConfChangeSingle{
+			{Type: ConfChangeAddLearnerNode, NodeID: 3},
+			{Type: ConfChangeUpdateNode, NodeID: 1, Metadata: &NodeMetadata{NodeID: 1, Address: "a",
+				Labels: map[string]string{"k": "v"}}},
+		}, Context: []byte("ctx")},
+		json: `{"transition":"ConfChangeTransitionJointExplicit","changes":[` +
+			`{"type":"ConfChangeAddLearnerNode","node_id":3},{"type":"ConfChangeUpdateNode","node_id":1,` +
+			`"metadata":{"node_id":1,"address":"a","locality":"","labels":{"k":"v"},"flags":0}}],"context":"Y3R4"}`,
+	}, {
+		v: &Message{Type: MsgApp, To: 2, From: 1, Term: 1, LogTerm: 1, Index: 1, Entries: ents, Commit: 1,
+			Snapshot: &snap, Responses: []Message{{Type: MsgAppResp, To: 1, From: 2, Term: 1, Index: 3}}},
+		json: `{"type":"MsgApp","to":2,"from":1,"term":1,"logTerm":1,"index":1,"entries":[` +
+			`{"Term":1,"Index":2,"Type":"EntryNormal","Checksum":7,"Data":"Zm9v"},` +
+			`{"Term":1,"Index":3,"Type":"EntryConfChangeV2"}],"commit":1,"vote":0,"snapshot":{"data":"ZGF0YQ==",` +
+			`"metadata":{"conf_state":{"voters":[1,2],"learners":[3],"auto_leave":false,"metadata":null},"index":3,"term":1}},` +
+			`"reject":false,"rejectHint":0,"responses":[{"type":"MsgAppResp","to":1,"from":2,"term":1,` +
+			`"logTerm":0,"index":3,"entries":null,"commit":0,"vote":0,"reject":false,"rejectHint":0,"responses":null}]}`,
+	}} {
+		b, err := json.Marshal(tt.v)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if string(b) != tt.json {
+			t.Errorf("#%d: expected\n%s\ngot\n%s", i, tt.json, b)
+		}
+		decoded := reflect.New(reflect.TypeOf(tt.v).Elem()).Interface()
+		if err := json.Unmarshal(b, decoded); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tt.v, decoded) {
+			t.Errorf("#%d: expected %+v, got %+v", i, tt.v, decoded)
+		}
+	}
+
+	// Enums without a name are encoded by number, and enums can be decoded
+	// from numbers.
+	b, err := json.Marshal(MessageType(100))
+	if err != nil || string(b) != "100" {
+		t.Errorf("expected 100, got %s (%v)", b, err)
+	}
+	var mt MessageType
+	if err := json.Unmarshal([]byte("3"), &mt); err != nil || mt != MsgApp {
+		t.Errorf("expected MsgApp, got %s (%v)", mt, err)
+	}
+}
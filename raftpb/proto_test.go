@@ -0,0 +1,209 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftpb
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// protoField is a field of a message in raft.proto.
+type protoField struct {
+	label string // "optional", "repeated" or "map"
+	typ   string
+	name  string
+}
+
+var (
+	commentRE = regexp.MustCompile(`//[^\n]*`)
+	blockRE   = regexp.MustCompile(`(?s)(message|enum)\s+(\w+)\s*\{(.*?)\n\}`)
+	fieldRE   = regexp.MustCompile(`(optional|repeated)\s+(\w+)\s+(\w+)\s*=\s*(\d+)`)
+	mapRE     = regexp.MustCompile(`map<\s*\w+\s*,\s*\w+\s*>\s+(\w+)\s*=\s*(\d+)`)
+	valueRE   = regexp.MustCompile(`(\w+)\s*=\s*(\d+)\s*;`)
+)
+
+// parseProto parses the messages and enums of raft.proto.
+func parseProto(t *testing.T) (messages map[string]map[int]protoField, enums map[string]map[int32]string) {
+	b, err := os.ReadFile("raft.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := commentRE.ReplaceAllString(string(b), "")
+	messages = map[string]map[int]protoField{}
+	enums = map[string]map[int32]string{}
+	for _, m := range blockRE.FindAllStringSubmatch(src, -1) {
+		kind, name, body := m[1], m[2], m[3]
+		if kind == "enum" {
+			values := map[int32]string{}
+			for _, v := range valueRE.FindAllStringSubmatch(body, -1) {
+				n, _ := strconv.Atoi(v[2])
+				values[int32(n)] = v[1]
+			}
+			enums[name] = values
+			continue
+		}
+		fields := map[int]protoField{}
+		for _, f := range fieldRE.FindAllStringSubmatch(body, -1) {
+			n, _ := strconv.Atoi(f[4])
+			fields[n] = protoField{label: f[1], typ: f[2], name: f[3]}
+		}
+		for _, f := range mapRE.FindAllStringSubmatch(body, -1) {
+			n, _ := strconv.Atoi(f[2])
+			fields[n] = protoField{label: "map", typ: "map", name: f[1]}
+		}
+		messages[name] = fields
+	}
+	return messages, enums
+}
+
+// protoWireType returns the wire type of a field of the given type.
+func protoWireType(typ string, enums map[string]map[int32]string) string {
+	switch typ {
+	case "uint64", "uint32", "bool":
+		return "varint"
+	}
+	if _, ok := enums[typ]; ok {
+		return "varint"
+	}
+	return "bytes" // bytes, string, messages and maps
+}
+
+// TestProtoDefinition checks the hand-written messages and codec against
+// raft.proto, so that the two cannot drift apart: the messages must have the
+// fields and enum values defined there, and the codec must encode each field
+// with its field number and wire type.
+func TestProtoDefinition(t *testing.T) {
+	messages, enums := parseProto(t)
+
+	goEnums := map[string]map[int32]string{
+		"EntryType":            EntryType_name,
+		"MessageType":          MessageType_name,
+		"ConfChangeTransition": ConfChangeTransition_name,
+		"ConfChangeType":       ConfChangeType_name,
+	}
+	if len(goEnums) != len(enums) {
+		t.Errorf("raft.proto has %d enums, expected %d", len(enums), len(goEnums))
+	}
+	for name, values := range goEnums {
+		if !reflect.DeepEqual(values, enums[name]) {
+			t.Errorf("%s: raft.proto has values %v, Go has %v", name, enums[name], values)
+		}
+	}
+
+	goMessages := []interface{ Marshal() ([]byte, error) }{
+		&Entry{}, &SnapshotMetadata{}, &Snapshot{}, &Message{}, &HardState{},
+		&NodeMetadata{}, &ConfState{}, &ConfChange{}, &ConfChangeSingle{}, &ConfChangeV2{},
+	}
+	if len(goMessages) != len(messages) {
+		t.Errorf("raft.proto has %d messages, expected %d", len(messages), len(goMessages))
+	}
+	for _, msg := range goMessages {
+		v := reflect.ValueOf(msg).Elem()
+		name := v.Type().Name()
+		fields, ok := messages[name]
+		if !ok {
+			t.Errorf("%s: not in raft.proto", name)
+			continue
+		}
+
+		// The struct tags match raft.proto.
+		seen := map[int]bool{}
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			tag := strings.Split(sf.Tag.Get("protobuf"), ",")
+			num, _ := strconv.Atoi(tag[1])
+			f, ok := fields[num]
+			if !ok {
+				t.Errorf("%s.%s: field %d not in raft.proto", name, sf.Name, num)
+				continue
+			}
+			seen[num] = true
+			label := map[string]string{"opt": "optional", "rep": "repeated"}[tag[2]]
+			if sf.Tag.Get("protobuf_key") != "" {
+				label = "map"
+			}
+			wire := map[string]string{"varint": "varint", "bytes": "bytes"}[tag[0]]
+			if tag[3] != "name="+f.name || label != f.label || wire != protoWireType(f.typ, enums) {
+				t.Errorf("%s.%s: tag %q does not match raft.proto field %d %+v", name, sf.Name, tag, num, f)
+			}
+
+			// Set the field so that it is encoded below.
+			setNonZero(v.Field(i))
+		}
+		for num, f := range fields {
+			if !seen[num] {
+				t.Errorf("%s: raft.proto field %d %+v not in Go", name, num, f)
+			}
+		}
+
+		// The codec encodes each field with its number and wire type.
+		b, err := msg.Marshal()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		encoded := map[int]string{}
+		for len(b) > 0 {
+			k, n := binary.Uvarint(b)
+			b = b[n:]
+			switch k & 7 {
+			case 0:
+				_, n = binary.Uvarint(b)
+				encoded[int(k>>3)] = "varint"
+			case 2:
+				l, m := binary.Uvarint(b)
+				n = m + int(l)
+				encoded[int(k>>3)] = "bytes"
+			default:
+				t.Fatalf("%s: unexpected wire type %d", name, k&7)
+			}
+			b = b[n:]
+		}
+		for num, f := range fields {
+			if wire := protoWireType(f.typ, enums); encoded[num] != wire {
+				t.Errorf("%s: field %d %+v encoded as %q, expected %q", name, num, f, encoded[num], wire)
+			}
+		}
+		if len(encoded) != len(fields) {
+			t.Errorf("%s: encoded fields %v, expected %v", name, encoded, fields)
+		}
+	}
+}
+
+// setNonZero sets v to a non-zero value.
+func setNonZero(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Uint64, reflect.Uint32:
+		v.SetUint(1)
+	case reflect.Int32:
+		v.SetInt(1)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		setNonZero(v.Index(0))
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(reflect.ValueOf("k"), reflect.ValueOf("v"))
+	}
+}
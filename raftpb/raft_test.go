@@ -15,6 +15,7 @@
 package raftpb
 
 import (
+	"fmt"
 	"math/bits"
 	"testing"
 	"unsafe"
@@ -36,13 +37,13 @@ func TestProtoMemorySizes(t *testing.T) {
 	}
 
 	var e Entry
-	assert(unsafe.Sizeof(e), if64Bit(48, 32), "Entry")
+	assert(unsafe.Sizeof(e), if64Bit(48, 36), "Entry")
 
 	var sm SnapshotMetadata
-	assert(unsafe.Sizeof(sm), if64Bit(120, 68), "SnapshotMetadata")
+	assert(unsafe.Sizeof(sm), if64Bit(144, 80), "SnapshotMetadata")
 
 	var s Snapshot
-	assert(unsafe.Sizeof(s), if64Bit(144, 80), "Snapshot")
+	assert(unsafe.Sizeof(s), if64Bit(168, 92), "Snapshot")
 
 	var m Message
 	assert(unsafe.Sizeof(m), if64Bit(160, 112), "Message")
@@ -51,14 +52,27 @@ func TestProtoMemorySizes(t *testing.T) {
 	assert(unsafe.Sizeof(hs), 24, "HardState")
 
 	var cs ConfState
-	assert(unsafe.Sizeof(cs), if64Bit(104, 52), "ConfState")
+	assert(unsafe.Sizeof(cs), if64Bit(128, 64), "ConfState")
 
 	var cc ConfChange
 	assert(unsafe.Sizeof(cc), if64Bit(48, 32), "ConfChange")
 
 	var ccs ConfChangeSingle
-	assert(unsafe.Sizeof(ccs), if64Bit(16, 12), "ConfChangeSingle")
+	assert(unsafe.Sizeof(ccs), if64Bit(24, 16), "ConfChangeSingle")
 
 	var ccv2 ConfChangeV2
 	assert(unsafe.Sizeof(ccv2), if64Bit(56, 28), "ConfChangeV2")
 }
+
+func TestConfChangeSingleString(t *testing.T) {
+	// ConfChangeSingle keeps the format of %v on the struct.
+	cc := ConfChangeV2{Changes: []ConfChangeSingle{
+		{Type: ConfChangeAddNode, NodeID: 3},
+		{Type: ConfChangeUpdateNode, NodeID: 4, Metadata: &NodeMetadata{NodeID: 4}},
+	}}
+	exp := `{ConfChangeTransitionAuto [{ConfChangeAddNode 3} ` +
+		`{ConfChangeUpdateNode 4 node_id:4 }] []}`
+	if s := fmt.Sprintf("%v", cc); s != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, s)
+	}
+}
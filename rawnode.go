@@ -39,6 +39,8 @@ type RawNode struct {
 	prevSoftSt     *SoftState
 	prevHardSt     pb.HardState
 	stepsOnAdvance []pb.Message
+	promotions     map[uint64]*LearnerPromotion
+	decommissions  map[uint64]*NodeDecommission
 }
 
 // NewRawNode instantiates a RawNode from the given configuration.
@@ -62,7 +64,12 @@ func NewRawNode(config *Config) (*RawNode, error) {
 
 // Tick advances the internal logical clock by a single tick.
 func (rn *RawNode) Tick() {
+	if rn.raft.raftLog.corruption != nil {
+		return
+	}
 	rn.raft.tick()
+	rn.updatePromotions(true /* tick */)
+	rn.updateDecommissions(true /* tick */)
 }
 
 // TickQuiesced advances the internal logical clock by a single tick without
@@ -96,6 +103,26 @@ func (rn *RawNode) Propose(data []byte) error {
 		}})
 }
 
+// ProposeBatch proposes that each element of data be appended to the raft log
+// as a single unit. See (Node).ProposeBatch for details.
+func (rn *RawNode) ProposeBatch(data [][]byte) ([]ProposalResult, error) {
+	return rn.ProposeEntries(dataToEntries(data))
+}
+
+// ProposeEntries proposes that the given entries be appended to the raft log
+// as a single unit. See (Node).ProposeEntries for details.
+func (rn *RawNode) ProposeEntries(ents []pb.Entry) ([]ProposalResult, error) {
+	if len(ents) == 0 {
+		return nil, nil
+	}
+	m := batchToMsg(ents)
+	m.From = rn.raft.id
+	if err := rn.raft.Step(m); err != nil {
+		return nil, err
+	}
+	return proposalResults(ents, m.Entries), nil
+}
+
 // ProposeConfChange proposes a config change. See (Node).ProposeConfChange for
 // details.
 func (rn *RawNode) ProposeConfChange(cc pb.ConfChangeI) error {
@@ -111,6 +138,8 @@ func (rn *RawNode) ProposeConfChange(cc pb.ConfChangeI) error {
 // the configuration change, in which case no call must take place.
 func (rn *RawNode) ApplyConfChange(cc pb.ConfChangeI) *pb.ConfState {
 	cs := rn.raft.applyConfChange(cc.AsV2())
+	rn.updatePromotions(false /* tick */)
+	rn.updateDecommissions(false /* tick */)
 	return &cs
 }
 
@@ -503,6 +532,12 @@ func (rn *RawNode) BasicStatus() BasicStatus {
 	return getBasicStatus(rn.raft)
 }
 
+// ProposalQuota returns the capacity of the node to accept further proposals,
+// which is only meaningful on the leader. See ProposalQuota for details.
+func (rn *RawNode) ProposalQuota() ProposalQuota {
+	return getProposalQuota(rn.raft)
+}
+
 // ProgressType indicates the type of replica a Progress corresponds to.
 type ProgressType byte
 
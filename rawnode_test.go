@@ -22,6 +22,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"go.etcd.io/raft/v3/quorum"
 	pb "go.etcd.io/raft/v3/raftpb"
 	"go.etcd.io/raft/v3/tracker"
@@ -37,13 +39,62 @@ type rawNodeAdapter struct {
 var _ Node = (*rawNodeAdapter)(nil)
 
 // TransferLeadership is to test when node specifies lead, which is pointless, can just be filled in.
-func (a *rawNodeAdapter) TransferLeadership(ctx context.Context, lead, transferee uint64) {
+// RawNode reports the outcome via LeaderTransfer, so only the outcome known
+// right away is delivered, which may be LeaderTransferInProgress.
+func (a *rawNodeAdapter) TransferLeadership(ctx context.Context, lead, transferee uint64) <-chan LeaderTransferResult {
+	leader := a.raft.state == StateLeader
 	a.RawNode.TransferLeader(transferee)
+	if !leader {
+		return leaderTransferResultChan(LeaderTransferNotLeader)
+	}
+	if lt := a.RawNode.LeaderTransfer(); lt.Transferee == transferee {
+		return leaderTransferResultChan(lt.Result)
+	}
+	return leaderTransferResultChan(LeaderTransferNotVoter)
+}
+
+// StepDown takes a context and reports the outcome via a channel. RawNode
+// returns the transferee, and reports the outcome via LeaderTransfer.
+func (a *rawNodeAdapter) StepDown(_ context.Context, opts StepDownOptions) <-chan LeaderTransferResult {
+	switch _, err := a.RawNode.StepDown(opts); err {
+	case ErrNotLeader:
+		return leaderTransferResultChan(LeaderTransferNotLeader)
+	case ErrNoTransferCandidate:
+		return leaderTransferResultChan(LeaderTransferNoCandidate)
+	}
+	return leaderTransferResultChan(a.RawNode.LeaderTransfer().Result)
+}
+
+// leaderTransferResultChan returns a closed channel that delivers res.
+func leaderTransferResultChan(res LeaderTransferResult) <-chan LeaderTransferResult {
+	c := make(chan LeaderTransferResult, 1)
+	c <- res
+	close(c)
+	return c
 }
 
 // ForgetLeader takes a context, RawNode doesn't need it.
 func (a *rawNodeAdapter) ForgetLeader(context.Context) error { return a.RawNode.ForgetLeader() }
 
+// AddObserver and RemoveObserver take a context, RawNode doesn't need it.
+func (a *rawNodeAdapter) AddObserver(_ context.Context, id uint64) error {
+	return a.RawNode.AddObserver(id)
+}
+func (a *rawNodeAdapter) RemoveObserver(_ context.Context, id uint64) error {
+	a.RawNode.RemoveObserver(id)
+	return nil
+}
+
+// DecommissionNode and CancelNodeDecommission take a context, RawNode doesn't
+// need it.
+func (a *rawNodeAdapter) DecommissionNode(_ context.Context, id uint64, opts DecommissionOptions) error {
+	return a.RawNode.DecommissionNode(id, opts)
+}
+func (a *rawNodeAdapter) CancelNodeDecommission(_ context.Context, id uint64) error {
+	a.RawNode.CancelNodeDecommission(id)
+	return nil
+}
+
 // Stop when node has a goroutine, RawNode doesn't need this.
 func (a *rawNodeAdapter) Stop() {}
 
@@ -54,6 +105,10 @@ func (a *rawNodeAdapter) Status() Status { return a.RawNode.Status() }
 // to it internally. But maybe that approach is frail.
 func (a *rawNodeAdapter) Advance() { a.RawNode.Advance(Ready{}) }
 
+// ProposalThrottled is a channel fed by the Node goroutine; RawNode users can
+// poll ProposalQuota instead.
+func (a *rawNodeAdapter) ProposalThrottled() <-chan bool { return nil }
+
 // Ready when RawNode returns a Ready, not a chan of one.
 func (a *rawNodeAdapter) Ready() <-chan Ready { return nil }
 
@@ -69,6 +124,12 @@ func (a *rawNodeAdapter) Step(_ context.Context, m pb.Message) error { return a.
 func (a *rawNodeAdapter) Propose(_ context.Context, data []byte) error {
 	return a.RawNode.Propose(data)
 }
+func (a *rawNodeAdapter) ProposeBatch(_ context.Context, data [][]byte) ([]ProposalResult, error) {
+	return a.RawNode.ProposeBatch(data)
+}
+func (a *rawNodeAdapter) ProposeEntries(_ context.Context, ents []pb.Entry) ([]ProposalResult, error) {
+	return a.RawNode.ProposeEntries(ents)
+}
 func (a *rawNodeAdapter) ProposeConfChange(_ context.Context, cc pb.ConfChangeI) error {
 	return a.RawNode.ProposeConfChange(cc)
 }
@@ -594,6 +655,132 @@ func TestRawNodeProposeAddDuplicateNode(t *testing.T) {
 	}
 }
 
+// TestRawNodeProposeBatch ensures that RawNode.ProposeBatch and
+// RawNode.ProposeEntries append all entries of a batch in a single step,
+// report the assigned log positions, and flag refused conf changes.
+func TestRawNodeProposeBatch(t *testing.T) {
+	s := newTestMemoryStorage(withPeers(1))
+	rawNode, err := NewRawNode(newTestConfig(1, 10, 1, s))
+	require.NoError(t, err)
+	require.NoError(t, rawNode.Campaign())
+	for {
+		rd := rawNode.Ready()
+		s.Append(rd.Entries)
+		rawNode.Advance(rd)
+		if len(rd.CommittedEntries) > 0 {
+			break
+		}
+	}
+	lastIndex := rawNode.raft.raftLog.lastIndex()
+
+	res, err := rawNode.ProposeBatch([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	require.NoError(t, err)
+	require.Equal(t, []ProposalResult{
+		{Index: lastIndex + 1, Term: 1},
+		{Index: lastIndex + 2, Term: 1},
+		{Index: lastIndex + 3, Term: 1},
+	}, res)
+
+	// Two conf changes in one batch: the second one is refused since the
+	// first one is pending.
+	cc := pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{{Type: pb.ConfChangeAddLearnerNode, NodeID: 2}}}
+	ccData, err := cc.Marshal()
+	require.NoError(t, err)
+	ents := []pb.Entry{
+		{Type: pb.EntryConfChangeV2, Data: ccData},
+		{Type: pb.EntryNormal, Data: []byte("d")},
+		{Type: pb.EntryConfChangeV2, Data: ccData},
+	}
+	res, err = rawNode.ProposeEntries(ents)
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	require.NoError(t, res[0].Err)
+	require.NoError(t, res[1].Err)
+	var dropErr *ProposalDroppedError
+	require.ErrorAs(t, res[2].Err, &dropErr)
+	require.Equal(t, ProposalDropConfChangeRefused, dropErr.Reason)
+	require.Equal(t, lastIndex+6, res[2].Index)
+	// The caller's entries are not modified.
+	require.Zero(t, ents[0].Index)
+
+	rd := rawNode.Ready()
+	require.Len(t, rd.Entries, 6)
+	require.Equal(t, pb.EntryNormal, rd.Entries[5].Type)
+	require.Nil(t, rd.Entries[5].Data)
+
+	res, err = rawNode.ProposeBatch(nil)
+	require.NoError(t, err)
+	require.Nil(t, res)
+}
+
+// TestRawNodeProposeBatchUncommittedSizeLimit ensures that the uncommitted
+// entry size limit applies to a batch atomically.
+func TestRawNodeProposeBatchUncommittedSizeLimit(t *testing.T) {
+	data := []byte("testdata")
+	s := newTestMemoryStorage(withPeers(1, 2))
+	cfg := newTestConfig(1, 10, 1, s)
+	cfg.MaxUncommittedEntriesSize = uint64(3 * payloadSize(pb.Entry{Data: data}))
+	rawNode, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	rawNode.raft.becomeCandidate()
+	rawNode.raft.becomeLeader()
+
+	// The first batch is accepted since the uncommitted tail is empty.
+	_, err = rawNode.ProposeBatch([][]byte{data, data})
+	require.NoError(t, err)
+	// The second batch would exceed the limit, so none of it is appended.
+	lastIndex := rawNode.raft.raftLog.lastIndex()
+	_, err = rawNode.ProposeBatch([][]byte{data, data})
+	require.ErrorIs(t, err, ErrProposalDropped)
+	require.Equal(t, lastIndex, rawNode.raft.raftLog.lastIndex())
+	// A single entry still fits.
+	res, err := rawNode.ProposeBatch([][]byte{data})
+	require.NoError(t, err)
+	require.Equal(t, lastIndex+1, res[0].Index)
+}
+
+// TestRawNodeProposalQuota ensures that RawNode.ProposalQuota reports the
+// remaining uncommitted quota, the throttling state, and replication lag.
+func TestRawNodeProposalQuota(t *testing.T) {
+	data := []byte("testdata")
+	size := uint64(payloadSize(pb.Entry{Data: data}))
+	s := newTestMemoryStorage(withPeers(1, 2))
+	cfg := newTestConfig(1, 10, 1, s)
+	cfg.MaxUncommittedEntriesSize = 2 * size
+	rawNode, err := NewRawNode(cfg)
+	require.NoError(t, err)
+
+	q := rawNode.ProposalQuota()
+	require.Equal(t, ProposalQuota{MaxUncommittedSize: 2 * size, Available: 2 * size}, q)
+
+	rawNode.raft.becomeCandidate()
+	rawNode.raft.becomeLeader()
+	require.NoError(t, rawNode.Propose(data))
+	q = rawNode.ProposalQuota()
+	require.Equal(t, uint64(1), q.Lead)
+	require.Equal(t, size, q.UncommittedSize)
+	require.Equal(t, size, q.Available)
+	require.False(t, q.Throttled)
+	lastIndex := rawNode.raft.raftLog.lastIndex()
+	require.Equal(t, map[uint64]ReplicationLag{
+		1: {Match: 0, Entries: lastIndex, State: tracker.StateReplicate, RecentActive: true},
+		2: {Match: 0, Entries: lastIndex, State: tracker.StateProbe},
+	}, q.Replication)
+
+	require.NoError(t, rawNode.Propose(data))
+	require.ErrorIs(t, rawNode.Propose(data), ErrProposalDropped)
+	q = rawNode.ProposalQuota()
+	require.Equal(t, 2*size, q.UncommittedSize)
+	require.Zero(t, q.Available)
+	require.True(t, q.Throttled)
+
+	// Applying entries frees up quota and lifts the throttle.
+	rawNode.raft.reduceUncommittedSize(entryPayloadSize(size))
+	q = rawNode.ProposalQuota()
+	require.Equal(t, size, q.Available)
+	require.False(t, q.Throttled)
+}
+
 // TestRawNodeReadIndex ensures that Rawnode.ReadIndex sends the MsgReadIndex message
 // to the underlying raft. It also ensures that ReadState can be read out.
 func TestRawNodeReadIndex(t *testing.T) {
@@ -1249,3 +1436,176 @@ func benchmarkRawNodeImpl(b *testing.B, peers ...uint64) {
 	b.ReportMetric(float64(numReady)/float64(b.N), "ready/op")
 	b.Logf("storage access stats: %+v", s.callStats)
 }
+
+// TestRawNodePromoteLearner verifies that a learner registered for promotion
+// is promoted once it has been caught up for the configured number of ticks.
+func TestRawNodePromoteLearner(t *testing.T) {
+	for _, joint := range []bool{false, true} {
+		t.Run(fmt.Sprint("joint=", joint), func(t *testing.T) {
+			s := newTestMemoryStorage(withPeers(1), withLearners(2))
+			rawNode, err := NewRawNode(newTestConfig(1, 10, 1, s))
+			require.NoError(t, err)
+			require.ErrorIs(t, rawNode.PromoteLearner(1, PromotionOptions{}), ErrNotLearner)
+
+			// drain handles Ready until there is none, applying conf changes and
+			// acknowledging the whole log on behalf of the learner if it is up.
+			learnerUp := false
+			drain := func() {
+				for rawNode.HasReady() {
+					rd := rawNode.Ready()
+					require.NoError(t, s.Append(rd.Entries))
+					for _, ent := range rd.CommittedEntries {
+						if ent.Type == pb.EntryConfChangeV2 {
+							var cc pb.ConfChangeV2
+							require.NoError(t, cc.Unmarshal(ent.Data))
+							rawNode.ApplyConfChange(cc)
+						}
+					}
+					rawNode.Advance(rd)
+					if learnerUp && rawNode.raft.state == StateLeader {
+						require.NoError(t, rawNode.Step(pb.Message{
+							From: 2, To: 1, Type: pb.MsgAppResp, Term: rawNode.raft.Term,
+							Index: rawNode.raft.raftLog.lastIndex(),
+						}))
+					}
+				}
+			}
+			require.NoError(t, rawNode.Campaign())
+			drain()
+			require.Equal(t, StateLeader, rawNode.raft.state)
+
+			opts := PromotionOptions{MaxLag: 1, CaughtUpTicks: 3, Joint: joint}
+			require.NoError(t, rawNode.PromoteLearner(2, opts))
+			rawNode.Tick()
+			p, ok := rawNode.LearnerPromotion(2)
+			require.True(t, ok)
+			require.Equal(t, PromotionWaiting, p.State)
+			require.Zero(t, p.CaughtUpTicks)
+
+			learnerUp = true
+			drain()
+			for i := 1; i < opts.CaughtUpTicks; i++ {
+				rawNode.Tick()
+				drain()
+				p, _ = rawNode.LearnerPromotion(2)
+				require.Equal(t, PromotionWaiting, p.State)
+				require.Equal(t, i, p.CaughtUpTicks)
+			}
+			rawNode.Tick()
+			p, _ = rawNode.LearnerPromotion(2)
+			require.Equal(t, PromotionProposed, p.State)
+			require.Equal(t, rawNode.raft.raftLog.lastIndex(), p.Index)
+
+			drain()
+			p, _ = rawNode.LearnerPromotion(2)
+			require.Equal(t, PromotionSucceeded, p.State)
+			require.NoError(t, p.Err)
+			require.Equal(t, pb.ConfState{Voters: []uint64{1, 2}}, rawNode.raft.prs.ConfState())
+		})
+	}
+}
+
+// TestRawNodePromoteLearnerRemoved verifies that the promotion of a learner
+// fails if the learner is removed.
+func TestRawNodePromoteLearnerRemoved(t *testing.T) {
+	s := newTestMemoryStorage(withPeers(1), withLearners(2))
+	rawNode, err := NewRawNode(newTestConfig(1, 10, 1, s))
+	require.NoError(t, err)
+	require.NoError(t, rawNode.PromoteLearner(2, PromotionOptions{}))
+
+	rawNode.ApplyConfChange(pb.ConfChange{Type: pb.ConfChangeRemoveNode, NodeID: 2})
+	p, ok := rawNode.LearnerPromotion(2)
+	require.True(t, ok)
+	require.Equal(t, PromotionFailed, p.State)
+	require.ErrorIs(t, p.Err, ErrLearnerRemoved)
+
+	rawNode.CancelLearnerPromotion(2)
+	_, ok = rawNode.LearnerPromotion(2)
+	require.False(t, ok)
+}
+
+// TestRawNodeDecommission verifies that a decommissioned node is removed from
+// the configuration, with the leader first transferring its leadership away
+// when decommissioning itself.
+func TestRawNodeDecommission(t *testing.T) {
+	s := newTestMemoryStorage(withPeers(1, 2, 3))
+	rawNode, err := NewRawNode(newTestConfig(1, 10, 1, s))
+	require.NoError(t, err)
+	r := rawNode.raft
+
+	// drain handles Ready until there is none, applying conf changes and
+	// acknowledging the whole log on behalf of node 2 while 1 is the leader.
+	var msgs []pb.Message
+	drain := func() {
+		for rawNode.HasReady() {
+			rd := rawNode.Ready()
+			require.NoError(t, s.Append(rd.Entries))
+			msgs = append(msgs, rd.Messages...)
+			for _, ent := range rd.CommittedEntries {
+				if ent.Type == pb.EntryConfChangeV2 {
+					var cc pb.ConfChangeV2
+					require.NoError(t, cc.Unmarshal(ent.Data))
+					rawNode.ApplyConfChange(cc)
+				}
+			}
+			rawNode.Advance(rd)
+			if r.state == StateLeader {
+				require.NoError(t, rawNode.Step(pb.Message{
+					From: 2, To: 1, Type: pb.MsgAppResp, Term: r.Term, Index: r.raftLog.lastIndex(),
+				}))
+			}
+		}
+	}
+	require.NoError(t, rawNode.Campaign())
+	drain()
+	require.NoError(t, rawNode.Step(pb.Message{From: 2, To: 1, Type: pb.MsgVoteResp, Term: r.Term}))
+	drain()
+	require.Equal(t, StateLeader, r.state)
+
+	require.ErrorIs(t, rawNode.DecommissionNode(4, DecommissionOptions{}), ErrNotInConfig)
+	require.ErrorIs(t, rawNode.DecommissionNode(3, DecommissionOptions{MinFaultTolerance: 1}), ErrFaultToleranceTooLow)
+
+	// Remove node 3.
+	require.NoError(t, rawNode.DecommissionNode(3, DecommissionOptions{}))
+	d, ok := rawNode.NodeDecommission(3)
+	require.True(t, ok)
+	require.Equal(t, DecommissionProposed, d.State)
+	require.Equal(t, r.raftLog.lastIndex(), d.Index)
+	drain()
+	d, _ = rawNode.NodeDecommission(3)
+	require.Equal(t, DecommissionSucceeded, d.State)
+	require.Equal(t, pb.ConfState{Voters: []uint64{1, 2}}, r.prs.ConfState())
+
+	// Remove node 1, the leader, which transfers its leadership to node 2
+	// first.
+	msgs = nil
+	require.NoError(t, rawNode.DecommissionNode(1, DecommissionOptions{}))
+	d, _ = rawNode.NodeDecommission(1)
+	require.Equal(t, DecommissionTransferring, d.State)
+	require.Equal(t, uint64(2), r.leadTransferee)
+	drain()
+	require.Equal(t, pb.MsgTimeoutNow, msgs[len(msgs)-1].Type)
+
+	// Node 2 wins the election. Node 1 forwards the removal to it.
+	msgs = nil
+	require.NoError(t, rawNode.Step(pb.Message{From: 2, To: 1, Type: pb.MsgHeartbeat, Term: r.Term + 1}))
+	rawNode.Tick()
+	drain()
+	d, _ = rawNode.NodeDecommission(1)
+	require.Equal(t, DecommissionProposed, d.State)
+	require.Zero(t, d.Index)
+	require.Equal(t, LeaderTransfer{Transferee: 2, Result: LeaderTransferSucceeded}, rawNode.LeaderTransfer())
+	var forwarded bool
+	for _, m := range msgs {
+		forwarded = forwarded || (m.Type == pb.MsgProp && m.To == 2)
+	}
+	require.True(t, forwarded)
+
+	rawNode.ApplyConfChange(pb.ConfChangeV2{Changes: []pb.ConfChangeSingle{{Type: pb.ConfChangeRemoveNode, NodeID: 1}}})
+	d, _ = rawNode.NodeDecommission(1)
+	require.Equal(t, DecommissionSucceeded, d.State)
+
+	rawNode.CancelNodeDecommission(1)
+	_, ok = rawNode.NodeDecommission(1)
+	require.False(t, ok)
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// SnapshotReady delivers the snapshot requested for the given follower by a
+// MsgStorageSnapshot, see Config.AsyncSnapshots. The snapshot is sent to the
+// follower if it still needs one. If the snapshot could not be generated, an
+// empty snapshot must be delivered instead, in which case another one is
+// requested later. Deliveries that don't correspond to a pending request, for
+// example because the local node lost the leadership since, are ignored.
+func (rn *RawNode) SnapshotReady(to uint64, snap pb.Snapshot) {
+	rn.raft.snapshotReady(to, snap)
+}
+
+// requestSnapshot requests a snapshot for the given follower from the
+// LocalSnapshotThread. The snapshot must cover at least the given index.
+func (r *raft) requestSnapshot(to uint64, index uint64) {
+	if r.snapshotRequests == nil {
+		r.snapshotRequests = map[uint64]struct{}{}
+	}
+	r.snapshotRequests[to] = struct{}{}
+	r.dequeueSnapshot(to)
+	r.logger.Debugf("%x requesting snapshot [index: %d] for %x", r.id, index, to)
+	r.send(pb.Message{To: LocalSnapshotThread, Type: pb.MsgStorageSnapshot, Vote: to, Index: index})
+}
+
+func (r *raft) snapshotReady(to uint64, snap pb.Snapshot) {
+	if _, ok := r.snapshotRequests[to]; !ok {
+		r.logger.Debugf("%x ignoring snapshot for %x that was not requested", r.id, to)
+		return
+	}
+	delete(r.snapshotRequests, to)
+	// NB: the request is dropped if the local node steps down or the follower
+	// is removed, so both are still the case.
+	pr := r.prs.Progress[to]
+	if IsEmptySnap(snap) {
+		r.logger.Warningf("%x failed to generate snapshot for %x", r.id, to)
+	} else if snap.Metadata.Index+1 < r.raftLog.firstIndex() {
+		r.logger.Warningf("%x ignoring snapshot [index: %d] for %x older than the log [firstindex: %d]",
+			r.id, snap.Metadata.Index, to, r.raftLog.firstIndex())
+	} else if pr.State == tracker.StateSnapshot || pr.Next >= r.raftLog.firstIndex() &&
+		(!r.lagsBeyondProbeWindow(pr) || snap.Metadata.Index < pr.Next) {
+		// The follower does not need the snapshot anymore, or it does not
+		// help it catch up.
+		r.sendAppend(to)
+	} else {
+		r.sendSnapshot(to, snap)
+	}
+	// The request held a snapshot slot.
+	r.sendQueuedSnapshots()
+}
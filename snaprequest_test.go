@@ -0,0 +1,134 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+	"go.etcd.io/raft/v3/tracker"
+)
+
+// TestAsyncSnapshots tests that, with AsyncSnapshots, the leader requests the
+// snapshots that followers need via MsgStorageSnapshot, and sends them once
+// they are delivered with RawNode.SnapshotReady.
+func TestAsyncSnapshots(t *testing.T) {
+	snap := pb.Snapshot{Metadata: pb.SnapshotMetadata{
+		Index: 10, Term: 1, ConfState: pb.ConfState{Voters: []uint64{1, 2, 3}},
+	}}
+	storage := newTestMemoryStorage()
+	require.NoError(t, storage.ApplySnapshot(snap))
+	require.NoError(t, storage.Append(cacheTestEntries(11, 16, 1)))
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.AsyncSnapshots = true
+	cfg.MaxConcurrentSnapshots = 1
+	rn, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	r := rn.raft
+	r.becomeCandidate()
+	r.becomeLeader()
+	r.readMessages()
+
+	// Both followers need a snapshot. Only one can be in flight, so the
+	// second follower is queued.
+	snapshots := storage.callStats.snapshot
+	reject := func(from uint64) {
+		require.NoError(t, rn.Step(pb.Message{From: from, To: 1, Term: r.Term, Type: pb.MsgAppResp,
+			Index: 15, Reject: true, RejectHint: 5, LogTerm: 1}))
+	}
+	reject(2)
+	reject(3)
+	request := pb.Message{Type: pb.MsgStorageSnapshot, To: LocalSnapshotThread, From: 1, Term: r.Term,
+		Vote: 2, Index: 10}
+	require.Equal(t, []pb.Message{request}, r.readMessages())
+	require.Equal(t, []uint64{3}, r.snapshotQueue)
+
+	// The snapshot is not requested again while it is being generated.
+	require.NoError(t, rn.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgHeartbeatResp}))
+	require.Empty(t, r.readMessages())
+
+	// A failed generation frees the slot for the queued follower.
+	rn.SnapshotReady(2, pb.Snapshot{})
+	request.Vote = 3
+	require.Equal(t, []pb.Message{request}, r.readMessages())
+	require.Empty(t, r.snapshotQueue)
+	// The failed follower is retried later, and queued until the slot frees.
+	require.NoError(t, rn.Step(pb.Message{From: 2, To: 1, Term: r.Term, Type: pb.MsgHeartbeatResp}))
+	require.Empty(t, r.readMessages())
+	require.Equal(t, []uint64{2}, r.snapshotQueue)
+
+	// Deliveries that were not requested are ignored.
+	rn.SnapshotReady(2, snap)
+	require.Empty(t, r.readMessages())
+
+	rn.SnapshotReady(3, snap)
+	msgs := r.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgSnap, msgs[0].Type)
+	require.Equal(t, uint64(3), msgs[0].To)
+	require.Equal(t, snap.Metadata, msgs[0].Snapshot.Metadata)
+	require.Equal(t, tracker.StateSnapshot, r.prs.Progress[3].State)
+	require.Equal(t, snapshots, storage.callStats.snapshot)
+
+	// Once the follower leaves StateSnapshot, the queued one is requested a
+	// snapshot again.
+	require.NoError(t, rn.Step(pb.Message{From: 3, To: 1, Term: r.Term, Type: pb.MsgAppResp, Index: 10}))
+	request.Vote = 2
+	require.Contains(t, r.readMessages(), request)
+
+	// The requests are dropped on term changes.
+	r.becomeFollower(r.Term+1, None)
+	require.Empty(t, r.snapshotRequests)
+	rn.SnapshotReady(2, snap)
+	require.Empty(t, r.readMessages())
+}
+
+// TestAsyncSnapshotsProbeWindow tests that, with AsyncSnapshots, the leader
+// requests a snapshot for a follower lagging beyond SnapshotProbeWindow, keeps
+// catching it up from the log meanwhile, and sends the snapshot once ready.
+func TestAsyncSnapshotsProbeWindow(t *testing.T) {
+	storage := newTestMemoryStorage(withPeers(1, 2))
+	require.NoError(t, storage.Append(cacheTestEntries(1, 31, 1)))
+	cfg := newTestConfig(1, 10, 1, storage)
+	cfg.AsyncSnapshots = true
+	cfg.SnapshotProbeWindow = 10
+	rn, err := NewRawNode(cfg)
+	require.NoError(t, err)
+	r := rn.raft
+	r.becomeCandidate()
+	r.becomeLeader()
+	r.readMessages()
+
+	pr := r.prs.Progress[2]
+	pr.Next, pr.RecentActive = 5, true
+	r.sendAppend(2)
+	msgs := r.readMessages()
+	require.Len(t, msgs, 2)
+	require.Equal(t, pb.Message{Type: pb.MsgStorageSnapshot, To: LocalSnapshotThread, From: 1, Term: r.Term,
+		Vote: 2, Index: 5}, msgs[0])
+	require.Equal(t, pb.MsgApp, msgs[1].Type)
+
+	snap := pb.Snapshot{Metadata: pb.SnapshotMetadata{
+		Index: 20, Term: 1, ConfState: pb.ConfState{Voters: []uint64{1, 2}},
+	}}
+	pr.BecomeProbe()
+	rn.SnapshotReady(2, snap)
+	msgs = r.readMessages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, pb.MsgSnap, msgs[0].Type)
+	require.Equal(t, tracker.StateSnapshot, pr.State)
+}
@@ -22,11 +22,17 @@ import (
 )
 
 // Status contains information about this Raft peer and its view of the system.
-// The Progress is only populated on the leader.
+// The Progress and Observers are only populated on the leader.
 type Status struct {
 	BasicStatus
 	Config   tracker.Config
 	Progress map[uint64]tracker.Progress
+	// Observers is the replication progress of the observers attached with
+	// RawNode.AddObserver or Node.AddObserver. An observer lags behind by
+	// Commit-Match entries.
+	Observers map[uint64]tracker.Progress
+	// EntryCache describes the entry cache, see Config.MaxEntryCacheSize.
+	EntryCache EntryCacheStats
 }
 
 // BasicStatus contains basic information about the Raft peer. It does not allocate.
@@ -39,6 +45,13 @@ type BasicStatus struct {
 	Applied uint64
 
 	LeadTransferee uint64
+	// LeadTransferElapsed is the number of ticks since the leadership transfer
+	// to LeadTransferee was started. The transfer is given up after an election
+	// timeout.
+	LeadTransferElapsed int
+	// CorruptedIndex is the index of a log entry whose checksum did not match,
+	// see Config.EntryChecksums. If non-zero, the node is inoperable.
+	CorruptedIndex uint64
 }
 
 func getProgressCopy(r *raft) map[uint64]tracker.Progress {
@@ -53,6 +66,19 @@ func getProgressCopy(r *raft) map[uint64]tracker.Progress {
 	return m
 }
 
+func getObserversCopy(r *raft) map[uint64]tracker.Progress {
+	if len(r.observers) == 0 {
+		return nil
+	}
+	m := make(map[uint64]tracker.Progress, len(r.observers))
+	for id, pr := range r.observers {
+		p := *pr
+		p.Inflights = pr.Inflights.Clone()
+		m[id] = p
+	}
+	return m
+}
+
 func getBasicStatus(r *raft) BasicStatus {
 	s := BasicStatus{
 		ID:             r.id,
@@ -61,6 +87,12 @@ func getBasicStatus(r *raft) BasicStatus {
 	s.HardState = r.hardState()
 	s.SoftState = r.softState()
 	s.Applied = r.raftLog.applied
+	if r.leadTransferee != None {
+		s.LeadTransferElapsed = r.electionElapsed
+	}
+	if r.raftLog.corruption != nil {
+		s.CorruptedIndex = r.raftLog.corruption.Index
+	}
 	return s
 }
 
@@ -70,32 +102,45 @@ func getStatus(r *raft) Status {
 	s.BasicStatus = getBasicStatus(r)
 	if s.RaftState == StateLeader {
 		s.Progress = getProgressCopy(r)
+		s.Observers = getObserversCopy(r)
 	}
 	s.Config = r.prs.Config.Clone()
+	s.EntryCache = r.raftLog.cache.stats()
 	return s
 }
 
 // MarshalJSON translates the raft status into JSON.
 // TODO: try to simplify this by introducing ID type into raft
 func (s Status) MarshalJSON() ([]byte, error) {
-	j := fmt.Sprintf(`{"id":"%x","term":%d,"vote":"%x","commit":%d,"lead":"%x","raftState":%q,"applied":%d,"progress":{`,
+	j := fmt.Sprintf(`{"id":"%x","term":%d,"vote":"%x","commit":%d,"lead":"%x","raftState":%q,"applied":%d,"progress":`,
 		s.ID, s.Term, s.Vote, s.Commit, s.Lead, s.RaftState, s.Applied)
 
-	if len(s.Progress) == 0 {
-		j += "},"
-	} else {
-		for k, v := range s.Progress {
-			subj := fmt.Sprintf(`"%x":{"match":%d,"next":%d,"state":%q},`, k, v.Match, v.Next, v.State)
-			j += subj
-		}
-		// remove the trailing ","
-		j = j[:len(j)-1] + "},"
+	j += marshalProgressJSON(s.Progress) + ","
+	if len(s.Observers) > 0 {
+		j += `"observers":` + marshalProgressJSON(s.Observers) + ","
 	}
 
 	j += fmt.Sprintf(`"leadtransferee":"%x"}`, s.LeadTransferee)
 	return []byte(j), nil
 }
 
+// marshalProgressJSON translates the given progress map into a JSON object.
+func marshalProgressJSON(prs map[uint64]tracker.Progress) string {
+	if len(prs) == 0 {
+		return "{}"
+	}
+	j := "{"
+	for k, v := range prs {
+		subj := fmt.Sprintf(`"%x":{"match":%d,"next":%d,"state":%q`, k, v.Match, v.Next, v.State)
+		if v.Inflights != nil && v.Inflights.Adaptive() {
+			subj += fmt.Sprintf(`,"window":%d`, v.Inflights.Window())
+		}
+		j += subj + "},"
+	}
+	// remove the trailing ","
+	return j[:len(j)-1] + "}"
+}
+
 func (s Status) String() string {
 	b, err := s.MarshalJSON()
 	if err != nil {
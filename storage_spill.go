@@ -0,0 +1,423 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"os"
+	"sync"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+// spilledEntry locates an entry in the segment file of a SpillStorage.
+type spilledEntry struct {
+	term uint64
+	// off is the offset of the encoded entry, which follows its size prefix.
+	off  int64
+	size int
+}
+
+// start returns the offset of the size prefix of the entry.
+func (se spilledEntry) start() int64 {
+	return se.off - int64(uvarintLen(uint64(se.size)))
+}
+
+// uvarintLen returns the length of x encoded as a uvarint.
+func uvarintLen(x uint64) int {
+	return (bits.Len64(x|1) + 6) / 7
+}
+
+// SpillStorage implements the Storage interface like MemoryStorage, but only
+// keeps the most recent entries in memory. Older entries are spilled to a
+// segment file, from which they are read back as needed. Terms are always
+// kept in memory.
+//
+// Each entry in the segment file is preceded by its encoded size as a uvarint,
+// so that the file can be inspected without the storage. The segment file is
+// scratch space, and the storage does not survive a restart; like
+// MemoryStorage, it is intended for tests and small deployments. The space of
+// compacted entries in the segment file is reclaimed once all spilled entries
+// have been compacted.
+type SpillStorage struct {
+	// Protects access to all fields. See MemoryStorage.
+	sync.Mutex
+
+	hardState pb.HardState
+	snapshot  pb.Snapshot
+	// dummy is the (compacted) entry preceding the log, of which only the
+	// index and term are retained.
+	dummy pb.Entry
+	// spilled[i] locates the entry at position i+dummy.Index+1 in the segment
+	// file.
+	spilled []spilledEntry
+	// ents[i] has raft log position i+dummy.Index+len(spilled)+1.
+	ents []pb.Entry
+
+	maxMemEntries int
+	f             *os.File
+	// end is the offset in the segment file after the last spilled entry.
+	end int64
+}
+
+// NewSpillStorage creates an empty SpillStorage that keeps at most
+// maxMemEntries entries in memory, and spills older ones to the segment file
+// at the given path. The file is created or truncated, and must not be used by
+// anything else until Close is called.
+func NewSpillStorage(path string, maxMemEntries int) (*SpillStorage, error) {
+	if maxMemEntries <= 0 {
+		return nil, errors.New("max in-memory entries must be greater than 0")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &SpillStorage{maxMemEntries: maxMemEntries, f: f}, nil
+}
+
+// Close closes the segment file. The storage must not be used afterwards.
+func (s *SpillStorage) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.f.Close()
+}
+
+// InitialState implements the Storage interface.
+func (s *SpillStorage) InitialState() (pb.HardState, pb.ConfState, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.hardState, s.snapshot.Metadata.ConfState, nil
+}
+
+// SetHardState saves the current HardState.
+func (s *SpillStorage) SetHardState(st pb.HardState) error {
+	s.Lock()
+	defer s.Unlock()
+	s.hardState = st
+	return nil
+}
+
+// Entries implements the Storage interface. The Data of spilled entries
+// aliases a buffer that is read from the segment file for the call, so
+// retaining any of them retains the data of all spilled entries returned by
+// the call. Callers that keep entries around for long, and only some of them,
+// should copy their Data.
+func (s *SpillStorage) Entries(lo, hi, maxSize uint64) ([]pb.Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+	offset := s.dummy.Index
+	if lo <= offset {
+		return nil, ErrCompacted
+	}
+	if hi > s.lastIndex()+1 {
+		getLogger().Panicf("entries' hi(%d) is out of bound lastindex(%d)", hi, s.lastIndex())
+	}
+	// only contains the dummy entry.
+	if s.lastIndex() == offset {
+		return nil, ErrUnavailable
+	}
+
+	// Like limitSize, return at least one entry, and stop before the first
+	// one that exceeds maxSize.
+	var size uint64
+	fits := func(n int, entSize int) bool {
+		size += uint64(entSize)
+		return n == 0 || size <= maxSize
+	}
+
+	var ents []pb.Entry
+	memFirst := s.memFirstIndex()
+	if lo < memFirst {
+		i, j := lo-offset-1, lo-offset-1
+		for ; j+offset+1 < hi && j < uint64(len(s.spilled)); j++ {
+			if !fits(int(j-i), s.spilled[j].size) {
+				break
+			}
+		}
+		var err error
+		if ents, err = s.readSpilled(s.spilled[i:j]); err != nil {
+			return nil, err
+		}
+		if j+offset+1 < memFirst {
+			// Stopped early due to maxSize, or because hi was reached.
+			return ents, nil
+		}
+		lo = memFirst
+	}
+	for i := lo; i < hi; i++ {
+		e := s.ents[i-memFirst]
+		if !fits(len(ents), e.Size()) {
+			break
+		}
+		ents = append(ents, e)
+	}
+	// NB: unlike MemoryStorage, ents never aliases s.ents, so the caller may
+	// append to it, and s.ents may be modified in place.
+	return ents, nil
+}
+
+// readSpilled reads the given consecutive spilled entries from the segment
+// file.
+func (s *SpillStorage) readSpilled(sl []spilledEntry) ([]pb.Entry, error) {
+	if len(sl) == 0 {
+		return nil, nil
+	}
+	start := sl[0].off
+	last := sl[len(sl)-1]
+	buf := make([]byte, last.off+int64(last.size)-start)
+	if _, err := s.f.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+	// buf is not reused, so the entries can alias it rather than each being
+	// copied out of it. This retains buf as long as any of them is retained,
+	// see Entries. In particular, raftLog only retains entries read from
+	// Storage in raftLog.fetched, which holds all entries of a read.
+	ents := make([]pb.Entry, len(sl))
+	for i, se := range sl {
+		b := buf[se.off-start : se.off-start+int64(se.size)]
+		if err := ents[i].UnmarshalNoCopy(b); err != nil {
+			return nil, err
+		}
+	}
+	return ents, nil
+}
+
+// Term implements the Storage interface.
+func (s *SpillStorage) Term(i uint64) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+	offset := s.dummy.Index
+	switch {
+	case i < offset:
+		return 0, ErrCompacted
+	case i == offset:
+		return s.dummy.Term, nil
+	case i > s.lastIndex():
+		return 0, ErrUnavailable
+	case i < s.memFirstIndex():
+		return s.spilled[i-offset-1].term, nil
+	}
+	return s.ents[i-s.memFirstIndex()].Term, nil
+}
+
+// LastIndex implements the Storage interface.
+func (s *SpillStorage) LastIndex() (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.lastIndex(), nil
+}
+
+func (s *SpillStorage) lastIndex() uint64 {
+	return s.memFirstIndex() + uint64(len(s.ents)) - 1
+}
+
+// memFirstIndex returns the index of the first entry kept in memory.
+func (s *SpillStorage) memFirstIndex() uint64 {
+	return s.dummy.Index + uint64(len(s.spilled)) + 1
+}
+
+// FirstIndex implements the Storage interface.
+func (s *SpillStorage) FirstIndex() (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.dummy.Index + 1, nil
+}
+
+// Snapshot implements the Storage interface.
+func (s *SpillStorage) Snapshot() (pb.Snapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.snapshot, nil
+}
+
+// SpilledEntries returns the number of entries that are currently spilled to
+// the segment file.
+func (s *SpillStorage) SpilledEntries() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.spilled)
+}
+
+// ApplySnapshot overwrites the contents of this Storage object with
+// those of the given snapshot.
+func (s *SpillStorage) ApplySnapshot(snap pb.Snapshot) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.snapshot.Metadata.Index >= snap.Metadata.Index {
+		return ErrSnapOutOfDate
+	}
+	if err := s.truncateSpilled(0); err != nil {
+		return err
+	}
+	s.snapshot = snap
+	s.dummy = pb.Entry{Term: snap.Metadata.Term, Index: snap.Metadata.Index}
+	s.ents = nil
+	return nil
+}
+
+// CreateSnapshot makes a snapshot which can be retrieved with Snapshot() and
+// can be used to reconstruct the state at that point. See
+// MemoryStorage.CreateSnapshot.
+func (s *SpillStorage) CreateSnapshot(i uint64, cs *pb.ConfState, data []byte) (pb.Snapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+	if i <= s.snapshot.Metadata.Index {
+		return pb.Snapshot{}, ErrSnapOutOfDate
+	}
+	if i > s.lastIndex() {
+		getLogger().Panicf("snapshot %d is out of bound lastindex(%d)", i, s.lastIndex())
+	}
+
+	s.snapshot.Metadata.Index = i
+	s.snapshot.Metadata.Term = s.term(i)
+	if cs != nil {
+		s.snapshot.Metadata.ConfState = *cs
+	}
+	s.snapshot.Data = data
+	return s.snapshot, nil
+}
+
+// term returns the term of the entry at index i, which must be in
+// [dummy.Index, lastIndex()].
+func (s *SpillStorage) term(i uint64) uint64 {
+	switch offset := s.dummy.Index; {
+	case i == offset:
+		return s.dummy.Term
+	case i < s.memFirstIndex():
+		return s.spilled[i-offset-1].term
+	}
+	return s.ents[i-s.memFirstIndex()].Term
+}
+
+// Compact discards all log entries prior to compactIndex. See
+// MemoryStorage.Compact.
+func (s *SpillStorage) Compact(compactIndex uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	offset := s.dummy.Index
+	if compactIndex <= offset {
+		return ErrCompacted
+	}
+	if compactIndex > s.lastIndex() {
+		getLogger().Panicf("compact %d is out of bound lastindex(%d)", compactIndex, s.lastIndex())
+	}
+
+	term := s.term(compactIndex)
+	if memFirst := s.memFirstIndex(); compactIndex < memFirst {
+		s.spilled = s.spilled[compactIndex-offset:]
+		if len(s.spilled) == 0 {
+			if err := s.truncateSpilled(0); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := s.truncateSpilled(0); err != nil {
+			return err
+		}
+		s.ents = s.ents[compactIndex+1-memFirst:]
+	}
+	s.dummy = pb.Entry{Index: compactIndex, Term: term}
+	return nil
+}
+
+// Append the new entries to storage, spilling the oldest entries kept in
+// memory to the segment file if there are too many.
+func (s *SpillStorage) Append(entries []pb.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	first := s.dummy.Index + 1
+	last := entries[0].Index + uint64(len(entries)) - 1
+
+	// shortcut if there is no new entry.
+	if last < first {
+		return nil
+	}
+	// truncate compacted entries
+	if first > entries[0].Index {
+		entries = entries[first-entries[0].Index:]
+	}
+
+	memFirst := s.memFirstIndex()
+	switch at := entries[0].Index; {
+	case at > s.lastIndex()+1:
+		getLogger().Panicf("missing log entry [last: %d, append at: %d]",
+			s.lastIndex(), at)
+	case at < memFirst:
+		// The spilled tail of the log is overwritten.
+		if err := s.truncateSpilled(int(at - first)); err != nil {
+			return err
+		}
+		s.ents = append([]pb.Entry(nil), entries...)
+	default:
+		s.ents = append(s.ents[:at-memFirst], entries...)
+	}
+	return s.spill()
+}
+
+// truncateSpilled removes the spilled entries from the n-th on, and truncates
+// the segment file accordingly.
+func (s *SpillStorage) truncateSpilled(n int) error {
+	if n == len(s.spilled) {
+		if n == 0 && s.end != 0 {
+			// There may be compacted entries left in the file.
+			s.end = 0
+			return s.f.Truncate(0)
+		}
+		return nil
+	}
+	if n == 0 {
+		s.end = 0
+	} else {
+		s.end = s.spilled[n].start()
+	}
+	s.spilled = s.spilled[:n]
+	return s.f.Truncate(s.end)
+}
+
+// spill writes the oldest entries kept in memory to the segment file until at
+// most maxMemEntries are left.
+func (s *SpillStorage) spill() error {
+	n := len(s.ents) - s.maxMemEntries
+	if n <= 0 {
+		return nil
+	}
+	var buf []byte
+	spilled := make([]spilledEntry, 0, n)
+	for _, e := range s.ents[:n] {
+		size := e.Size()
+		buf = binary.AppendUvarint(buf, uint64(size))
+		start := len(buf)
+		buf = append(buf, make([]byte, size)...)
+		if _, err := e.MarshalTo(buf[start:]); err != nil {
+			return err
+		}
+		spilled = append(spilled, spilledEntry{term: e.Term, off: s.end + int64(start), size: size})
+	}
+	if _, err := s.f.WriteAt(buf, s.end); err != nil {
+		return err
+	}
+	s.end += int64(len(buf))
+	s.spilled = append(s.spilled, spilled...)
+	s.ents = s.ents[n:]
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "go.etcd.io/raft/v3/raftpb"
+)
+
+func newTestSpillStorage(t *testing.T, maxMemEntries int) *SpillStorage {
+	s, err := NewSpillStorage(filepath.Join(t.TempDir(), "segment"), maxMemEntries)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, s.Close()) })
+	return s
+}
+
+func TestSpillStorage(t *testing.T) {
+	s := newTestSpillStorage(t, 2)
+	require.NoError(t, s.ApplySnapshot(pb.Snapshot{Metadata: pb.SnapshotMetadata{Index: 3, Term: 3}}))
+	require.NoError(t, s.Append([]pb.Entry{
+		{Index: 4, Term: 4, Data: []byte("a")},
+		{Index: 5, Term: 5, Data: []byte("b")},
+		{Index: 6, Term: 6, Data: []byte("c")},
+		{Index: 7, Term: 6, Data: []byte("d")},
+	}))
+	require.Equal(t, 2, s.SpilledEntries())
+
+	ents, err := s.Entries(4, 8, noLimit)
+	require.NoError(t, err)
+	require.Len(t, ents, 4)
+	require.Equal(t, []byte("a"), ents[0].Data)
+	require.Equal(t, []byte("d"), ents[3].Data)
+	// At least one entry is returned.
+	ents, err = s.Entries(4, 8, 0)
+	require.NoError(t, err)
+	require.Len(t, ents, 1)
+	term, err := s.Term(5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), term)
+
+	// Overwrite the spilled tail.
+	require.NoError(t, s.Append([]pb.Entry{{Index: 5, Term: 7, Data: []byte("e")}}))
+	require.Equal(t, 1, s.SpilledEntries())
+	last, err := s.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), last)
+
+	require.NoError(t, s.Compact(4))
+	require.Zero(t, s.SpilledEntries())
+	_, err = s.Entries(4, 6, noLimit)
+	require.Equal(t, ErrCompacted, err)
+	_, err = s.Term(3)
+	require.Equal(t, ErrCompacted, err)
+	term, err = s.Term(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), term)
+	require.Equal(t, ErrCompacted, s.Compact(4))
+}
+
+// TestSpillStorageRandom verifies that SpillStorage behaves like MemoryStorage
+// under random appends, compactions and reads.
+func TestSpillStorageSegmentFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment")
+	s, err := NewSpillStorage(path, 1)
+	require.NoError(t, err)
+	ents := []pb.Entry{
+		{Index: 1, Term: 1, Data: []byte("a")},
+		{Index: 2, Term: 1, Data: make([]byte, 200)},
+		{Index: 3, Term: 2},
+		{Index: 4, Term: 2, Data: []byte("d")},
+	}
+	require.NoError(t, s.Append(ents))
+	// Overwrite the spilled tail, which truncates the segment file.
+	ents[2] = pb.Entry{Index: 3, Term: 3, Data: []byte("c")}
+	require.NoError(t, s.Append(ents[2:]))
+	require.NoError(t, s.Close())
+
+	// The segment file holds the spilled entries, each preceded by its size.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var spilled []pb.Entry
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		require.Greater(t, n, 0)
+		var e pb.Entry
+		require.NoError(t, e.Unmarshal(data[n:n+int(size)]))
+		spilled = append(spilled, e)
+		data = data[n+int(size):]
+	}
+	require.Equal(t, ents[:3], spilled)
+}
+
+func TestSpillStorageRandom(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(seed))
+			ms := NewMemoryStorage()
+			ss := newTestSpillStorage(t, 1+rnd.Intn(5))
+			var term uint64 = 1
+			for i := 0; i < 500; i++ {
+				first, err := ms.FirstIndex()
+				require.NoError(t, err)
+				last, err := ms.LastIndex()
+				require.NoError(t, err)
+				switch op := rnd.Intn(10); {
+				case op < 5:
+					// Append, possibly overwriting a suffix.
+					at := last + 1
+					if last >= first {
+						at -= uint64(rnd.Intn(int(last-first) + 2))
+					}
+					term++
+					var ents []pb.Entry
+					for n := rnd.Intn(5) + 1; n > 0; n-- {
+						ents = append(ents, pb.Entry{Index: at, Term: term, Data: make([]byte, rnd.Intn(20))})
+						at++
+					}
+					require.NoError(t, ms.Append(ents))
+					require.NoError(t, ss.Append(ents))
+				case op < 6 && last >= first:
+					idx := first + uint64(rnd.Intn(int(last-first)+1))
+					require.NoError(t, ms.Compact(idx))
+					require.NoError(t, ss.Compact(idx))
+				default:
+					if last < first {
+						break
+					}
+					lo := first - 1 + uint64(rnd.Intn(int(last-first)+2))
+					hi := lo + uint64(rnd.Intn(int(last-lo)+2))
+					maxSize := uint64(rnd.Intn(100))
+					exp, expErr := ms.Entries(lo, hi, maxSize)
+					ents, err := ss.Entries(lo, hi, maxSize)
+					require.Equal(t, expErr, err)
+					require.Equal(t, len(exp), len(ents))
+					for i := range exp {
+						require.Equal(t, exp[i].Index, ents[i].Index)
+						require.Equal(t, exp[i].Term, ents[i].Term)
+						require.Equal(t, len(exp[i].Data), len(ents[i].Data))
+					}
+				}
+				first, _ = ms.FirstIndex()
+				last, _ = ms.LastIndex()
+				for idx := first - 1; idx <= last+1; idx++ {
+					exp, expErr := ms.Term(idx)
+					term, err := ss.Term(idx)
+					require.Equal(t, expErr, err, idx)
+					require.Equal(t, exp, term, idx)
+				}
+				first2, _ := ss.FirstIndex()
+				last2, _ := ss.LastIndex()
+				require.Equal(t, first, first2)
+				require.Equal(t, last, last2)
+			}
+		})
+	}
+}
@@ -37,6 +37,10 @@ type Inflights struct {
 
 	// buffer is a ring buffer containing info about all in-flight messages.
 	buffer []inflight
+
+	// window, if set, adaptively limits the number of inflight messages to
+	// less than size. See NewAdaptiveInflights.
+	window *adaptiveWindow
 }
 
 // NewInflights sets up an Inflights that allows up to size inflight messages,
@@ -50,11 +54,25 @@ func NewInflights(size int, maxBytes uint64) *Inflights {
 	}
 }
 
+// NewAdaptiveInflights is like NewInflights, but the number of inflight
+// messages is further limited by a window that adapts to the observed
+// acknowledgement latency and rejections, between 1 and size. Tick must be
+// called to advance the clock against which latencies are measured.
+func NewAdaptiveInflights(size int, maxBytes uint64) *Inflights {
+	in := NewInflights(size, maxBytes)
+	in.window = newAdaptiveWindow(size)
+	return in
+}
+
 // Clone returns an *Inflights that is identical to but shares no memory with
 // the receiver.
 func (in *Inflights) Clone() *Inflights {
 	ins := *in
 	ins.buffer = append([]inflight(nil), in.buffer...)
+	if in.window != nil {
+		w := *in.window
+		ins.window = &w
+	}
 	return &ins
 }
 
@@ -77,6 +95,9 @@ func (in *Inflights) Add(index, bytes uint64) {
 	in.buffer[next] = inflight{index: index, bytes: bytes}
 	in.count++
 	in.bytes += bytes
+	if in.window != nil {
+		in.window.onSend(index)
+	}
 }
 
 // grow the inflight buffer by doubling up to inflights.size. We grow on demand
@@ -125,19 +146,63 @@ func (in *Inflights) FreeLE(to uint64) {
 		// buffer unnecessarily.
 		in.start = 0
 	}
+	if in.window != nil && i > 0 {
+		in.window.onAck(to, i)
+	}
 }
 
 // Full returns true if no more messages can be sent at the moment.
 func (in *Inflights) Full() bool {
-	return in.count == in.size || (in.maxBytes != 0 && in.bytes >= in.maxBytes)
+	return in.count >= in.Window() || (in.maxBytes != 0 && in.bytes >= in.maxBytes)
 }
 
 // Count returns the number of inflight messages.
 func (in *Inflights) Count() int { return in.count }
 
+// Window returns the current limit on the number of inflight messages. It
+// equals the configured size unless the Inflights is adaptive.
+func (in *Inflights) Window() int {
+	if in.window != nil {
+		return in.window.size
+	}
+	return in.size
+}
+
+// Adaptive returns whether the Inflights was created by NewAdaptiveInflights.
+func (in *Inflights) Adaptive() bool { return in.window != nil }
+
+// Latency returns the most recent and the smallest observed acknowledgement
+// latency, in ticks, of an adaptive Inflights. ok is false if no latency has
+// been measured yet.
+func (in *Inflights) Latency() (last, lowest uint64, ok bool) {
+	if in.window == nil || !in.window.hasLatency {
+		return 0, 0, false
+	}
+	return in.window.latency, in.window.minLatency, true
+}
+
+// Tick advances the clock of an adaptive Inflights by one tick. It is a no-op
+// otherwise.
+func (in *Inflights) Tick() {
+	if in.window != nil {
+		in.window.tick()
+	}
+}
+
+// reject signals to an adaptive Inflights that an append was rejected, which
+// shrinks the window.
+func (in *Inflights) reject() {
+	if in != nil && in.window != nil {
+		in.window.onReject()
+	}
+}
+
 // reset frees all inflights.
 func (in *Inflights) reset() {
 	in.start = 0
 	in.count = 0
 	in.bytes = 0
+	if in.window != nil {
+		in.window.reset()
+	}
 }
@@ -259,3 +259,67 @@ func inflightsBuffer(indices []uint64, sizes []uint64) []inflight {
 	}
 	return buffer
 }
+
+func TestAdaptiveInflights(t *testing.T) {
+	in := NewAdaptiveInflights(16, 0)
+	require.True(t, in.Adaptive())
+	require.Equal(t, 4, in.Window())
+	_, _, ok := in.Latency()
+	require.False(t, ok)
+
+	var index uint64
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			require.False(t, in.Full())
+			index++
+			in.Add(index, 1)
+		}
+		require.True(t, in.Full())
+	}
+
+	// Slow start: the window grows by the number of acked messages.
+	send(4)
+	in.FreeLE(index)
+	require.Equal(t, 8, in.Window())
+	send(8)
+	in.Tick()
+	in.FreeLE(index)
+	require.Equal(t, 16, in.Window(), "window is capped at size")
+	last, lowest, ok := in.Latency()
+	require.True(t, ok)
+	require.Equal(t, uint64(1), last)
+	require.Equal(t, uint64(0), lowest)
+
+	// A rejection halves the window, but only once per round trip.
+	send(16)
+	in.reject()
+	require.Equal(t, 8, in.Window())
+	in.reject()
+	require.Equal(t, 8, in.Window())
+	in.reset()
+	require.Equal(t, 8, in.Window(), "reset retains the window")
+
+	// A high ack latency halves the window, too.
+	send(8)
+	in.Tick()
+	in.Tick()
+	in.Tick()
+	in.FreeLE(index)
+	require.Equal(t, 4, in.Window())
+	last, lowest, _ = in.Latency()
+	require.Equal(t, uint64(3), last)
+	require.Equal(t, uint64(0), lowest)
+
+	// Congestion avoidance: the window grows by one per window's worth of
+	// acked messages.
+	send(4)
+	in.FreeLE(index - 2)
+	require.Equal(t, 4, in.Window())
+	in.FreeLE(index)
+	require.Equal(t, 5, in.Window())
+
+	// Clones do not share the window.
+	c := in.Clone()
+	c.reject()
+	require.Equal(t, 5, in.Window())
+}
@@ -79,6 +79,21 @@ type Progress struct {
 
 	// IsLearner is true if this progress is tracked for a learner.
 	IsLearner bool
+
+	// Delegate is the follower that the leader has delegated the catch-up of
+	// this follower to, or zero if the leader replicates to it directly. While
+	// delegated, the leader does not send replication messages itself; the
+	// delegate sends the entries up to DelegateIndex (and possibly a snapshot)
+	// on the leader's behalf, and this follower acknowledges them to the
+	// leader as usual.
+	Delegate uint64
+	// DelegateIndex is the last index that the delegate was asked to send.
+	DelegateIndex uint64
+	// DelegateElapsed is the number of ticks since the catch-up was delegated.
+	DelegateElapsed int
+	// DelegateSnapshot is true while the delegate has been asked to send a
+	// snapshot that this follower has not acknowledged yet.
+	DelegateSnapshot bool
 }
 
 // ResetState moves the Progress into the specified State, resetting MsgAppFlowPaused,
@@ -200,6 +215,7 @@ func (pr *Progress) MaybeDecrTo(rejected, matchHint uint64) bool {
 		//
 		// TODO(tbg): why not use matchHint if it's larger?
 		pr.Next = pr.Match + 1
+		pr.Inflights.reject()
 		return true
 	}
 
@@ -214,13 +230,33 @@ func (pr *Progress) MaybeDecrTo(rejected, matchHint uint64) bool {
 	return true
 }
 
+// SetDelegate records that the catch-up of this follower, up to the given
+// index, has been delegated to the given follower.
+func (pr *Progress) SetDelegate(delegate, index uint64) {
+	pr.Delegate = delegate
+	pr.DelegateIndex = index
+	pr.DelegateElapsed = 0
+}
+
+// ClearDelegate returns this follower to direct replication by the leader.
+func (pr *Progress) ClearDelegate() {
+	pr.Delegate = 0
+	pr.DelegateIndex = 0
+	pr.DelegateElapsed = 0
+	pr.DelegateSnapshot = false
+}
+
 // IsPaused returns whether sending log entries to this node has been throttled.
 // This is done when a node has rejected recent MsgApps, is currently waiting
-// for a snapshot, or has reached the MaxInflightMsgs limit. In normal
+// for a snapshot, has reached the MaxInflightMsgs limit, or is being caught up
+// by a delegate. In normal
 // operation, this is false. A throttled node will be contacted less frequently
 // until it has reached a state in which it's able to accept a steady stream of
 // log entries again.
 func (pr *Progress) IsPaused() bool {
+	if pr.Delegate != 0 {
+		return true
+	}
 	switch pr.State {
 	case StateProbe:
 		return pr.MsgAppFlowPaused
@@ -245,6 +281,9 @@ func (pr *Progress) String() string {
 	if pr.PendingSnapshot > 0 {
 		fmt.Fprintf(&buf, " pendingSnap=%d", pr.PendingSnapshot)
 	}
+	if pr.Delegate != 0 {
+		fmt.Fprintf(&buf, " delegate=%d@%d", pr.Delegate, pr.DelegateIndex)
+	}
 	if !pr.RecentActive {
 		fmt.Fprint(&buf, " inactive")
 	}
@@ -254,6 +293,9 @@ func (pr *Progress) String() string {
 			fmt.Fprint(&buf, "[full]")
 		}
 	}
+	if pr.Inflights.Adaptive() {
+		fmt.Fprintf(&buf, " window=%d", pr.Inflights.Window())
+	}
 	return buf.String()
 }
 
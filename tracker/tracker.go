@@ -75,6 +75,10 @@ type Config struct {
 	// right away when entering the joint configuration, so that it is caught up
 	// as soon as possible.
 	LearnersNext map[uint64]struct{}
+	// Metadata holds the metadata of the peers in the configuration, if any was
+	// set by the configuration changes adding or updating them. It is nil if
+	// there is none.
+	Metadata map[uint64]pb.NodeMetadata
 }
 
 func (c Config) String() string {
@@ -104,11 +108,32 @@ func (c *Config) Clone() Config {
 		}
 		return mm
 	}
+	var md map[uint64]pb.NodeMetadata
+	if c.Metadata != nil {
+		md = make(map[uint64]pb.NodeMetadata, len(c.Metadata))
+		for id, m := range c.Metadata {
+			md[id] = CloneNodeMetadata(m)
+		}
+	}
 	return Config{
 		Voters:       quorum.JointConfig{clone(c.Voters[0]), clone(c.Voters[1])},
 		Learners:     clone(c.Learners),
 		LearnersNext: clone(c.LearnersNext),
+		Metadata:     md,
+	}
+}
+
+// CloneNodeMetadata returns a copy of the NodeMetadata that shares no memory
+// with the original.
+func CloneNodeMetadata(m pb.NodeMetadata) pb.NodeMetadata {
+	if m.Labels != nil {
+		labels := make(map[string]string, len(m.Labels))
+		for k, v := range m.Labels {
+			labels[k] = v
+		}
+		m.Labels = labels
 	}
+	return m
 }
 
 // ProgressTracker tracks the currently active configuration and the information
@@ -116,20 +141,38 @@ func (c *Config) Clone() Config {
 // index for each peer which in turn allows reasoning about the committed index.
 type ProgressTracker struct {
 	Config
+	Settings
 
 	Progress ProgressMap
 
 	Votes map[uint64]bool
+}
 
+// Settings holds the settings of a ProgressTracker, which are independent of
+// the configuration and carry over when the tracker is recreated.
+type Settings struct {
 	MaxInflight      int
 	MaxInflightBytes uint64
+	// AdaptiveInflights makes new progresses limit their inflight messages
+	// with an adaptive window, see NewAdaptiveInflights.
+	AdaptiveInflights bool
+	// MinLocalities is the number of distinct localities (see
+	// pb.NodeMetadata.Locality) that the quorums for committing entries and
+	// winning elections must span, see quorum.LocalityConfig. Zero disables the
+	// constraint.
+	MinLocalities int
 }
 
 // MakeProgressTracker initializes a ProgressTracker.
 func MakeProgressTracker(maxInflight int, maxBytes uint64) ProgressTracker {
+	return MakeProgressTrackerWithSettings(Settings{MaxInflight: maxInflight, MaxInflightBytes: maxBytes})
+}
+
+// MakeProgressTrackerWithSettings initializes a ProgressTracker with the given
+// settings.
+func MakeProgressTrackerWithSettings(settings Settings) ProgressTracker {
 	p := ProgressTracker{
-		MaxInflight:      maxInflight,
-		MaxInflightBytes: maxBytes,
+		Settings: settings,
 		Config: Config{
 			Voters: quorum.JointConfig{
 				quorum.MajorityConfig{},
@@ -144,6 +187,25 @@ func MakeProgressTracker(maxInflight int, maxBytes uint64) ProgressTracker {
 	return p
 }
 
+// NewInflights returns an *Inflights for a new Progress, as configured by
+// MaxInflight, MaxInflightBytes, and AdaptiveInflights.
+func (p *ProgressTracker) NewInflights() *Inflights {
+	if p.AdaptiveInflights {
+		return NewAdaptiveInflights(p.MaxInflight, p.MaxInflightBytes)
+	}
+	return NewInflights(p.MaxInflight, p.MaxInflightBytes)
+}
+
+// TickInflights advances the clock of all adaptive Inflights by one tick.
+func (p *ProgressTracker) TickInflights() {
+	if !p.AdaptiveInflights {
+		return
+	}
+	for _, pr := range p.Progress {
+		pr.Inflights.Tick()
+	}
+}
+
 // ConfState returns a ConfState representing the active configuration.
 func (p *ProgressTracker) ConfState() pb.ConfState {
 	return pb.ConfState{
@@ -152,7 +214,25 @@ func (p *ProgressTracker) ConfState() pb.ConfState {
 		Learners:       quorum.MajorityConfig(p.Learners).Slice(),
 		LearnersNext:   quorum.MajorityConfig(p.LearnersNext).Slice(),
 		AutoLeave:      p.AutoLeave,
+		Metadata:       p.metadataSlice(),
+	}
+}
+
+// metadataSlice returns the node metadata sorted by node ID.
+func (p *ProgressTracker) metadataSlice() []pb.NodeMetadata {
+	if len(p.Metadata) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(p.Metadata))
+	for id := range p.Metadata {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	md := make([]pb.NodeMetadata, 0, len(ids))
+	for _, id := range ids {
+		md = append(md, CloneNodeMetadata(p.Metadata[id]))
 	}
+	return md
 }
 
 // IsSingleton returns true if (and only if) there is only one voting member
@@ -177,7 +257,23 @@ func (l matchAckIndexer) AckedIndex(id uint64) (quorum.Index, bool) {
 // Committed returns the largest log index known to be committed based on what
 // the voting members of the group have acknowledged.
 func (p *ProgressTracker) Committed() uint64 {
-	return uint64(p.Voters.CommittedIndex(matchAckIndexer(p.Progress)))
+	return uint64(p.quorum().CommittedIndex(matchAckIndexer(p.Progress)))
+}
+
+type metadataLocalityGetter map[uint64]pb.NodeMetadata
+
+// Locality implements quorum.LocalityGetter.
+func (m metadataLocalityGetter) Locality(id uint64) string {
+	return m[id].Locality
+}
+
+// quorum returns the voters along with the locality constraint.
+func (p *ProgressTracker) quorum() quorum.LocalityConfig {
+	return quorum.LocalityConfig{
+		Voters:        p.Voters,
+		Localities:    metadataLocalityGetter(p.Metadata),
+		MinLocalities: p.MinLocalities,
+	}
 }
 
 func insertionSort(sl []uint64) {
@@ -223,7 +319,7 @@ func (p *ProgressTracker) QuorumActive() bool {
 		votes[id] = pr.RecentActive
 	})
 
-	return p.Voters.VoteResult(votes) == quorum.VoteWon
+	return p.quorum().VoteResult(votes) == quorum.VoteWon
 }
 
 // VoterNodes returns a sorted slice of voters.
@@ -285,6 +381,6 @@ func (p *ProgressTracker) TallyVotes() (granted int, rejected int, _ quorum.Vote
 			rejected++
 		}
 	}
-	result := p.Voters.VoteResult(p.Votes)
+	result := p.quorum().VoteResult(p.Votes)
 	return granted, rejected, result
 }
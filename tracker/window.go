@@ -0,0 +1,124 @@
+// Copyright 2023 The etcd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+// initialAdaptiveWindow is the number of in-flight messages an adaptive window
+// starts out with, unless the configured maximum is lower.
+const initialAdaptiveWindow = 4
+
+// adaptiveWindow sizes the in-flight window of a follower in an AIMD
+// (additive increase, multiplicative decrease) fashion, similar to TCP Reno
+// congestion control:
+//
+//   - in slow start (below the threshold), the window grows by the number of
+//     acknowledged messages, i.e. it doubles every round trip;
+//   - in congestion avoidance, the window grows by one message per window's
+//     worth of acknowledged messages, i.e. by one every round trip;
+//   - on congestion, the window and the threshold are halved. At most one
+//     decrease happens per round trip, i.e. congestion signals for messages
+//     sent before the last decrease are ignored.
+//
+// Congestion is signaled by rejected appends and by acknowledgement latencies
+// exceeding twice the smallest latency observed. Latencies are measured in
+// ticks, timing one message per round trip.
+type adaptiveWindow struct {
+	size     int // the current window, in [1, max]
+	max      int
+	ssthresh int // slow start threshold
+	acked    int // messages acked since the window last grew
+
+	now uint64 // the current tick
+
+	lastSent uint64 // the highest index sent
+	// recoverIndex is the value of lastSent at the last decrease.
+	recoverIndex uint64
+
+	sampling    bool   // whether a message is being timed
+	sampleIndex uint64 // the index of the timed message
+	sampleTick  uint64 // the tick at which the timed message was sent
+
+	hasLatency bool
+	latency    uint64 // the most recent latency sample
+	minLatency uint64 // the smallest latency sample
+}
+
+func newAdaptiveWindow(maxSize int) *adaptiveWindow {
+	size := initialAdaptiveWindow
+	if size > maxSize {
+		size = maxSize
+	}
+	return &adaptiveWindow{size: size, max: maxSize, ssthresh: maxSize}
+}
+
+func (w *adaptiveWindow) tick() { w.now++ }
+
+func (w *adaptiveWindow) onSend(index uint64) {
+	w.lastSent = index
+	if !w.sampling {
+		w.sampling = true
+		w.sampleIndex, w.sampleTick = index, w.now
+	}
+}
+
+// onAck registers the acknowledgement of freed messages, the last of which has
+// the given index.
+func (w *adaptiveWindow) onAck(index uint64, freed int) {
+	if w.sampling && index >= w.sampleIndex {
+		w.sampling = false
+		lat := w.now - w.sampleTick
+		w.latency = lat
+		if !w.hasLatency || lat < w.minLatency {
+			w.hasLatency, w.minLatency = true, lat
+		}
+		if lat > 2*w.minLatency+1 && w.sampleIndex > w.recoverIndex {
+			w.decrease()
+			return
+		}
+	}
+	if w.size < w.ssthresh {
+		w.size += freed
+	} else if w.acked += freed; w.acked >= w.size {
+		w.acked -= w.size
+		w.size++
+	}
+	if w.size > w.max {
+		w.size = w.max
+	}
+}
+
+// onReject registers a rejected append.
+func (w *adaptiveWindow) onReject() {
+	if w.lastSent > w.recoverIndex {
+		w.decrease()
+	}
+}
+
+func (w *adaptiveWindow) decrease() {
+	w.ssthresh = w.size / 2
+	if w.ssthresh < 1 {
+		w.ssthresh = 1
+	}
+	w.size = w.ssthresh
+	w.acked = 0
+	w.recoverIndex = w.lastSent
+}
+
+// reset forgets about in-flight messages, retaining the window and the
+// latency statistics.
+func (w *adaptiveWindow) reset() {
+	w.sampling = false
+	w.lastSent = 0
+	w.recoverIndex = 0
+}
@@ -50,6 +50,9 @@ var isLocalMsg = [...]bool{
 	pb.MsgStorageAppendResp: true,
 	pb.MsgStorageApply:      true,
 	pb.MsgStorageApplyResp:  true,
+	pb.MsgStorageFetch:      true,
+	pb.MsgStorageFetchResp:  true,
+	pb.MsgStorageSnapshot:   true,
 }
 
 var isResponseMsg = [...]bool{
@@ -61,6 +64,8 @@ var isResponseMsg = [...]bool{
 	pb.MsgPreVoteResp:       true,
 	pb.MsgStorageAppendResp: true,
 	pb.MsgStorageApplyResp:  true,
+	pb.MsgDelegateAppResp:   true,
+	pb.MsgStorageFetchResp:  true,
 }
 
 func isMsgInArray(msgt pb.MessageType, arr []bool) bool {
@@ -77,7 +82,8 @@ func IsResponseMsg(msgt pb.MessageType) bool {
 }
 
 func IsLocalMsgTarget(id uint64) bool {
-	return id == LocalAppendThread || id == LocalApplyThread
+	return id == LocalAppendThread || id == LocalApplyThread || id == LocalFetchThread ||
+		id == LocalSnapshotThread
 }
 
 // voteResponseType maps vote and prevote message types to their corresponding responses.
@@ -165,13 +171,27 @@ func DescribeMessage(m pb.Message, f EntryFormatter) string {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "%s->%s %v Term:%d Log:%d/%d",
 		describeTarget(m.From), describeTarget(m.To), m.Type, m.Term, m.LogTerm, m.Index)
-	if m.Reject {
-		fmt.Fprintf(&buf, " Rejected (Hint: %d)", m.RejectHint)
-	}
-	if m.Commit != 0 {
-		fmt.Fprintf(&buf, " Commit:%d", m.Commit)
+	switch {
+	case m.Type == pb.MsgStorageFetch:
+		// Commit and RejectHint carry the end of the range and its size limit,
+		// see pb.MsgStorageFetch.
+		fmt.Fprintf(&buf, " Range:[%d,%d) MaxSize:%d", m.Index, m.Commit, m.RejectHint)
+	case m.Type == pb.MsgStorageFetchResp:
+		if m.Reject {
+			fmt.Fprint(&buf, " Failed")
+		}
+	default:
+		if m.Reject {
+			fmt.Fprintf(&buf, " Rejected (Hint: %d)", m.RejectHint)
+		}
+		if m.Commit != 0 {
+			fmt.Fprintf(&buf, " Commit:%d", m.Commit)
+		}
 	}
-	if m.Vote != 0 {
+	if m.Type == pb.MsgStorageSnapshot {
+		// Vote carries the peer the snapshot is for, see pb.MsgStorageSnapshot.
+		fmt.Fprintf(&buf, " For:%s", describeTarget(m.Vote))
+	} else if m.Vote != 0 {
 		fmt.Fprintf(&buf, " Vote:%d", m.Vote)
 	}
 	if len(m.Entries) > 0 {
@@ -208,6 +228,10 @@ func describeTarget(id uint64) string {
 		return "AppendThread"
 	case LocalApplyThread:
 		return "ApplyThread"
+	case LocalFetchThread:
+		return "FetchThread"
+	case LocalSnapshotThread:
+		return "SnapshotThread"
 	default:
 		return fmt.Sprintf("%x", id)
 	}
@@ -40,6 +40,22 @@ func TestDescribeEntry(t *testing.T) {
 	require.Equal(t, "1/2 EntryNormal HELLO\x00WORLD", DescribeEntry(entry, testFormatter))
 }
 
+func TestDescribeLocalMessages(t *testing.T) {
+	for _, tt := range []struct {
+		m    pb.Message
+		want string
+	}{
+		{pb.Message{From: 1, To: LocalFetchThread, Type: pb.MsgStorageFetch, Term: 2, Index: 5, Commit: 9, RejectHint: 1024},
+			"1->FetchThread MsgStorageFetch Term:2 Log:0/5 Range:[5,9) MaxSize:1024"},
+		{pb.Message{From: LocalFetchThread, To: 1, Type: pb.MsgStorageFetchResp, Term: 2, Index: 5, Reject: true},
+			"FetchThread->1 MsgStorageFetchResp Term:2 Log:0/5 Failed"},
+		{pb.Message{From: 1, To: LocalSnapshotThread, Type: pb.MsgStorageSnapshot, Term: 2, Index: 5, Vote: 0x2a},
+			"1->SnapshotThread MsgStorageSnapshot Term:2 Log:0/5 For:2a"},
+	} {
+		require.Equal(t, tt.want, DescribeMessage(tt.m, nil))
+	}
+}
+
 func TestLimitSize(t *testing.T) {
 	ents := []pb.Entry{{Index: 4, Term: 4}, {Index: 5, Term: 5}, {Index: 6, Term: 6}}
 	prefix := func(size int) []pb.Entry {
@@ -96,6 +112,11 @@ func TestIsLocalMsg(t *testing.T) {
 		{pb.MsgStorageAppendResp, true},
 		{pb.MsgStorageApply, true},
 		{pb.MsgStorageApplyResp, true},
+		{pb.MsgDelegateApp, false},
+		{pb.MsgDelegateAppResp, false},
+		{pb.MsgStorageFetch, true},
+		{pb.MsgStorageFetchResp, true},
+		{pb.MsgStorageSnapshot, true},
 	}
 
 	for _, tt := range tests {
@@ -133,6 +154,11 @@ func TestIsResponseMsg(t *testing.T) {
 		{pb.MsgStorageAppendResp, true},
 		{pb.MsgStorageApply, false},
 		{pb.MsgStorageApplyResp, true},
+		{pb.MsgDelegateApp, false},
+		{pb.MsgDelegateAppResp, true},
+		{pb.MsgStorageFetch, false},
+		{pb.MsgStorageFetchResp, true},
+		{pb.MsgStorageSnapshot, false},
 	}
 
 	for i, tt := range tests {